@@ -0,0 +1,180 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/syslog"
+	"os"
+	"os/signal"
+	"os/user"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	auditSuccess = "success"
+	auditFailure = "failure"
+)
+
+var errAuditAuthFailed = errors.New("invalid username or password")
+
+type auditRecord struct {
+	Time      time.Time `json:"time"`
+	Actor     string    `json:"actor,omitempty"`
+	User      string    `json:"user,omitempty"`
+	Operation string    `json:"operation"`
+	Frontend  string    `json:"frontend"`
+	Remote    string    `json:"remote,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+	Result    string    `json:"result"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// AuditLogger writes one JSON object per line for every administrative and
+// authentication event. If no target is configured all records are dropped.
+type AuditLogger struct {
+	mutex  sync.Mutex
+	target string
+	w      io.WriteCloser
+}
+
+var audit = &AuditLogger{}
+
+func (a *AuditLogger) open() (err error) {
+	switch a.target {
+	case "":
+		a.w = nil
+	case "syslog":
+		a.w, err = syslog.New(syslog.LOG_INFO|syslog.LOG_AUTH, "whawty-auth")
+	default:
+		a.w, err = os.OpenFile(a.target, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	}
+	return
+}
+
+// reopen re-opens the audit log. This is needed for log rotation.
+func (a *AuditLogger) reopen() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.w != nil {
+		a.w.Close() //nolint:errcheck
+	}
+	if err := a.open(); err != nil {
+		wl.Printf("audit: failed to re-open '%s': %v", a.target, err)
+	}
+}
+
+// reopenOn re-opens the audit log whenever a signal is received on sig.
+func (a *AuditLogger) reopenOn(sig <-chan os.Signal) {
+	for range sig {
+		a.reopen()
+	}
+}
+
+// Open configures the target of the audit log. target may be empty to disable the
+// audit log, 'syslog' or the path to a file. Files are re-opened on SIGHUP.
+func (a *AuditLogger) Open(target string) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.target = target
+	if err := a.open(); err != nil {
+		return err
+	}
+	// syslog takes care of rotation itself, only files need to be re-opened
+	if a.target != "" && a.target != "syslog" {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGHUP)
+		go a.reopenOn(sig)
+	}
+	return nil
+}
+
+// Log completes rec with the current time and the result based on err and writes it.
+// The request counters of the metrics are updated as well, even if no audit log is
+// configured.
+func (a *AuditLogger) Log(rec auditRecord, err error) {
+	rec.Time = time.Now()
+	rec.Result = auditSuccess
+	if err != nil {
+		rec.Result = auditFailure
+		rec.Error = err.Error()
+	}
+	metrics.requests.Inc(rec.Frontend, rec.Operation, rec.Result)
+
+	data, jerr := json.Marshal(rec)
+	if jerr != nil {
+		wl.Printf("audit: failed to encode record: %v", jerr)
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.w == nil {
+		return
+	}
+	if _, werr := a.w.Write(append(data, '\n')); werr != nil {
+		wl.Printf("audit: failed to write record: %v", werr)
+	}
+}
+
+// LogAuth logs the result of an authentication attempt.
+func (a *AuditLogger) LogAuth(rec auditRecord, ok bool, err error) {
+	rec.Operation = "authenticate"
+	if err == nil && !ok {
+		err = errAuditAuthFailed
+	}
+	a.Log(rec, err)
+}
+
+// cliAuditRecord returns a record for operations run from the command line. The actor
+// is the local system user running the command.
+func cliAuditRecord(username, operation string) auditRecord {
+	rec := auditRecord{Frontend: "cli", User: username, Operation: operation}
+	if u, err := user.Current(); err == nil {
+		rec.Actor = u.Username
+	}
+	return rec
+}
+
+// auditAppPasswordDetail returns the audit detail for an authentication using the
+// application password called name. An empty name means the regular password was used.
+func auditAppPasswordDetail(name string) string {
+	if name == "" {
+		return ""
+	}
+	return "app-password=" + name
+}
@@ -0,0 +1,137 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func readAuditRecords(t *testing.T, path string) (records []map[string]interface{}) {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer f.Close() //nolint:errcheck
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		rec := make(map[string]interface{})
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("invalid audit record '%s': %v", scanner.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	return
+}
+
+func TestAuditRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	a := &AuditLogger{}
+	if err := a.Open(path); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	a.Log(auditRecord{Frontend: "http", Remote: "192.0.2.1", Actor: "admin", User: "alice", Operation: "add"}, nil)
+	a.Log(auditRecord{Frontend: "cli", User: "bob", Operation: "remove"}, errors.New("user does not exist"))
+	a.LogAuth(auditRecord{Frontend: "ldap", User: "alice", Detail: auditAppPasswordDetail("mail")}, false, nil)
+	a.LogAuth(auditRecord{Frontend: "sasl", User: "alice"}, true, nil)
+
+	records := readAuditRecords(t, path)
+	if len(records) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(records))
+	}
+	expected := []map[string]interface{}{
+		{"frontend": "http", "remote": "192.0.2.1", "actor": "admin", "user": "alice", "operation": "add", "result": auditSuccess},
+		{"frontend": "cli", "user": "bob", "operation": "remove", "result": auditFailure, "error": "user does not exist"},
+		{"frontend": "ldap", "user": "alice", "operation": "authenticate", "detail": "app-password=mail", "result": auditFailure, "error": errAuditAuthFailed.Error()},
+		{"frontend": "sasl", "user": "alice", "operation": "authenticate", "result": auditSuccess},
+	}
+	for i, exp := range expected {
+		rec := records[i]
+		if _, exists := rec["time"]; !exists {
+			t.Fatalf("record %d has no time", i)
+		}
+		delete(rec, "time")
+		if len(rec) != len(exp) {
+			t.Fatalf("record %d: expected %v, got %v", i, exp, rec)
+		}
+		for key, value := range exp {
+			if rec[key] != value {
+				t.Fatalf("record %d: expected %v, got %v", i, exp, rec)
+			}
+		}
+	}
+}
+
+func TestAuditTargets(t *testing.T) {
+	a := &AuditLogger{}
+	if err := a.Open(""); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	a.Log(auditRecord{Frontend: "cli", Operation: "init"}, nil)
+
+	if err := a.Open(filepath.Join(t.TempDir(), "does-not-exist", "audit.log")); err == nil {
+		t.Fatal("opening an audit log in a non-existing directory should give an error")
+	}
+}
+
+func TestAuditReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	rotated := filepath.Join(dir, "audit.log.1")
+	a := &AuditLogger{}
+	if err := a.Open(path); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	a.Log(auditRecord{Frontend: "cli", User: "alice", Operation: "add"}, nil)
+
+	if err := os.Rename(path, rotated); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	sig := make(chan os.Signal, 1)
+	sig <- syscall.SIGHUP
+	close(sig)
+	a.reopenOn(sig)
+	a.Log(auditRecord{Frontend: "cli", User: "bob", Operation: "add"}, nil)
+
+	if records := readAuditRecords(t, rotated); len(records) != 1 || records[0]["user"] != "alice" {
+		t.Fatalf("rotated audit log contains wrong records: %v", records)
+	}
+	if records := readAuditRecords(t, path); len(records) != 1 || records[0]["user"] != "bob" {
+		t.Fatalf("re-opened audit log contains wrong records: %v", records)
+	}
+}
@@ -33,40 +33,141 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spreadspace/tlsconfig"
 	"gopkg.in/yaml.v3"
 )
 
+// saslServerConfig holds the settings shared by all saslauthd listeners.
+type saslServerConfig struct {
+	MaxConnections  int           `yaml:"max-connections"`
+	ReadTimeout     time.Duration `yaml:"read-timeout"`
+	WriteTimeout    time.Duration `yaml:"write-timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown-timeout"`
+}
+
 type saslauthdConfig struct {
-	Listen []string `yaml:"listen"`
+	Listen           []string `yaml:"listen"`
+	saslServerConfig `yaml:",inline"`
+}
+
+type saslauthdTLSConfig struct {
+	Listen           []string             `yaml:"listen"`
+	TLS              *tlsconfig.TLSConfig `yaml:"tls"`
+	saslServerConfig `yaml:",inline"`
+}
+
+type webForwardAuthConfig struct {
+	LoginURL     string `yaml:"login-url"`
+	CookieDomain string `yaml:"cookie-domain"`
+}
+
+type webClientConfig struct {
+	ID     string `yaml:"id"`
+	Secret string `yaml:"secret"`
+}
+
+type webIntrospectionConfig struct {
+	Clients []webClientConfig `yaml:"clients"`
+}
+
+type webOIDCClientConfig struct {
+	ID           string   `yaml:"id"`
+	Secret       string   `yaml:"secret"`
+	RedirectURIs []string `yaml:"redirect-uris"`
+}
+
+type webOIDCConfig struct {
+	Issuer        string                `yaml:"issuer"`
+	SigningKey    string                `yaml:"signing-key"`
+	CodeLifetime  time.Duration         `yaml:"code-lifetime"`
+	TokenLifetime time.Duration         `yaml:"token-lifetime"`
+	Clients       []webOIDCClientConfig `yaml:"clients"`
+}
+
+type webSessionConfig struct {
+	Format     string        `yaml:"format"`
+	SigningKey string        `yaml:"signing-key"`
+	Lifetime   time.Duration `yaml:"lifetime"`
+}
+
+type webBasicAuthConfig struct {
+	Service        string            `yaml:"service"`
+	VHosts         map[string]string `yaml:"vhosts"`
+	TrustedProxies []string          `yaml:"trusted-proxies"`
+}
+
+type webRequireTLSConfig struct {
+	TrustedProxies []string `yaml:"trusted-proxies"`
+}
+
+// webConfig holds the settings shared by all web-api listeners.
+type webConfig struct {
+	Sessions      webSessionConfig       `yaml:"sessions"`
+	BasicAuth     webBasicAuthConfig     `yaml:"basic-auth"`
+	ForwardAuth   webForwardAuthConfig   `yaml:"forward-auth"`
+	OIDC          *webOIDCConfig         `yaml:"oidc"`
+	Introspection webIntrospectionConfig `yaml:"introspection"`
+	RequireTLS    *webRequireTLSConfig   `yaml:"require-tls"`
 }
 
 type httpConfig struct {
-	Listen []string `yaml:"listen"`
+	Listen    []string `yaml:"listen"`
+	webConfig `yaml:",inline"`
 }
 
 type httpsConfig struct {
-	Listen []string             `yaml:"listen"`
-	TLS    *tlsconfig.TLSConfig `yaml:"tls"`
+	Listen    []string             `yaml:"listen"`
+	TLS       *tlsconfig.TLSConfig `yaml:"tls"`
+	webConfig `yaml:",inline"`
+}
+
+type ldapSearchConfig struct {
+	BaseDN      string        `yaml:"base-dn"`
+	GroupBaseDN string        `yaml:"group-base-dn"`
+	MailDomain  string        `yaml:"mail-domain"`
+	CacheTTL    time.Duration `yaml:"cache-ttl"`
+}
+
+type ldapBindConfig struct {
+	Attribute string   `yaml:"attribute"`
+	BaseDN    string   `yaml:"base-dn"`
+	Domains   []string `yaml:"domains"`
+}
+
+// ldapServerConfig holds the settings shared by all ldap listeners.
+type ldapServerConfig struct {
+	Service string            `yaml:"service"`
+	Bind    ldapBindConfig    `yaml:"bind"`
+	Search  *ldapSearchConfig `yaml:"search"`
 }
 
 type ldapConfig struct {
-	Listen []string             `yaml:"listen"`
-	TLS    *tlsconfig.TLSConfig `yaml:"tls"`
+	Listen           []string             `yaml:"listen"`
+	TLS              *tlsconfig.TLSConfig `yaml:"tls"`
+	RequireTLS       bool                 `yaml:"require-tls"`
+	ldapServerConfig `yaml:",inline"`
 }
 
 type ldapsConfig struct {
-	Listen []string             `yaml:"listen"`
-	TLS    *tlsconfig.TLSConfig `yaml:"tls"`
+	Listen           []string             `yaml:"listen"`
+	TLS              *tlsconfig.TLSConfig `yaml:"tls"`
+	ldapServerConfig `yaml:",inline"`
+}
+
+type metricsConfig struct {
+	Listen []string `yaml:"listen"`
 }
 
 type listenerConfig struct {
-	SASLAuthd *saslauthdConfig `yaml:"saslauthd"`
-	HTTP      *httpConfig      `yaml:"http"`
-	HTTPs     *httpsConfig     `yaml:"https"`
-	LDAP      *ldapConfig      `yaml:"ldap"`
-	LDAPs     *ldapsConfig     `yaml:"ldaps"`
+	SASLAuthd    *saslauthdConfig    `yaml:"saslauthd"`
+	SASLAuthdTLS *saslauthdTLSConfig `yaml:"saslauthd-tls"`
+	HTTP         *httpConfig         `yaml:"http"`
+	HTTPs        *httpsConfig        `yaml:"https"`
+	LDAP         *ldapConfig         `yaml:"ldap"`
+	LDAPs        *ldapsConfig        `yaml:"ldaps"`
+	Metrics      *metricsConfig      `yaml:"metrics"`
 }
 
 func readListenerConfig(configfile string) (*listenerConfig, error) {
@@ -83,5 +184,22 @@ func readListenerConfig(configfile string) (*listenerConfig, error) {
 	if err = decoder.Decode(c); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %s", err)
 	}
+	if err = c.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file: %s", err)
+	}
 	return c, nil
 }
+
+func (c *listenerConfig) validate() error {
+	if c.LDAP != nil {
+		if err := c.LDAP.validate(); err != nil {
+			return fmt.Errorf("ldap: %v", err)
+		}
+	}
+	if c.LDAPs != nil {
+		if err := c.LDAPs.validate(); err != nil {
+			return fmt.Errorf("ldaps: %v", err)
+		}
+	}
+	return nil
+}
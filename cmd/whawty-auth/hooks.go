@@ -60,6 +60,7 @@ func runHook(executeable, store string) {
 
 	if err := cmd.Start(); err != nil {
 		wl.Printf("Hooks: error calling '%s': %v", executeable, err)
+		metrics.hookRuns.Inc("error")
 		return
 	}
 
@@ -72,16 +73,24 @@ func runHook(executeable, store string) {
 		t := time.NewTimer(time.Minute) // TODO: hardcoded value
 		defer t.Stop()
 
+		killed := false
 		for {
 			select {
 			case <-t.C:
 				wl.Printf("Hooks: killing long running hook '%s'", executeable)
 				cmd.Process.Kill() //nolint:errcheck
+				killed = true
 			case err := <-exited:
-				if err != nil {
+				switch {
+				case killed:
 					wl.Printf("Hooks: '%s': %v", executeable, err)
-				} else {
+					metrics.hookRuns.Inc("killed")
+				case err != nil:
+					wl.Printf("Hooks: '%s': %v", executeable, err)
+					metrics.hookRuns.Inc("failure")
+				default:
 					wdl.Printf("Hooks: '%s': %s", executeable, cmd.ProcessState)
+					metrics.hookRuns.Inc("success")
 				}
 				return
 			}
@@ -0,0 +1,252 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// jwtSigner signs and verifies JSON Web Tokens using either ES256 (ECDSA P-256) or
+// EdDSA (Ed25519).
+type jwtSigner struct {
+	key crypto.Signer
+	alg string
+	kid string
+}
+
+var jwtEncoding = base64.RawURLEncoding
+
+func newJWTSigner(key crypto.Signer) (*jwtSigner, error) {
+	s := &jwtSigner{key: key}
+	switch k := key.Public().(type) {
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New("only ECDSA keys using curve P-256 are supported")
+		}
+		s.alg = "ES256"
+	case ed25519.PublicKey:
+		s.alg = "EdDSA"
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, must be ECDSA P-256 or Ed25519", k)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+	s.kid = jwtEncoding.EncodeToString(sum[:12])
+	return s, nil
+}
+
+// loadJWTSigner reads a PEM encoded private key from keyfile. If keyfile is empty a new
+// ECDSA P-256 key is generated. Tokens signed by such a key are only valid as long as
+// the process is running.
+func loadJWTSigner(keyfile string) (*jwtSigner, error) {
+	if keyfile == "" {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return newJWTSigner(key)
+	}
+
+	data, err := os.ReadFile(keyfile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("'%s' does not contain a PEM encoded key", keyfile)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		err = fmt.Errorf("unsupported PEM block type '%s'", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	return newJWTSigner(signer)
+}
+
+func (s *jwtSigner) sign(data []byte) ([]byte, error) {
+	switch s.alg {
+	case "ES256":
+		digest := sha256.Sum256(data)
+		r, ss, err := ecdsa.Sign(rand.Reader, s.key.(*ecdsa.PrivateKey), digest[:])
+		if err != nil {
+			return nil, err
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		ss.FillBytes(sig[32:])
+		return sig, nil
+	default:
+		return s.key.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+}
+
+func (s *jwtSigner) verify(data, sig []byte) bool {
+	switch s.alg {
+	case "ES256":
+		if len(sig) != 64 {
+			return false
+		}
+		digest := sha256.Sum256(data)
+		r := new(big.Int).SetBytes(sig[:32])
+		ss := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(s.key.Public().(*ecdsa.PublicKey), digest[:], r, ss)
+	default:
+		return ed25519.Verify(s.key.Public().(ed25519.PublicKey), data, sig)
+	}
+}
+
+// Sign returns the compact serialization of a JWT containing claims. typ is put into the
+// header and is used to tell different kinds of tokens apart.
+func (s *jwtSigner) Sign(typ string, claims interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": s.alg, "typ": typ, "kid": s.kid})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	data := jwtEncoding.EncodeToString(header) + "." + jwtEncoding.EncodeToString(payload)
+	sig, err := s.sign([]byte(data))
+	if err != nil {
+		return "", err
+	}
+	return data + "." + jwtEncoding.EncodeToString(sig), nil
+}
+
+type jwtRegisteredClaims struct {
+	Issuer    string `json:"iss,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+// Verify checks the type, signature and expiry of token and decodes the claims into claims.
+func (s *jwtSigner) Verify(token, typ string, claims interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed token")
+	}
+
+	header := struct {
+		Alg string `json:"alg"`
+		Typ string `json:"typ"`
+		Kid string `json:"kid"`
+	}{}
+	data, err := jwtEncoding.DecodeString(parts[0])
+	if err != nil {
+		return fmt.Errorf("malformed token header: %v", err)
+	}
+	if err = json.Unmarshal(data, &header); err != nil {
+		return fmt.Errorf("malformed token header: %v", err)
+	}
+	if header.Alg != s.alg || header.Kid != s.kid {
+		return errors.New("token is not signed by this key")
+	}
+	if header.Typ != typ {
+		return fmt.Errorf("invalid token type '%s'", header.Typ)
+	}
+
+	sig, err := jwtEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("malformed token signature: %v", err)
+	}
+	if !s.verify([]byte(parts[0]+"."+parts[1]), sig) {
+		return errors.New("invalid token signature")
+	}
+
+	if data, err = jwtEncoding.DecodeString(parts[1]); err != nil {
+		return fmt.Errorf("malformed token payload: %v", err)
+	}
+	registered := jwtRegisteredClaims{}
+	if err = json.Unmarshal(data, &registered); err != nil {
+		return fmt.Errorf("malformed token payload: %v", err)
+	}
+	if registered.ExpiresAt == 0 || time.Now().Unix() >= registered.ExpiresAt {
+		return errors.New("token has expired")
+	}
+	return json.Unmarshal(data, claims)
+}
+
+// JWK returns the public key in JSON Web Key format.
+func (s *jwtSigner) JWK() (map[string]string, error) {
+	jwk := map[string]string{"kid": s.kid, "alg": s.alg, "use": "sig"}
+	switch k := s.key.Public().(type) {
+	case *ecdsa.PublicKey:
+		pub, err := k.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		point := pub.Bytes() // uncompressed: 0x04 || X || Y
+		jwk["kty"] = "EC"
+		jwk["crv"] = "P-256"
+		jwk["x"] = jwtEncoding.EncodeToString(point[1:33])
+		jwk["y"] = jwtEncoding.EncodeToString(point[33:])
+	case ed25519.PublicKey:
+		jwk["kty"] = "OKP"
+		jwk["crv"] = "Ed25519"
+		jwk["x"] = jwtEncoding.EncodeToString(k)
+	}
+	return jwk, nil
+}
@@ -0,0 +1,92 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJWTSignVerify(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	ecSigner, err := loadJWTSigner("")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	edSigner, err := newJWTSigner(crypto.Signer(edKey))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	for _, s := range []*jwtSigner{ecSigner, edSigner} {
+		claims := jwtRegisteredClaims{Subject: "test", ExpiresAt: time.Now().Add(time.Minute).Unix()}
+		token, err := s.Sign("JWT", &claims)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		decoded := jwtRegisteredClaims{}
+		if err = s.Verify(token, "JWT", &decoded); err != nil {
+			t.Fatalf("%s: verifying token failed: %v", s.alg, err)
+		}
+		if decoded != claims {
+			t.Fatalf("%s: decoded claims differ: %+v", s.alg, decoded)
+		}
+
+		if err = s.Verify(token, "at+jwt", &decoded); err == nil {
+			t.Fatalf("%s: verifying token with wrong type should fail", s.alg)
+		}
+		parts := strings.Split(token, ".")
+		if err = s.Verify(parts[0]+"."+parts[1]+"."+parts[0], "JWT", &decoded); err == nil {
+			t.Fatalf("%s: verifying token with invalid signature should fail", s.alg)
+		}
+
+		claims.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+		if token, err = s.Sign("JWT", &claims); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if err = s.Verify(token, "JWT", &decoded); err == nil {
+			t.Fatalf("%s: verifying expired token should fail", s.alg)
+		}
+	}
+
+	token, _ := ecSigner.Sign("JWT", &jwtRegisteredClaims{ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	if err = edSigner.Verify(token, "JWT", &jwtRegisteredClaims{}); err == nil {
+		t.Fatal("verifying token signed by another key should fail")
+	}
+}
@@ -32,27 +32,470 @@ package main
 
 import (
 	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"net"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/glauth/ldap"
+	lib "github.com/whawty/auth/store"
 )
 
+var (
+	ldapUserObjectClasses  = []string{"top", "person", "organizationalPerson", "inetOrgPerson"}
+	ldapGroupObjectClasses = []string{"top", "groupOfNames"}
+)
+
+const (
+	ldapGroupAdmins = "admins"
+	ldapGroupUsers  = "users"
+)
+
+// ldapDefaultCacheTTL is used if search.cache-ttl is not set.
+const ldapDefaultCacheTTL = 10 * time.Second
+
+// ldapBinding is the result of the last successful bind of a connection.
+type ldapBinding struct {
+	username    string
+	isAdmin     bool
+	appPassword string
+}
+
+type ldapBindings struct {
+	mutex sync.Mutex
+	conns map[net.Conn]ldapBinding
+}
+
+func (b *ldapBindings) Set(conn net.Conn, binding ldapBinding) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.conns[conn] = binding
+}
+
+func (b *ldapBindings) Get(conn net.Conn) (binding ldapBinding, ok bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	binding, ok = b.conns[conn]
+	return
+}
+
+func (b *ldapBindings) Remove(conn net.Conn) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.conns, conn)
+}
+
+// ldapDirectory caches the entries of the directory so not every search needs to read all
+// user files of the store. Changes show up in search results once the cache has expired.
+type ldapDirectory struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	entries []*ldap.Entry
+	expires time.Time
+}
+
 type ldapHandler struct {
-	store *Store
+	store      *Store
+	config     *ldapServerConfig
+	requireTLS bool
+	bindings   *ldapBindings
+	directory  *ldapDirectory
 }
 
 func (h ldapHandler) Bind(bindDN, bindSimplePw string, conn net.Conn) (ldap.LDAPResultCode, error) {
-	username, _, _ := strings.Cut(bindDN, "@")
-	if ok, _, _, _ := h.store.Authenticate(username, bindSimplePw); !ok {
+	remote, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	h.bindings.Remove(conn)
+	if _, isTLS := conn.(*tls.Conn); h.requireTLS && !isTLS {
+		wdl.Printf("ldap: refusing bind from %s without TLS", remote)
+		return ldap.LDAPResultConfidentialityRequired, nil
+	}
+	username, ok := h.config.bindUsername(bindDN)
+	if !ok {
+		audit.LogAuth(auditRecord{Frontend: "ldap", Remote: remote, User: bindDN}, false, errors.New("bind DN is not allowed"))
+		return ldap.LDAPResultInvalidCredentials, nil
+	}
+	ok, isAdmin, appPassword, err := h.store.AuthenticateWithAppPasswords(username, bindSimplePw, remote)
+	if h.config.Service != "" {
+		ok, err = authorizeService(h.store, username, h.config.Service, ok, err)
+	}
+	audit.LogAuth(auditRecord{Frontend: "ldap", Remote: remote, User: username, Detail: auditAppPasswordDetail(appPassword)}, ok, err)
+	// a service which is not allowed must not reveal that the password was correct
+	if !ok {
 		return ldap.LDAPResultInvalidCredentials, nil
 	}
+	h.bindings.Set(conn, ldapBinding{username: username, isAdmin: isAdmin, appPassword: appPassword})
 	return ldap.LDAPResultSuccess, nil
 }
 
-func runLDAPsListener(listener *net.TCPListener, config *ldapsConfig, store *Store) error {
+func (h ldapHandler) Close(boundDN string, conn net.Conn) error {
+	h.bindings.Remove(conn)
+	return nil
+}
+
+func (c *ldapServerConfig) validate() error {
+	if c.Search == nil {
+		return nil
+	}
+	if strings.TrimSpace(c.Search.BaseDN) == "" {
+		return errors.New("search.base-dn must not be empty")
+	}
+	// groups always use 'cn' so users and groups would share DNs
+	if c.userAttribute() == "cn" && normalizeLDAPDN(c.Search.groupBaseDN()) == normalizeLDAPDN(c.Search.BaseDN) {
+		return errors.New("search.group-base-dn must differ from search.base-dn if bind.attribute is 'cn'")
+	}
+	return nil
+}
+
+func (c *ldapServerConfig) userAttribute() string {
+	if c.Bind.Attribute == "" {
+		return "uid"
+	}
+	return strings.ToLower(c.Bind.Attribute)
+}
+
+func (c *ldapServerConfig) userBaseDN() string {
+	if c.Bind.BaseDN == "" && c.Search != nil {
+		return c.Search.BaseDN
+	}
+	return c.Bind.BaseDN
+}
+
+// bindUsername maps bindDN to a username. Besides plain usernames this accepts DNs of the
+// form '<attribute>=<username>,<base-dn>' and '<username>@<domain>' if the domain is allowed.
+// Usernames containing '@' can only be used within a DN since '<username>@<domain>' would be
+// ambiguous for them.
+func (c *ldapServerConfig) bindUsername(bindDN string) (string, bool) {
+	if strings.Contains(bindDN, "=") {
+		baseDN := c.userBaseDN()
+		if baseDN == "" {
+			return "", false
+		}
+		attr, username, parent, ok := parseLDAPRDN(bindDN)
+		if !ok || !strings.EqualFold(attr, c.userAttribute()) || normalizeLDAPDN(parent) != normalizeLDAPDN(baseDN) {
+			return "", false
+		}
+		// valid usernames never contain characters which must be escaped
+		if escapeLDAPDNValue(username) != username {
+			return "", false
+		}
+		return username, username != ""
+	}
+
+	username, domain, found := strings.Cut(bindDN, "@")
+	if !found {
+		return username, username != ""
+	}
+	for _, allowed := range c.Bind.Domains {
+		if strings.EqualFold(domain, allowed) {
+			return username, username != ""
+		}
+	}
+	return "", false
+}
+
+// ldapDNSpecials are the characters which must be escaped inside attribute values of DNs, see RFC 4514.
+const ldapDNSpecials = "\\\"+,;<>"
+
+// escapeLDAPDNValue escapes value so it can be used as attribute value inside a DN.
+func escapeLDAPDNValue(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case strings.IndexByte(ldapDNSpecials, c) >= 0,
+			c == ' ' && (i == 0 || i == len(value)-1),
+			c == '#' && i == 0:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == 0:
+			b.WriteString("\\00")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// parseLDAPRDN splits the first RDN off dn and returns its attribute as well as the unescaped
+// value. Multi-valued RDNs, values using the hex form and values containing special characters
+// which are not escaped are rejected.
+func parseLDAPRDN(dn string) (attr, value, parent string, ok bool) {
+	attr, rest, found := strings.Cut(dn, "=")
+	if attr = strings.TrimSpace(attr); !found || attr == "" {
+		return "", "", "", false
+	}
+	rest = strings.TrimLeft(rest, " ")
+	if strings.HasPrefix(rest, "#") {
+		return "", "", "", false
+	}
+
+	var b strings.Builder
+	trailing := 0 // number of spaces at the end of value which are not escaped
+	for i := 0; i < len(rest); i++ {
+		c := rest[i]
+		switch {
+		case c == ',':
+			return attr, b.String()[:b.Len()-trailing], rest[i+1:], true
+		case c == '\\':
+			if i+1 >= len(rest) {
+				return "", "", "", false
+			}
+			if next := rest[i+1]; strings.IndexByte(ldapDNSpecials+" #=", next) >= 0 {
+				b.WriteByte(next)
+				i++
+			} else if i+2 < len(rest) {
+				decoded, err := hex.DecodeString(rest[i+1 : i+3])
+				if err != nil {
+					return "", "", "", false
+				}
+				b.Write(decoded)
+				i += 2
+			} else {
+				return "", "", "", false
+			}
+			trailing = 0
+			continue
+		case strings.IndexByte(ldapDNSpecials, c) >= 0:
+			return "", "", "", false
+		case c == ' ':
+			trailing++
+		default:
+			trailing = 0
+		}
+		b.WriteByte(c)
+	}
+	return attr, b.String()[:b.Len()-trailing], "", true
+}
+
+// normalizeLDAPDN lower-cases dn and removes spaces around its components so DNs can be compared.
+func normalizeLDAPDN(dn string) string {
+	rdns := strings.Split(strings.ToLower(dn), ",")
+	for i, rdn := range rdns {
+		attr, value, _ := strings.Cut(rdn, "=")
+		rdns[i] = strings.TrimSpace(attr) + "=" + strings.TrimSpace(value)
+	}
+	return strings.Join(rdns, ",")
+}
+
+// ldapDNRelated returns true if one of the DNs is equal to or below the other one.
+func ldapDNRelated(a, b string) bool {
+	return a == b || strings.HasSuffix(a, ","+b) || strings.HasSuffix(b, ","+a)
+}
+
+func ldapDNInScope(dn, baseDN string, scope int) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return dn == baseDN
+	case ldap.ScopeSingleLevel:
+		_, parent, _ := strings.Cut(dn, ",")
+		return parent == baseDN
+	}
+	return dn == baseDN || strings.HasSuffix(dn, ","+baseDN)
+}
+
+func (c *ldapSearchConfig) groupBaseDN() string {
+	if c.GroupBaseDN == "" {
+		return c.BaseDN
+	}
+	return c.GroupBaseDN
+}
+
+func (h ldapHandler) userDN(username string) string {
+	return h.config.userAttribute() + "=" + escapeLDAPDNValue(username) + "," + h.config.Search.BaseDN
+}
+
+func (h ldapHandler) groupDN(group string) string {
+	return "cn=" + escapeLDAPDNValue(group) + "," + h.config.Search.groupBaseDN()
+}
+
+// ldapGroups returns the names of the virtual groups of a user. Every user is a member of
+// 'users', admins are also members of 'admins'. Role labels which collide with these groups
+// are ignored.
+func ldapGroups(user lib.User) []string {
+	groups := []string{ldapGroupUsers}
+	if user.IsAdmin {
+		groups = append(groups, ldapGroupAdmins)
+	}
+	for _, role := range user.Roles {
+		if role != ldapGroupAdmins && role != ldapGroupUsers {
+			groups = append(groups, role)
+		}
+	}
+	return groups
+}
+
+func (h ldapHandler) userEntry(username string, user lib.User) *ldap.Entry {
+	description := "user"
+	if user.IsAdmin {
+		description = "admin"
+	}
+	var memberOf []string
+	for _, group := range ldapGroups(user) {
+		memberOf = append(memberOf, h.groupDN(group))
+	}
+	entry := &ldap.Entry{
+		DN: h.userDN(username),
+		Attributes: []*ldap.EntryAttribute{
+			{Name: "objectClass", Values: ldapUserObjectClasses},
+			{Name: "uid", Values: []string{username}},
+			{Name: "cn", Values: []string{username}},
+			{Name: "sn", Values: []string{username}},
+			{Name: "description", Values: []string{description}},
+			{Name: "memberOf", Values: memberOf},
+		},
+	}
+	if h.config.Search.MailDomain != "" {
+		entry.Attributes = append(entry.Attributes, &ldap.EntryAttribute{Name: "mail", Values: []string{username + "@" + h.config.Search.MailDomain}})
+	}
+	return entry
+}
+
+func (h ldapHandler) groupEntry(group string, members []string) *ldap.Entry {
+	var memberDNs []string
+	for _, username := range members {
+		memberDNs = append(memberDNs, h.userDN(username))
+	}
+	return &ldap.Entry{
+		DN: h.groupDN(group),
+		Attributes: []*ldap.EntryAttribute{
+			{Name: "objectClass", Values: ldapGroupObjectClasses},
+			{Name: "cn", Values: []string{group}},
+			{Name: "member", Values: memberDNs},
+		},
+	}
+}
+
+// directoryEntries returns the entries of all users followed by the entries of all groups.
+func (h ldapHandler) directoryEntries(users lib.UserList) (entries []*ldap.Entry) {
+	usernames := make([]string, 0, len(users))
+	for username := range users {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+
+	// groupOfNames requires at least one member so only groups with members are published
+	members := make(map[string][]string)
+	for _, username := range usernames {
+		entries = append(entries, h.userEntry(username, users[username]))
+		for _, group := range ldapGroups(users[username]) {
+			members[group] = append(members[group], username)
+		}
+	}
+
+	groups := make([]string, 0, len(members))
+	for group := range members {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		entries = append(entries, h.groupEntry(group, members[group]))
+	}
+	return
+}
+
+// entries returns the entries of the directory, the store is only read if the cache has expired.
+func (h ldapHandler) entries() ([]*ldap.Entry, error) {
+	h.directory.mutex.Lock()
+	defer h.directory.mutex.Unlock()
+
+	if h.directory.entries != nil && time.Now().Before(h.directory.expires) {
+		return h.directory.entries, nil
+	}
+	users, err := h.store.List()
+	if err != nil {
+		return nil, err
+	}
+	h.directory.entries = h.directoryEntries(users)
+	h.directory.expires = time.Now().Add(h.directory.ttl)
+	return h.directory.entries, nil
+}
+
+// selectLDAPAttributes removes all attributes from entry which have not been requested.
+func selectLDAPAttributes(entry *ldap.Entry, attributes []string) *ldap.Entry {
+	if len(attributes) == 0 {
+		return entry
+	}
+	selected := &ldap.Entry{DN: entry.DN}
+	for _, attr := range entry.Attributes {
+		for _, name := range attributes {
+			if name == "*" || strings.EqualFold(name, attr.Name) {
+				selected.Attributes = append(selected.Attributes, attr)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+func (h ldapHandler) Search(boundDN string, req ldap.SearchRequest, conn net.Conn) (result ldap.ServerSearchResult, err error) {
+	result.ResultCode = ldap.LDAPResultSuccess
+	// boundDN is kept by the server even if a later bind of the connection failed
+	if _, bound := h.bindings.Get(conn); !bound {
+		result.ResultCode = ldap.LDAPResultInsufficientAccessRights
+		return result, errors.New("search is only allowed after a successful bind")
+	}
+	if h.config.Search == nil {
+		result.ResultCode = ldap.LDAPResultUnwillingToPerform
+		return result, errors.New("search is not enabled")
+	}
+
+	baseDN := normalizeLDAPDN(req.BaseDN)
+	if !ldapDNRelated(baseDN, normalizeLDAPDN(h.config.Search.BaseDN)) && !ldapDNRelated(baseDN, normalizeLDAPDN(h.config.Search.groupBaseDN())) {
+		result.ResultCode = ldap.LDAPResultNoSuchObject
+		return result, fmt.Errorf("'%s' is not part of the directory", req.BaseDN)
+	}
+	filter, err := ldap.CompileFilter(req.Filter)
+	if err != nil {
+		result.ResultCode = ldap.LDAPResultProtocolError
+		return result, err
+	}
+
+	entries, err := h.entries()
+	if err != nil {
+		result.ResultCode = ldap.LDAPResultOperationsError
+		return result, err
+	}
+	for _, entry := range entries {
+		if !ldapDNInScope(normalizeLDAPDN(entry.DN), baseDN, req.Scope) {
+			continue
+		}
+		keep, code := ldap.ServerApplyFilter(filter, entry)
+		if code != ldap.LDAPResultSuccess {
+			result.ResultCode = code
+			return result, fmt.Errorf("failed to apply filter '%s'", req.Filter)
+		}
+		if !keep {
+			continue
+		}
+		if req.SizeLimit > 0 && len(result.Entries) >= req.SizeLimit {
+			result.ResultCode = ldap.LDAPResultSizeLimitExceeded
+			break
+		}
+		result.Entries = append(result.Entries, selectLDAPAttributes(entry, req.Attributes))
+	}
+	return result, nil
+}
+
+func newLDAPServer(config *ldapServerConfig, requireTLS bool, store *Store) *ldap.Server {
 	server := ldap.NewServer()
-	server.BindFunc("", ldapHandler{store: store})
+	handler := ldapHandler{store: store, config: config, requireTLS: requireTLS, bindings: &ldapBindings{conns: make(map[net.Conn]ldapBinding)}}
+	handler.directory = &ldapDirectory{ttl: ldapDefaultCacheTTL}
+	if config.Search != nil && config.Search.CacheTTL != 0 {
+		handler.directory.ttl = config.Search.CacheTTL
+	}
+	server.BindFunc("", handler)
+	server.SearchFunc("", handler)
+	server.ExtendedFunc("", handler)
+	server.CloseFunc("", handler)
+	return server
+}
+
+func runLDAPsListener(listener *net.TCPListener, config *ldapsConfig, store *Store) error {
+	server := newLDAPServer(&config.ldapServerConfig, false, store)
 
 	tlsConfig, err := config.TLS.ToGoTLSConfig()
 	if err != nil {
@@ -74,8 +517,10 @@ func runLDAPsAddr(addr string, config *ldapsConfig, store *Store) error {
 }
 
 func runLDAPListener(listener *net.TCPListener, config *ldapConfig, store *Store) (err error) {
-	server := ldap.NewServer()
-	server.BindFunc("", ldapHandler{store: store})
+	if config.RequireTLS && config.TLS == nil {
+		return errors.New("ldap: require-tls is set but StartTLS is not configured")
+	}
+	server := newLDAPServer(&config.ldapServerConfig, config.RequireTLS, store)
 	if config.TLS != nil {
 		if server.TLSConfig, err = config.TLS.ToGoTLSConfig(); err != nil {
 			return err
@@ -0,0 +1,141 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/glauth/ldap"
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// ldapPasswordModifyOID identifies the Password Modify extended operation (RFC 3062).
+const ldapPasswordModifyOID = "1.3.6.1.4.1.4203.1.11.1"
+
+const (
+	ldapPasswordModifyTagUserIdentity = 0
+	ldapPasswordModifyTagOldPassword  = 1
+	ldapPasswordModifyTagNewPassword  = 2
+)
+
+type ldapPasswordModifyRequest struct {
+	userIdentity string
+	oldPassword  string
+	newPassword  string
+}
+
+// parseLDAPPasswordModifyRequest decodes the value of a Password Modify request:
+//
+//	PasswdModifyRequestValue ::= SEQUENCE {
+//	  userIdentity    [0]  OCTET STRING OPTIONAL
+//	  oldPasswd       [1]  OCTET STRING OPTIONAL
+//	  newPasswd       [2]  OCTET STRING OPTIONAL }
+func parseLDAPPasswordModifyRequest(value []byte) (req ldapPasswordModifyRequest, err error) {
+	if len(value) == 0 {
+		return
+	}
+	packet, err := ber.DecodePacketErr(value)
+	if err != nil {
+		return req, err
+	}
+	if packet.ClassType != ber.ClassUniversal || packet.Tag != ber.TagSequence {
+		return req, errors.New("request value is not a sequence")
+	}
+	for _, child := range packet.Children {
+		if child.ClassType != ber.ClassContext {
+			return req, fmt.Errorf("unexpected element class %d", child.ClassType)
+		}
+		switch child.Tag {
+		case ldapPasswordModifyTagUserIdentity:
+			req.userIdentity = child.Data.String()
+		case ldapPasswordModifyTagOldPassword:
+			req.oldPassword = child.Data.String()
+		case ldapPasswordModifyTagNewPassword:
+			req.newPassword = child.Data.String()
+		default:
+			return req, fmt.Errorf("unexpected element tag %d", child.Tag)
+		}
+	}
+	return
+}
+
+// Extended handles the Password Modify extended operation. Users may change their own password,
+// admins may change the password of any user. Connections which are bound using an application
+// password are not allowed to change passwords.
+func (h ldapHandler) Extended(boundDN string, req ldap.ExtendedRequest, conn net.Conn) (ldap.LDAPResultCode, error) {
+	if req.RequestName != ldapPasswordModifyOID {
+		return ldap.LDAPResultProtocolError, nil
+	}
+	remote, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	binding, ok := h.bindings.Get(conn)
+	if !ok || binding.appPassword != "" {
+		return ldap.LDAPResultInsufficientAccessRights, nil
+	}
+
+	pwreq, err := parseLDAPPasswordModifyRequest([]byte(req.RequestValue))
+	if err != nil {
+		wdl.Printf("ldap: failed to parse password modify request from %s: %v", remote, err)
+		return ldap.LDAPResultProtocolError, nil
+	}
+	username := binding.username
+	if pwreq.userIdentity != "" {
+		if username, ok = h.config.bindUsername(pwreq.userIdentity); !ok {
+			return ldap.LDAPResultNoSuchObject, nil
+		}
+	}
+
+	rec := auditRecord{Frontend: "ldap", Remote: remote, Actor: binding.username, User: username, Operation: "update"}
+	if !binding.isAdmin && username != binding.username {
+		audit.Log(rec, errors.New("only admins are allowed to update any users' password"))
+		return ldap.LDAPResultInsufficientAccessRights, nil
+	}
+	if pwreq.newPassword == "" {
+		// generating passwords is not supported since the response can't carry the new password
+		return ldap.LDAPResultUnwillingToPerform, nil
+	}
+	if pwreq.oldPassword != "" {
+		ok, _, _, _, err := h.store.Authenticate(username, pwreq.oldPassword, remote)
+		audit.LogAuth(auditRecord{Frontend: "ldap", Remote: remote, User: username}, ok, err)
+		if !ok {
+			return ldap.LDAPResultInvalidCredentials, nil
+		}
+	}
+
+	err = h.store.Update(username, pwreq.newPassword)
+	audit.Log(rec, err)
+	if err != nil {
+		wl.Printf("ldap: failed to update password of '%s': %v", username, err)
+		return ldap.LDAPResultConstraintViolation, nil
+	}
+	return ldap.LDAPResultSuccess, nil
+}
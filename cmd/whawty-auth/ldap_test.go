@@ -0,0 +1,478 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/glauth/ldap"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	lib "github.com/whawty/auth/store"
+)
+
+func TestLDAPDNInScope(t *testing.T) {
+	base := normalizeLDAPDN("ou=Users, dc=example,dc=com")
+	if base != "ou=users,dc=example,dc=com" {
+		t.Fatalf("unexpected normalized DN: %s", base)
+	}
+
+	testvectors := []struct {
+		dn     string
+		baseDN string
+		scope  int
+		ok     bool
+	}{
+		{"uid=alice,ou=users,dc=example,dc=com", base, ldap.ScopeWholeSubtree, true},
+		{"uid=alice,ou=users,dc=example,dc=com", "dc=example,dc=com", ldap.ScopeWholeSubtree, true},
+		{"uid=alice,ou=users,dc=example,dc=com", base, ldap.ScopeSingleLevel, true},
+		{"uid=alice,ou=users,dc=example,dc=com", "dc=example,dc=com", ldap.ScopeSingleLevel, false},
+		{"uid=alice,ou=users,dc=example,dc=com", base, ldap.ScopeBaseObject, false},
+		{"uid=alice,ou=users,dc=example,dc=com", "uid=alice,ou=users,dc=example,dc=com", ldap.ScopeBaseObject, true},
+		{"uid=alice,ou=users,dc=example,dc=com", "uid=bob,ou=users,dc=example,dc=com", ldap.ScopeWholeSubtree, false},
+		{"uid=alice,ou=users,dc=example,dc=com", "rs,dc=example,dc=com", ldap.ScopeWholeSubtree, false},
+	}
+	for _, vector := range testvectors {
+		if ok := ldapDNInScope(vector.dn, vector.baseDN, vector.scope); ok != vector.ok {
+			t.Errorf("'%s' in scope %d of '%s': expected %t, got %t", vector.dn, vector.scope, vector.baseDN, vector.ok, ok)
+		}
+	}
+}
+
+func TestLDAPSelectAttributes(t *testing.T) {
+	h := ldapHandler{config: &ldapServerConfig{Search: &ldapSearchConfig{BaseDN: "ou=users,dc=example,dc=com", MailDomain: "example.com"}}}
+	entry := h.userEntry("alice", lib.User{IsAdmin: true})
+	if entry.DN != "uid=alice,ou=users,dc=example,dc=com" {
+		t.Fatalf("unexpected DN: %s", entry.DN)
+	}
+
+	if selected := selectLDAPAttributes(entry, nil); len(selected.Attributes) != len(entry.Attributes) {
+		t.Errorf("all attributes should be returned if none were requested")
+	}
+	if selected := selectLDAPAttributes(entry, []string{"*"}); len(selected.Attributes) != len(entry.Attributes) {
+		t.Errorf("all attributes should be returned for '*'")
+	}
+	selected := selectLDAPAttributes(entry, []string{"MAIL", "description", "unknown"})
+	if len(selected.Attributes) != 2 {
+		t.Fatalf("expected 2 attributes, got %d", len(selected.Attributes))
+	}
+	if selected.Attributes[0].Name != "description" || selected.Attributes[0].Values[0] != "admin" {
+		t.Errorf("unexpected description: %v", selected.Attributes[0])
+	}
+	if selected.Attributes[1].Name != "mail" || selected.Attributes[1].Values[0] != "alice@example.com" {
+		t.Errorf("unexpected mail: %v", selected.Attributes[1])
+	}
+}
+
+func TestLDAPBindUsername(t *testing.T) {
+	c := &ldapServerConfig{
+		Bind:   ldapBindConfig{Domains: []string{"example.com"}},
+		Search: &ldapSearchConfig{BaseDN: "ou=people,dc=example,dc=org"},
+	}
+
+	testvectors := []struct {
+		bindDN   string
+		username string
+		ok       bool
+	}{
+		{"alice", "alice", true},
+		{"", "", false},
+		{"alice@example.com", "alice", true},
+		{"alice@EXAMPLE.com", "alice", true},
+		{"alice@example.org", "", false},
+		{"@example.com", "", false},
+		{"uid=alice,ou=people,dc=example,dc=org", "alice", true},
+		{"UID=alice, OU=People, DC=example, DC=org", "alice", true},
+		{"cn=alice,ou=people,dc=example,dc=org", "", false},
+		{"uid=alice,ou=other,dc=example,dc=org", "", false},
+		{"uid=alice,dc=example,dc=org", "", false},
+		{"uid=,ou=people,dc=example,dc=org", "", false},
+		{"uid=alice@example.com,ou=people,dc=example,dc=org", "alice@example.com", true},
+		{"uid=al\\69ce,ou=people,dc=example,dc=org", "alice", true},
+		{"uid=al\\,ice,ou=people,dc=example,dc=org", "", false},
+		{"uid=alice\\,ou=people,ou=people,dc=example,dc=org", "", false},
+		{"uid=alice+cn=bob,ou=people,dc=example,dc=org", "", false},
+		{"uid=#616c696365,ou=people,dc=example,dc=org", "", false},
+		{"uid=alice\\,ou=people,dc=example,dc=org", "", false},
+	}
+	for _, vector := range testvectors {
+		username, ok := c.bindUsername(vector.bindDN)
+		if ok != vector.ok || username != vector.username {
+			t.Errorf("bind DN '%s': expected ('%s', %t), got ('%s', %t)", vector.bindDN, vector.username, vector.ok, username, ok)
+		}
+	}
+
+	c = &ldapServerConfig{Bind: ldapBindConfig{Attribute: "CN", BaseDN: "dc=example,dc=org"}}
+	if username, ok := c.bindUsername("cn=bob,dc=example,dc=org"); !ok || username != "bob" {
+		t.Errorf("bind DN using the configured attribute was rejected")
+	}
+	if _, ok := c.bindUsername("bob@example.com"); ok {
+		t.Errorf("bind DN with a domain was accepted although no domains are allowed")
+	}
+	if _, ok := (&ldapServerConfig{}).bindUsername("uid=bob,dc=example,dc=org"); ok {
+		t.Errorf("bind DN was accepted although no base DN is configured")
+	}
+}
+
+func TestLDAPDNEscaping(t *testing.T) {
+	testvectors := []struct {
+		value   string
+		escaped string
+	}{
+		{"alice", "alice"},
+		{"alice@example.com", "alice@example.com"},
+		{"a,b+c", "a\\,b\\+c"},
+		{"\"a;b\"", "\\\"a\\;b\\\""},
+		{"<a\\b>", "\\<a\\\\b\\>"},
+		{" #a ", "\\ #a\\ "},
+		{"#a", "\\#a"},
+	}
+	for _, vector := range testvectors {
+		escaped := escapeLDAPDNValue(vector.value)
+		if escaped != vector.escaped {
+			t.Errorf("escaping '%s': expected '%s', got '%s'", vector.value, vector.escaped, escaped)
+		}
+		attr, value, parent, ok := parseLDAPRDN("uid=" + escaped + ",dc=example,dc=org")
+		if !ok || attr != "uid" || value != vector.value || parent != "dc=example,dc=org" {
+			t.Errorf("parsing escaped '%s' returned ('%s', '%s', '%s', %t)", vector.value, attr, value, parent, ok)
+		}
+	}
+}
+
+func TestParseLDAPPasswordModifyRequest(t *testing.T) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Password Modify Request")
+	packet.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, ldapPasswordModifyTagUserIdentity, "uid=alice,dc=example,dc=org", "User Identity"))
+	packet.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, ldapPasswordModifyTagOldPassword, "old secret", "Old Password"))
+	packet.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, ldapPasswordModifyTagNewPassword, "new secret", "New Password"))
+
+	req, err := parseLDAPPasswordModifyRequest(packet.Bytes())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if req.userIdentity != "uid=alice,dc=example,dc=org" || req.oldPassword != "old secret" || req.newPassword != "new secret" {
+		t.Errorf("unexpected request: %+v", req)
+	}
+
+	if req, err = parseLDAPPasswordModifyRequest(nil); err != nil || req != (ldapPasswordModifyRequest{}) {
+		t.Errorf("empty request value should be accepted, got %+v, %v", req, err)
+	}
+
+	invalid := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Password Modify Request")
+	invalid.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 5, "foo", "Unknown"))
+	for _, value := range [][]byte{invalid.Bytes(), ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "foo", "").Bytes(), {0x30, 0x05}} {
+		if _, err := parseLDAPPasswordModifyRequest(value); err == nil {
+			t.Errorf("invalid request value %x was accepted", value)
+		}
+	}
+}
+
+func TestLDAPDirectoryEntries(t *testing.T) {
+	h := ldapHandler{config: &ldapServerConfig{Search: &ldapSearchConfig{BaseDN: "ou=users,dc=example,dc=com", GroupBaseDN: "ou=groups,dc=example,dc=com"}}}
+	users := lib.UserList{
+		"alice": lib.User{IsAdmin: true},
+		"bob":   lib.User{Roles: []string{"staff", "admins"}},
+		"carol": lib.User{Roles: []string{"staff"}},
+	}
+
+	attribute := func(entry *ldap.Entry, name string) []string {
+		for _, attr := range entry.Attributes {
+			if attr.Name == name {
+				return attr.Values
+			}
+		}
+		return nil
+	}
+
+	entries := h.directoryEntries(users)
+	expected := []struct {
+		dn      string
+		members []string
+	}{
+		{"uid=alice,ou=users,dc=example,dc=com", []string{"cn=users,ou=groups,dc=example,dc=com", "cn=admins,ou=groups,dc=example,dc=com"}},
+		{"uid=bob,ou=users,dc=example,dc=com", []string{"cn=users,ou=groups,dc=example,dc=com", "cn=staff,ou=groups,dc=example,dc=com"}},
+		{"uid=carol,ou=users,dc=example,dc=com", []string{"cn=users,ou=groups,dc=example,dc=com", "cn=staff,ou=groups,dc=example,dc=com"}},
+		{"cn=admins,ou=groups,dc=example,dc=com", []string{"uid=alice,ou=users,dc=example,dc=com"}},
+		{"cn=staff,ou=groups,dc=example,dc=com", []string{"uid=bob,ou=users,dc=example,dc=com", "uid=carol,ou=users,dc=example,dc=com"}},
+		{"cn=users,ou=groups,dc=example,dc=com", []string{"uid=alice,ou=users,dc=example,dc=com", "uid=bob,ou=users,dc=example,dc=com", "uid=carol,ou=users,dc=example,dc=com"}},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %d", len(expected), len(entries))
+	}
+	for i, e := range expected {
+		if entries[i].DN != e.dn {
+			t.Errorf("entry %d: expected DN '%s', got '%s'", i, e.dn, entries[i].DN)
+			continue
+		}
+		name := "member"
+		if i < len(users) {
+			name = "memberOf"
+		}
+		if members := attribute(entries[i], name); !reflect.DeepEqual(members, e.members) {
+			t.Errorf("entry '%s': expected %s %v, got %v", e.dn, name, e.members, members)
+		}
+	}
+}
+
+func TestLDAPDirectoryEntriesEmptyGroups(t *testing.T) {
+	h := ldapHandler{config: &ldapServerConfig{Search: &ldapSearchConfig{BaseDN: "ou=users,dc=example,dc=com", GroupBaseDN: "ou=groups,dc=example,dc=com"}}}
+
+	entries := h.directoryEntries(lib.UserList{"bob": lib.User{}})
+	var dns []string
+	for _, entry := range entries {
+		dns = append(dns, entry.DN)
+	}
+	expected := []string{"uid=bob,ou=users,dc=example,dc=com", "cn=users,ou=groups,dc=example,dc=com"}
+	if !reflect.DeepEqual(dns, expected) {
+		t.Fatalf("groups without members must not be published, expected %v, got %v", expected, dns)
+	}
+	if entries := h.directoryEntries(lib.UserList{}); len(entries) != 0 {
+		t.Fatalf("empty store should not publish any entries, got %d", len(entries))
+	}
+}
+
+func TestLDAPBindRequireTLS(t *testing.T) {
+	h := ldapHandler{config: &ldapServerConfig{}, requireTLS: true, bindings: &ldapBindings{conns: make(map[net.Conn]ldapBinding)}}
+	client, server := net.Pipe()
+	defer client.Close() //nolint:errcheck
+	defer server.Close() //nolint:errcheck
+
+	if code, err := h.Bind("alice", "secret", server); err != nil || code != ldap.LDAPResultConfidentialityRequired {
+		t.Fatalf("bind without TLS should be refused, got %v, %v", code, err)
+	}
+}
+
+func TestLDAPBindService(t *testing.T) {
+	h := newLDAPTestHandler(t, nil)
+	h.config.Service = "ldap"
+	client, server := net.Pipe()
+	defer client.Close() //nolint:errcheck
+	defer server.Close() //nolint:errcheck
+
+	testvectors := []struct {
+		services []string
+		password string
+		code     ldap.LDAPResultCode
+	}{
+		{nil, "alice-secret", ldap.LDAPResultSuccess},
+		{[]string{"imap"}, "wrong-secret", ldap.LDAPResultInvalidCredentials},
+		// must not be distinguishable from a wrong password
+		{[]string{"imap"}, "alice-secret", ldap.LDAPResultInvalidCredentials},
+		{[]string{"ldap"}, "alice-secret", ldap.LDAPResultSuccess},
+		{[]string{"*"}, "alice-secret", ldap.LDAPResultSuccess},
+	}
+	for _, vector := range testvectors {
+		if err := h.store.SetServices("alice", vector.services); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if code, err := h.Bind("alice", vector.password, server); err != nil || code != vector.code {
+			t.Errorf("services %v: expected %v, got %v, %v", vector.services, vector.code, code, err)
+		}
+	}
+}
+
+func newLDAPTestHandler(t *testing.T, search *ldapSearchConfig) ldapHandler {
+	store := newTestStore(t, policyConfig{}, "")
+	if err := store.Add("alice", "alice-secret", false); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := store.SetRoles("alice", []string{"staff"}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	server := &ldapServerConfig{Search: search}
+	return ldapHandler{store: store, config: server, bindings: &ldapBindings{conns: make(map[net.Conn]ldapBinding)}, directory: &ldapDirectory{ttl: ldapDefaultCacheTTL}}
+}
+
+// ldapTestConn returns a connection which is bound as username.
+func ldapTestConn(t *testing.T, h ldapHandler, username string) net.Conn {
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close() //nolint:errcheck
+		server.Close() //nolint:errcheck
+	})
+	if username != "" {
+		h.bindings.Set(server, ldapBinding{username: username})
+	}
+	return server
+}
+
+func ldapTestDNs(result ldap.ServerSearchResult) (dns []string) {
+	for _, entry := range result.Entries {
+		dns = append(dns, entry.DN)
+	}
+	return
+}
+
+func TestLDAPSearch(t *testing.T) {
+	h := newLDAPTestHandler(t, &ldapSearchConfig{BaseDN: "ou=users,dc=example,dc=com", GroupBaseDN: "ou=groups,dc=example,dc=com"})
+	const bound = "uid=alice,ou=users,dc=example,dc=com"
+	conn := ldapTestConn(t, h, "alice")
+
+	testvectors := []struct {
+		conn net.Conn
+		req  ldap.SearchRequest
+		code ldap.LDAPResultCode
+		dns  []string
+	}{
+		{ldapTestConn(t, h, ""), ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree, Filter: "(objectClass=*)"},
+			ldap.LDAPResultInsufficientAccessRights, nil},
+		{conn, ldap.SearchRequest{BaseDN: "dc=example,dc=org", Scope: ldap.ScopeWholeSubtree, Filter: "(objectClass=*)"},
+			ldap.LDAPResultNoSuchObject, nil},
+		{conn, ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree, Filter: "(uid=alice"},
+			ldap.LDAPResultProtocolError, nil},
+		{conn, ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree, Filter: "(objectClass=*)"},
+			ldap.LDAPResultSuccess, []string{
+				"uid=admin,ou=users,dc=example,dc=com", "uid=alice,ou=users,dc=example,dc=com",
+				"cn=admins,ou=groups,dc=example,dc=com", "cn=staff,ou=groups,dc=example,dc=com", "cn=users,ou=groups,dc=example,dc=com"}},
+		{conn, ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeSingleLevel, Filter: "(objectClass=*)"},
+			ldap.LDAPResultSuccess, nil},
+		{conn, ldap.SearchRequest{BaseDN: "OU=Users, dc=example,dc=com", Scope: ldap.ScopeSingleLevel, Filter: "(objectClass=*)"},
+			ldap.LDAPResultSuccess, []string{"uid=admin,ou=users,dc=example,dc=com", "uid=alice,ou=users,dc=example,dc=com"}},
+		{conn, ldap.SearchRequest{BaseDN: "uid=alice,ou=users,dc=example,dc=com", Scope: ldap.ScopeBaseObject, Filter: "(objectClass=*)"},
+			ldap.LDAPResultSuccess, []string{"uid=alice,ou=users,dc=example,dc=com"}},
+		{conn, ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree, Filter: "(uid=alice)"},
+			ldap.LDAPResultSuccess, []string{"uid=alice,ou=users,dc=example,dc=com"}},
+		{conn, ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree, Filter: "(&(objectClass=inetOrgPerson)(memberOf=cn=admins,ou=groups,dc=example,dc=com))"},
+			ldap.LDAPResultSuccess, []string{"uid=admin,ou=users,dc=example,dc=com"}},
+		{conn, ldap.SearchRequest{BaseDN: "ou=groups,dc=example,dc=com", Scope: ldap.ScopeWholeSubtree, Filter: "(member=uid=alice,ou=users,dc=example,dc=com)"},
+			ldap.LDAPResultSuccess, []string{"cn=staff,ou=groups,dc=example,dc=com", "cn=users,ou=groups,dc=example,dc=com"}},
+		{conn, ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree, Filter: "(uid=bob)"},
+			ldap.LDAPResultSuccess, nil},
+		{conn, ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree, Filter: "(objectClass=inetOrgPerson)", SizeLimit: 1},
+			ldap.LDAPResultSizeLimitExceeded, []string{"uid=admin,ou=users,dc=example,dc=com"}},
+		{conn, ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree, Filter: "(objectClass=inetOrgPerson)", SizeLimit: 2},
+			ldap.LDAPResultSuccess, []string{"uid=admin,ou=users,dc=example,dc=com", "uid=alice,ou=users,dc=example,dc=com"}},
+	}
+	for _, vector := range testvectors {
+		result, err := h.Search(bound, vector.req, vector.conn)
+		if result.ResultCode != vector.code {
+			t.Errorf("%s %s (scope %d): expected result code %d, got %d (%v)", vector.req.BaseDN, vector.req.Filter, vector.req.Scope, vector.code, result.ResultCode, err)
+			continue
+		}
+		if dns := ldapTestDNs(result); !reflect.DeepEqual(dns, vector.dns) {
+			t.Errorf("%s %s (scope %d): expected %v, got %v", vector.req.BaseDN, vector.req.Filter, vector.req.Scope, vector.dns, dns)
+		}
+	}
+
+	result, err := h.Search(bound, ldap.SearchRequest{BaseDN: bound, Scope: ldap.ScopeBaseObject, Filter: "(objectClass=*)", Attributes: []string{"cn", "description"}}, conn)
+	if err != nil || len(result.Entries) != 1 {
+		t.Fatalf("searching for '%s' failed: %v", bound, err)
+	}
+	if attrs := result.Entries[0].Attributes; len(attrs) != 2 || attrs[0].Name != "cn" || attrs[1].Name != "description" {
+		t.Fatalf("only the requested attributes should be returned, got %+v", attrs)
+	}
+}
+
+func TestLDAPSearchAfterFailedBind(t *testing.T) {
+	h := newLDAPTestHandler(t, &ldapSearchConfig{BaseDN: "ou=users,dc=example,dc=com"})
+	h.config.Service = "ldap"
+	req := ldap.SearchRequest{BaseDN: "ou=users,dc=example,dc=com", Scope: ldap.ScopeWholeSubtree, Filter: "(objectClass=*)"}
+	conn := ldapTestConn(t, h, "")
+
+	if code, err := h.Bind("alice", "alice-secret", conn); err != nil || code != ldap.LDAPResultSuccess {
+		t.Fatalf("bind failed: %v, %v", code, err)
+	}
+	if result, _ := h.Search("alice", req, conn); result.ResultCode != ldap.LDAPResultSuccess {
+		t.Fatalf("search after successful bind failed: %d", result.ResultCode)
+	}
+
+	// the server keeps the DN of the last successful bind, it must not be used for searches
+	if code, _ := h.Bind("alice", "wrong-secret", conn); code != ldap.LDAPResultInvalidCredentials {
+		t.Fatalf("bind using a wrong password should fail, got %v", code)
+	}
+	if result, _ := h.Search("alice", req, conn); result.ResultCode != ldap.LDAPResultInsufficientAccessRights {
+		t.Fatalf("search after failed bind should be refused, got %d", result.ResultCode)
+	}
+
+	if err := h.store.SetServices("alice", []string{"imap"}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	h.Bind("alice", "alice-secret", conn) //nolint:errcheck
+	if result, _ := h.Search("alice", req, conn); result.ResultCode != ldap.LDAPResultInsufficientAccessRights {
+		t.Fatalf("search after bind for a service which is not allowed should be refused, got %d", result.ResultCode)
+	}
+}
+
+func TestLDAPSearchDisabled(t *testing.T) {
+	h := newLDAPTestHandler(t, nil)
+	result, _ := h.Search("uid=alice,ou=users,dc=example,dc=com", ldap.SearchRequest{BaseDN: "dc=example,dc=com", Filter: "(objectClass=*)"}, ldapTestConn(t, h, "alice"))
+	if result.ResultCode != ldap.LDAPResultUnwillingToPerform {
+		t.Fatalf("search should be refused if it is not configured, got %d", result.ResultCode)
+	}
+}
+
+func TestLDAPSearchCache(t *testing.T) {
+	h := newLDAPTestHandler(t, &ldapSearchConfig{BaseDN: "ou=users,dc=example,dc=com"})
+	req := ldap.SearchRequest{BaseDN: "ou=users,dc=example,dc=com", Scope: ldap.ScopeWholeSubtree, Filter: "(uid=bob)"}
+	conn := ldapTestConn(t, h, "alice")
+	if result, _ := h.Search("alice", req, conn); len(result.Entries) != 0 {
+		t.Fatal("user 'bob' should not exist yet")
+	}
+	if err := h.store.Add("bob", "bob-secret", false); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if result, _ := h.Search("alice", req, conn); len(result.Entries) != 0 {
+		t.Fatal("search should use the cached entries")
+	}
+
+	h.directory.expires = time.Now()
+	if result, _ := h.Search("alice", req, conn); len(result.Entries) != 1 {
+		t.Fatal("new user should show up once the cache has expired")
+	}
+}
+
+func TestLDAPConfigValidate(t *testing.T) {
+	testvectors := []struct {
+		config string
+		valid  bool
+	}{
+		{"ldap:\n  listen: [':389']\n", true},
+		{"ldap:\n  search:\n    base-dn: 'ou=users,dc=example,dc=com'\n    cache-ttl: 1m\n", true},
+		{"ldap:\n  search:\n    mail-domain: example.com\n", false},
+		{"ldaps:\n  search:\n    base-dn: ' '\n", false},
+		{"ldap:\n  bind:\n    attribute: cn\n  search:\n    base-dn: 'ou=users,dc=example,dc=com'\n", false},
+		{"ldap:\n  bind:\n    attribute: CN\n  search:\n    base-dn: 'ou=users,dc=example,dc=com'\n    group-base-dn: 'OU=Users, dc=example,dc=com'\n", false},
+		{"ldap:\n  bind:\n    attribute: cn\n  search:\n    base-dn: 'ou=users,dc=example,dc=com'\n    group-base-dn: 'ou=groups,dc=example,dc=com'\n", true},
+		{"ldap:\n  search:\n    base-dn: 'ou=users,dc=example,dc=com'\n", true},
+	}
+	for _, vector := range testvectors {
+		configfile := filepath.Join(t.TempDir(), "listener.yml")
+		if err := os.WriteFile(configfile, []byte(vector.config), 0600); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if _, err := readListenerConfig(configfile); (err == nil) != vector.valid {
+			t.Errorf("config %q: expected valid=%t, got %v", vector.config, vector.valid, err)
+		}
+	}
+}
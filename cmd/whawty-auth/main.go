@@ -31,20 +31,26 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/coreos/go-systemd/activation"
 	"github.com/gosuri/uitable"
 	"github.com/howeyc/gopass"
 	"github.com/urfave/cli"
+	lib "github.com/whawty/auth/store"
 )
 
 var (
@@ -79,6 +85,54 @@ func askPass() (string, error) {
 	}
 }
 
+func throttleConfigFromContext(c *cli.Context) throttleConfig {
+	return throttleConfig{
+		User: lib.ThrottleConfig{
+			Attempts:        c.GlobalUint("throttle-attempts"),
+			Backoff:         c.GlobalDuration("throttle-backoff"),
+			MaxBackoff:      c.GlobalDuration("throttle-max-backoff"),
+			LockoutAttempts: c.GlobalUint("throttle-lockout-attempts"),
+			Lockout:         c.GlobalDuration("throttle-lockout"),
+			Expire:          c.GlobalDuration("throttle-expire"),
+			MaxEntries:      c.GlobalInt("throttle-max-entries"),
+		},
+		Addr: lib.ThrottleConfig{
+			Attempts:   c.GlobalUint("throttle-addr-attempts"),
+			Backoff:    c.GlobalDuration("throttle-backoff"),
+			MaxBackoff: c.GlobalDuration("throttle-addr-max-backoff"),
+			Expire:     c.GlobalDuration("throttle-expire"),
+			MaxEntries: c.GlobalInt("throttle-max-entries"),
+		},
+		Exempt: throttleExemptFromContext(c),
+	}
+}
+
+func throttleExemptFromContext(c *cli.Context) (exempt []string) {
+	for _, entry := range strings.Split(c.GlobalString("throttle-exempt"), ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			exempt = append(exempt, entry)
+		}
+	}
+	return
+}
+
+func readinessConfigFromContext(c *cli.Context) readinessConfig {
+	return readinessConfig{
+		Timeout:       c.GlobalDuration("ready-timeout"),
+		CheckInterval: c.GlobalDuration("ready-check-interval"),
+	}
+}
+
+func policyConfigFromContext(c *cli.Context) policyConfig {
+	return policyConfig{
+		Type:           c.GlobalString("policy-type"),
+		Condition:      c.GlobalString("policy-condition"),
+		AdminType:      c.GlobalString("admin-policy-type"),
+		AdminCondition: c.GlobalString("admin-policy-condition"),
+		UserPolicies:   c.GlobalString("user-policies"),
+	}
+}
+
 func cmdInit(c *cli.Context) error {
 	username := c.Args().First()
 	if username == "" {
@@ -99,11 +153,14 @@ func cmdInit(c *cli.Context) error {
 	}
 
 	s, err := NewStore(c.GlobalString("store"), c.GlobalString("do-upgrades"),
-		c.GlobalString("policy-type"), c.GlobalString("policy-condition"), c.GlobalString("hooks-dir"))
+		policyConfigFromContext(c), c.GlobalString("services"), c.GlobalString("hooks-dir"),
+		throttleConfigFromContext(c), readinessConfigFromContext(c), c.GlobalDuration("reset-token-validity"))
 	if err != nil {
 		return cli.NewExitError(fmt.Sprintf("Error initializing whawty store: %s", err), 3)
 	}
-	if err := s.GetInterface().Init(username, password); err != nil {
+	err = s.GetInterface().Init(username, password)
+	audit.Log(cliAuditRecord(username, "init"), err)
+	if err != nil {
 		return cli.NewExitError(fmt.Sprintf("Error initializing whawty store: %s", err), 3)
 	}
 	return cli.NewExitError("whawty store successfully initialized!", 0)
@@ -111,7 +168,8 @@ func cmdInit(c *cli.Context) error {
 
 func cmdCheck(c *cli.Context) error {
 	s, err := NewStore(c.GlobalString("store"), c.GlobalString("do-upgrades"),
-		c.GlobalString("policy-type"), c.GlobalString("policy-condition"), c.GlobalString("hooks-dir"))
+		policyConfigFromContext(c), c.GlobalString("services"), c.GlobalString("hooks-dir"),
+		throttleConfigFromContext(c), readinessConfigFromContext(c), c.GlobalDuration("reset-token-validity"))
 	if err != nil {
 		return cli.NewExitError(fmt.Sprintf("Error opening whawty store: %s", err), 3)
 	}
@@ -124,7 +182,8 @@ func cmdCheck(c *cli.Context) error {
 
 func openAndCheck(c *cli.Context) (*store, error) {
 	s, err := NewStore(c.GlobalString("store"), c.GlobalString("do-upgrades"),
-		c.GlobalString("policy-type"), c.GlobalString("policy-condition"), c.GlobalString("hooks-dir"))
+		policyConfigFromContext(c), c.GlobalString("services"), c.GlobalString("hooks-dir"),
+		throttleConfigFromContext(c), readinessConfigFromContext(c), c.GlobalDuration("reset-token-validity"))
 	if err != nil {
 		return nil, fmt.Errorf("opening whawty store failed: %s", err)
 	}
@@ -163,7 +222,9 @@ func cmdAdd(c *cli.Context) error {
 		password = pwd
 	}
 
-	if err := s.GetInterface().Add(username, password, false); err != nil {
+	err = s.GetInterface().Add(username, password, false)
+	audit.Log(cliAuditRecord(username, "add"), err)
+	if err != nil {
 		return cli.NewExitError(fmt.Sprintf("Error adding user '%s': %s", username, err), 3)
 	}
 	return cli.NewExitError(fmt.Sprintf("user '%s' successfully added!", username), 0)
@@ -181,7 +242,9 @@ func cmdRemove(c *cli.Context) error {
 		return cli.NewExitError("", 0)
 	}
 
-	if err := s.GetInterface().Remove(username); err != nil {
+	err = s.GetInterface().Remove(username)
+	audit.Log(cliAuditRecord(username, "remove"), err)
+	if err != nil {
 		return cli.NewExitError(fmt.Sprintf("Error removing user '%s': %s", username, err), 3)
 	}
 	return cli.NewExitError(fmt.Sprintf("user '%s' successfully removed!", username), 0)
@@ -211,7 +274,9 @@ func cmdUpdate(c *cli.Context) error {
 		password = pwd
 	}
 
-	if err := s.GetInterface().Update(username, password); err != nil {
+	err = s.GetInterface().Update(username, password)
+	audit.Log(cliAuditRecord(username, "update"), err)
+	if err != nil {
 		return cli.NewExitError(fmt.Sprintf("Error updating user '%s': %s", username, err), 3)
 	}
 	return cli.NewExitError(fmt.Sprintf("user '%s' successfully updated!", username), 0)
@@ -235,7 +300,11 @@ func cmdSetAdmin(c *cli.Context) error {
 		return cli.NewExitError("", 0)
 	}
 
-	if err := s.GetInterface().SetAdmin(username, isAdmin); err != nil {
+	rec := cliAuditRecord(username, "set-admin")
+	rec.Detail = fmt.Sprintf("admin=%t", isAdmin)
+	err = s.GetInterface().SetAdmin(username, isAdmin)
+	audit.Log(rec, err)
+	if err != nil {
 		return cli.NewExitError(fmt.Sprintf("Error changing admin status of user '%s': %s", username, err), 3)
 	}
 
@@ -246,6 +315,129 @@ func cmdSetAdmin(c *cli.Context) error {
 	}
 }
 
+func cmdSetRoles(c *cli.Context) error {
+	s, err := openAndCheck(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 3)
+	}
+
+	username := c.Args().First()
+	if username == "" {
+		cli.ShowCommandHelp(c, "set-roles") //nolint:errcheck
+		return cli.NewExitError("", 0)
+	}
+	roles := c.Args().Tail()
+
+	rec := cliAuditRecord(username, "set-roles")
+	rec.Detail = "roles=" + strings.Join(roles, ",")
+	err = s.GetInterface().SetRoles(username, roles)
+	audit.Log(rec, err)
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("Error changing roles of user '%s': %s", username, err), 3)
+	}
+
+	if len(roles) == 0 {
+		return cli.NewExitError(fmt.Sprintf("user '%s' has no roles anymore!", username), 0)
+	}
+	return cli.NewExitError(fmt.Sprintf("user '%s' now has the roles: %s", username, strings.Join(roles, ", ")), 0)
+}
+
+func cmdSetServices(c *cli.Context) error {
+	s, err := openAndCheck(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 3)
+	}
+
+	username := c.Args().First()
+	if username == "" {
+		cli.ShowCommandHelp(c, "set-services") //nolint:errcheck
+		return cli.NewExitError("", 0)
+	}
+	services := c.Args().Tail()
+
+	rec := cliAuditRecord(username, "set-services")
+	rec.Detail = "services=" + strings.Join(services, ",")
+	err = s.GetInterface().SetServices(username, services)
+	audit.Log(rec, err)
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("Error changing services of user '%s': %s", username, err), 3)
+	}
+
+	if len(services) == 0 {
+		return cli.NewExitError(fmt.Sprintf("user '%s' now uses the default service rules!", username), 0)
+	}
+	return cli.NewExitError(fmt.Sprintf("user '%s' may now authenticate for: %s", username, strings.Join(services, ", ")), 0)
+}
+
+func cmdResetToken(c *cli.Context) error {
+	s, err := openAndCheck(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 3)
+	}
+
+	username := c.Args().First()
+	if username == "" {
+		cli.ShowCommandHelp(c, "reset-token") //nolint:errcheck
+		return cli.NewExitError("", 0)
+	}
+
+	validFor := c.Duration("valid-for")
+	if validFor == 0 {
+		validFor = c.GlobalDuration("reset-token-validity")
+	}
+	if validFor <= 0 {
+		return cli.NewExitError("the validity of the reset token must be positive", 1)
+	}
+
+	rec := cliAuditRecord(username, "create-reset-token")
+	rec.Detail = fmt.Sprintf("valid-for=%v", validFor)
+	token, expires, err := s.GetInterface().CreateResetToken(username, validFor)
+	audit.Log(rec, err)
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("Error creating reset token for user '%s': %s", username, err), 3)
+	}
+	fmt.Printf("reset token for user '%s' (valid until %s):\n%s\n", username, expires.Format(time.RFC3339), token)
+	return nil
+}
+
+func cmdPwnedIndex(c *cli.Context) error {
+	if c.NArg() != 2 {
+		cli.ShowCommandHelp(c, "pwned-index") //nolint:errcheck
+		return cli.NewExitError("", 0)
+	}
+
+	hashType, err := parsePwnedHashType(c.String("hash"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	dump, err := os.Open(c.Args().Get(0))
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("Error opening dump: %s", err), 3)
+	}
+	defer dump.Close() //nolint:errcheck
+
+	indexfile := c.Args().Get(1)
+	tmp, err := os.CreateTemp(filepath.Dir(indexfile), ".pwned-index-")
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("Error creating index: %s", err), 3)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+	defer tmp.Close()           //nolint:errcheck
+
+	n, err := buildPwnedIndex(dump, tmp, hashType, c.Uint64("min-count"))
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("Error building index: %s", err), 3)
+	}
+	if err := tmp.Close(); err != nil {
+		return cli.NewExitError(fmt.Sprintf("Error writing index: %s", err), 3)
+	}
+	if err := os.Rename(tmp.Name(), indexfile); err != nil {
+		return cli.NewExitError(fmt.Sprintf("Error writing index: %s", err), 3)
+	}
+	return cli.NewExitError(fmt.Sprintf("successfully wrote %d hashes to '%s'", n, indexfile), 0)
+}
+
 func cmdListFull(s *Store) error {
 	lst, err := s.ListFull()
 	if err != nil {
@@ -260,13 +452,13 @@ func cmdListFull(s *Store) error {
 
 	table := uitable.New()
 	table.MaxColWidth = 80
-	table.AddRow("NAME", "TYPE", "LAST-CHANGED", "VALID", "SUPPORTED", "FORMAT", "PARAMETER-SET")
+	table.AddRow("NAME", "TYPE", "LAST-CHANGED", "VALID", "SUPPORTED", "FORMAT", "PARAMETER-SET", "MUST-CHANGE", "ROLES", "SERVICES")
 	for _, k := range keys {
 		t := "user"
 		if lst[k].IsAdmin {
 			t = "admin"
 		}
-		table.AddRow(k, t, lst[k].LastChanged.String(), lst[k].IsValid, lst[k].IsSupported, lst[k].FormatID, lst[k].ParamID)
+		table.AddRow(k, t, lst[k].LastChanged.String(), lst[k].IsValid, lst[k].IsSupported, lst[k].FormatID, lst[k].ParamID, lst[k].MustChange, strings.Join(lst[k].Roles, ","), strings.Join(lst[k].Services, ","))
 	}
 	fmt.Println(table)
 	return nil
@@ -286,13 +478,13 @@ func cmdListSupported(s *Store) error {
 
 	table := uitable.New()
 	table.MaxColWidth = 50
-	table.AddRow("NAME", "TYPE", "LAST-CHANGED")
+	table.AddRow("NAME", "TYPE", "LAST-CHANGED", "ROLES", "SERVICES")
 	for _, k := range keys {
 		t := "user"
 		if lst[k].IsAdmin {
 			t = "admin"
 		}
-		table.AddRow(k, t, lst[k].LastChanged.String())
+		table.AddRow(k, t, lst[k].LastChanged.String(), strings.Join(lst[k].Roles, ","), strings.Join(lst[k].Services, ","))
 	}
 	fmt.Println(table)
 	return nil
@@ -340,7 +532,8 @@ func cmdAuthenticate(c *cli.Context) error {
 		password = string(pwd)
 	}
 
-	ok, isAdmin, _, err := s.GetInterface().Authenticate(username, password)
+	ok, isAdmin, mustChange, _, err := s.GetInterface().Authenticate(username, password, "")
+	audit.LogAuth(cliAuditRecord(username, ""), ok, err)
 	if err != nil {
 		return cli.NewExitError(fmt.Sprintf("Error authenticating user '%s': %s", username, err), 3)
 	}
@@ -352,6 +545,9 @@ func cmdAuthenticate(c *cli.Context) error {
 	// TODO: find a better way to handle this situation
 	time.Sleep(100 * time.Millisecond)
 
+	if mustChange {
+		fmt.Printf("user '%s' must change the password!\n", username)
+	}
 	if isAdmin {
 		return cli.NewExitError(fmt.Sprintf("user '%s' is an admin.", username), 0)
 	} else {
@@ -359,6 +555,23 @@ func cmdAuthenticate(c *cli.Context) error {
 	}
 }
 
+// waitForListeners waits until all listeners have closed. On SIGINT or SIGTERM it only
+// waits for the saslauthd listeners which finish all in-flight authentications.
+func waitForListeners(ctx context.Context, all, sasl *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		all.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return cli.NewExitError("shutting down since all auth sockets have closed.", 0)
+	case <-ctx.Done():
+	}
+	sasl.Wait()
+	return cli.NewExitError("shutting down since a signal was received.", 0)
+}
+
 func cmdRun(c *cli.Context) error {
 	s, err := openAndCheck(c)
 	if err != nil {
@@ -370,14 +583,33 @@ func cmdRun(c *cli.Context) error {
 		return cli.NewExitError(err.Error(), 1)
 	}
 
-	var wg sync.WaitGroup
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var wg, saslWG sync.WaitGroup
 	if lc.SASLAuthd != nil {
 		for _, path := range lc.SASLAuthd.Listen {
 			p := path
 			wg.Add(1)
+			saslWG.Add(1)
 			go func() {
 				defer wg.Done()
-				if err := runSaslAuthSocket(p, s.GetInterface()); err != nil {
+				defer saslWG.Done()
+				if err := runSaslAuthSocket(ctx, p, lc.SASLAuthd, s.GetInterface()); err != nil {
+					fmt.Printf("warning running auth-socket failed: %s\n", err)
+				}
+			}()
+		}
+	}
+	if lc.SASLAuthdTLS != nil {
+		for _, addr := range lc.SASLAuthdTLS.Listen {
+			a := addr
+			wg.Add(1)
+			saslWG.Add(1)
+			go func() {
+				defer wg.Done()
+				defer saslWG.Done()
+				if err := runSaslAuthTLSAddr(ctx, a, lc.SASLAuthdTLS, s.GetInterface()); err != nil {
 					fmt.Printf("warning running auth-socket failed: %s\n", err)
 				}
 			}()
@@ -431,9 +663,19 @@ func cmdRun(c *cli.Context) error {
 			}()
 		}
 	}
-	wg.Wait()
-
-	return cli.NewExitError("shutting down since all auth sockets have closed.", 0)
+	if lc.Metrics != nil {
+		for _, addr := range lc.Metrics.Listen {
+			a := addr
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := runMetricsAddr(a, lc.Metrics, s.GetInterface()); err != nil {
+					fmt.Printf("warning running metrics listener failed: %s\n", err)
+				}
+			}()
+		}
+	}
+	return waitForListeners(ctx, &wg, &saslWG)
 }
 
 func cmdRunSa(c *cli.Context) error {
@@ -457,7 +699,10 @@ func cmdRunSa(c *cli.Context) error {
 		return cli.NewExitError("shutting down since there are no sockets to lissten on.", 2)
 	}
 
-	var wg sync.WaitGroup
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var wg, saslWG sync.WaitGroup
 	for name, listeners := range listenerGroups {
 		switch name {
 		case "saslauthd":
@@ -469,11 +714,35 @@ func cmdRunSa(c *cli.Context) error {
 				ln, ok := listener.(*net.UnixListener)
 				if !ok {
 					fmt.Printf("ingoring invalid socket type %T for saslauthd-compatible listener\n", listener)
+					continue
 				}
 				wg.Add(1)
+				saslWG.Add(1)
 				go func() {
 					defer wg.Done()
-					if err := runSaslAuthSocketListener(ln, s.GetInterface()); err != nil {
+					defer saslWG.Done()
+					if err := runSaslAuthSocketListener(ctx, ln, lc.SASLAuthd, s.GetInterface()); err != nil {
+						fmt.Printf("warning running auth-socket failed: %s\n", err)
+					}
+				}()
+			}
+		case "saslauthd-tls":
+			if lc.SASLAuthdTLS == nil {
+				fmt.Printf("ingoring unexpected socket for saslauthd-compatible TLS listener (no config found in listener-config)\n")
+				continue
+			}
+			for _, listener := range listeners {
+				ln, ok := listener.(*net.TCPListener)
+				if !ok {
+					fmt.Printf("ingoring invalid socket type %T for saslauthd-compatible TLS listener\n", listener)
+					continue
+				}
+				wg.Add(1)
+				saslWG.Add(1)
+				go func() {
+					defer wg.Done()
+					defer saslWG.Done()
+					if err := runSaslAuthTLSListener(ctx, ln, lc.SASLAuthdTLS, s.GetInterface()); err != nil {
 						fmt.Printf("warning running auth-socket failed: %s\n", err)
 					}
 				}()
@@ -487,6 +756,7 @@ func cmdRunSa(c *cli.Context) error {
 				ln, ok := listener.(*net.TCPListener)
 				if !ok {
 					fmt.Printf("ingoring invalid socket type %T for HTTP listener\n", listener)
+					continue
 				}
 				wg.Add(1)
 				go func() {
@@ -505,6 +775,7 @@ func cmdRunSa(c *cli.Context) error {
 				ln, ok := listener.(*net.TCPListener)
 				if !ok {
 					fmt.Printf("ingoring invalid socket type %T for HTTPs listener\n", listener)
+					continue
 				}
 				wg.Add(1)
 				go func() {
@@ -523,6 +794,7 @@ func cmdRunSa(c *cli.Context) error {
 				ln, ok := listener.(*net.TCPListener)
 				if !ok {
 					fmt.Printf("ingoring invalid socket type %T for LDAP listener\n", listener)
+					continue
 				}
 				wg.Add(1)
 				go func() {
@@ -541,6 +813,7 @@ func cmdRunSa(c *cli.Context) error {
 				ln, ok := listener.(*net.TCPListener)
 				if !ok {
 					fmt.Printf("ingoring invalid socket type %T for LDAPs listener\n", listener)
+					continue
 				}
 				wg.Add(1)
 				go func() {
@@ -550,12 +823,29 @@ func cmdRunSa(c *cli.Context) error {
 					}
 				}()
 			}
+		case "metrics":
+			if lc.Metrics == nil {
+				fmt.Printf("ingoring unexpected socket for metrics listener (no config found in listener-config)\n")
+				continue
+			}
+			for _, listener := range listeners {
+				ln, ok := listener.(*net.TCPListener)
+				if !ok {
+					fmt.Printf("ingoring invalid socket type %T for metrics listener\n", listener)
+					continue
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := runMetricsListener(ln, lc.Metrics, s.GetInterface()); err != nil {
+						fmt.Printf("warning running metrics listener failed: %s\n", err)
+					}
+				}()
+			}
 		}
 
 	}
-	wg.Wait()
-
-	return cli.NewExitError("shutting down since all auth sockets have closed.", 0)
+	return waitForListeners(ctx, &wg, &saslWG)
 }
 
 func main() {
@@ -593,12 +883,126 @@ func main() {
 			Usage:  "password policy condition",
 			EnvVar: "WHAWTY_AUTH_POLICY_CONDITION",
 		},
+		cli.StringFlag{
+			Name:   "admin-policy-type",
+			Value:  "",
+			Usage:  "password policy type for admins",
+			EnvVar: "WHAWTY_AUTH_ADMIN_POLICY_TYPE",
+		},
+		cli.StringFlag{
+			Name:   "admin-policy-condition",
+			Value:  "",
+			Usage:  "password policy condition for admins",
+			EnvVar: "WHAWTY_AUTH_ADMIN_POLICY_CONDITION",
+		},
+		cli.StringFlag{
+			Name:   "user-policies",
+			Value:  "",
+			Usage:  "path to a file which selects password policies by username",
+			EnvVar: "WHAWTY_AUTH_USER_POLICIES",
+		},
+		cli.StringFlag{
+			Name:   "services",
+			Value:  "",
+			Usage:  "path to a file with the default rules which services users may authenticate for",
+			EnvVar: "WHAWTY_AUTH_SERVICES",
+		},
 		cli.StringFlag{
 			Name:   "hooks-dir",
 			Value:  "",
 			Usage:  "path to update hooks",
 			EnvVar: "WHAWTY_AUTH_HOOKS_DIR",
 		},
+		cli.UintFlag{
+			Name:   "throttle-attempts",
+			Value:  5,
+			Usage:  "number of failed authentications before back-off starts",
+			EnvVar: "WHAWTY_AUTH_THROTTLE_ATTEMPTS",
+		},
+		cli.DurationFlag{
+			Name:   "throttle-backoff",
+			Value:  time.Second,
+			Usage:  "initial back-off after too many failed authentications, doubled on every further failure",
+			EnvVar: "WHAWTY_AUTH_THROTTLE_BACKOFF",
+		},
+		cli.DurationFlag{
+			Name:   "throttle-max-backoff",
+			Value:  5 * time.Minute,
+			Usage:  "maximum back-off after failed authentications",
+			EnvVar: "WHAWTY_AUTH_THROTTLE_MAX_BACKOFF",
+		},
+		cli.UintFlag{
+			Name:   "throttle-lockout-attempts",
+			Value:  20,
+			Usage:  "number of failed authentications after which a user gets locked out (0 disables lockouts)",
+			EnvVar: "WHAWTY_AUTH_THROTTLE_LOCKOUT_ATTEMPTS",
+		},
+		cli.DurationFlag{
+			Name:   "throttle-lockout",
+			Value:  15 * time.Minute,
+			Usage:  "duration of a lockout",
+			EnvVar: "WHAWTY_AUTH_THROTTLE_LOCKOUT",
+		},
+		cli.UintFlag{
+			Name:   "throttle-addr-attempts",
+			Value:  20,
+			Usage:  "number of failed authentications from a client address before back-off starts",
+			EnvVar: "WHAWTY_AUTH_THROTTLE_ADDR_ATTEMPTS",
+		},
+		cli.DurationFlag{
+			Name:   "throttle-addr-max-backoff",
+			Value:  10 * time.Second,
+			Usage:  "maximum back-off after failed authentications from a client address",
+			EnvVar: "WHAWTY_AUTH_THROTTLE_ADDR_MAX_BACKOFF",
+		},
+		cli.StringFlag{
+			Name:   "throttle-exempt",
+			Value:  "127.0.0.0/8,::1",
+			Usage:  "comma separated list of client addresses or networks which are not throttled, e.g. trusted reverse proxies",
+			EnvVar: "WHAWTY_AUTH_THROTTLE_EXEMPT",
+		},
+		cli.DurationFlag{
+			Name:   "throttle-expire",
+			Value:  time.Hour,
+			Usage:  "forget failed authentications after this long since the last failure",
+			EnvVar: "WHAWTY_AUTH_THROTTLE_EXPIRE",
+		},
+		cli.IntFlag{
+			Name:   "throttle-max-entries",
+			Value:  100000,
+			Usage:  "maximum number of users and client addresses to keep track of each (0 means no limit)",
+			EnvVar: "WHAWTY_AUTH_THROTTLE_MAX_ENTRIES",
+		},
+		cli.DurationFlag{
+			Name:   "ready-timeout",
+			Value:  5 * time.Second,
+			Usage:  "time to wait for the store before the readiness check fails",
+			EnvVar: "WHAWTY_AUTH_READY_TIMEOUT",
+		},
+		cli.DurationFlag{
+			Name:   "ready-check-interval",
+			Value:  30 * time.Second,
+			Usage:  "time between two consistency checks of the store reported by the readiness check",
+			EnvVar: "WHAWTY_AUTH_READY_CHECK_INTERVAL",
+		},
+		cli.DurationFlag{
+			Name:   "reset-token-validity",
+			Value:  24 * time.Hour,
+			Usage:  "how long password reset tokens are valid if no other validity is requested",
+			EnvVar: "WHAWTY_AUTH_RESET_TOKEN_VALIDITY",
+		},
+		cli.StringFlag{
+			Name:   "audit-log",
+			Value:  "",
+			Usage:  "write audit records to this file or to 'syslog'",
+			EnvVar: "WHAWTY_AUTH_AUDIT_LOG",
+		},
+	}
+	app.Before = func(c *cli.Context) error {
+		if err := audit.Open(c.GlobalString("audit-log")); err != nil {
+			return cli.NewExitError(fmt.Sprintf("Error opening audit log: %s", err), 3)
+		}
+		return nil
 	}
 	app.Commands = []cli.Command{
 		{
@@ -637,6 +1041,48 @@ func main() {
 			ArgsUsage: "<username> (true|false)",
 			Action:    cmdSetAdmin,
 		},
+		{
+			Name:      "set-roles",
+			Usage:     "replace the role labels of a user",
+			ArgsUsage: "<username> [<role> ...]",
+			Action:    cmdSetRoles,
+		},
+		{
+			Name:      "set-services",
+			Usage:     "replace the list of services a user may authenticate for",
+			ArgsUsage: "<username> [<service> ...]",
+			Action:    cmdSetServices,
+		},
+		{
+			Name:      "reset-token",
+			Usage:     "create a single-use password reset token for a user",
+			ArgsUsage: "<username>",
+			Flags: []cli.Flag{
+				cli.DurationFlag{
+					Name:  "valid-for",
+					Usage: "how long the token is valid (default: the value of --reset-token-validity)",
+				},
+			},
+			Action: cmdResetToken,
+		},
+		{
+			Name:      "pwned-index",
+			Usage:     "build an index for the password policy 'pwned' from a Pwned Passwords dump",
+			ArgsUsage: "<dump> <index>",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "hash",
+					Value: "sha1",
+					Usage: "hash type of the dump (sha1 or ntlm)",
+				},
+				cli.Uint64Flag{
+					Name:  "min-count",
+					Value: 1,
+					Usage: "skip passwords which were seen less often in breaches",
+				},
+			},
+			Action: cmdPwnedIndex,
+		},
 		{
 			Name:  "list",
 			Usage: "list all users",
@@ -0,0 +1,254 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// This implements just enough of the Prometheus text exposition format to export
+// a handful of counters, histograms and gauges.
+
+func escapeMetricLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatMetricLabels(names, values []string, extra ...string) string {
+	var pairs []string
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escapeMetricLabel(values[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], escapeMetricLabel(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatMetricValue(v float64) string {
+	if math.IsInf(v, +1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// metricCounter is used for counters as well as for gauges which are only ever
+// built up from scratch.
+type metricCounter struct {
+	mutex  sync.Mutex
+	typ    string
+	name   string
+	help   string
+	labels []string
+	values map[string]uint64
+}
+
+func newMetricCounter(name, help string, labels ...string) *metricCounter {
+	return &metricCounter{typ: "counter", name: name, help: help, labels: labels, values: make(map[string]uint64)}
+}
+
+func newMetricGauge(name, help string, labels ...string) *metricCounter {
+	return &metricCounter{typ: "gauge", name: name, help: help, labels: labels, values: make(map[string]uint64)}
+}
+
+func (c *metricCounter) Inc(values ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.values[strings.Join(values, "\x00")]++
+}
+
+func (c *metricCounter) Write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", c.name, c.help, c.name, c.typ) //nolint:errcheck
+	if len(c.labels) == 0 {
+		fmt.Fprintf(w, "%s %d\n", c.name, c.values[""]) //nolint:errcheck
+		return
+	}
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s %d\n", c.name, formatMetricLabels(c.labels, strings.Split(k, "\x00")), c.values[k]) //nolint:errcheck
+	}
+}
+
+type metricHistogramValue struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+type metricHistogram struct {
+	mutex   sync.Mutex
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	values  map[string]*metricHistogramValue
+}
+
+func newMetricHistogram(name, help string, buckets []float64, labels ...string) *metricHistogram {
+	return &metricHistogram{name: name, help: help, labels: labels, buckets: buckets, values: make(map[string]*metricHistogramValue)}
+}
+
+func (h *metricHistogram) Observe(v float64, values ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	key := strings.Join(values, "\x00")
+	hv, exists := h.values[key]
+	if !exists {
+		hv = &metricHistogramValue{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hv
+	}
+	for i, le := range h.buckets {
+		if v <= le {
+			hv.counts[i]++
+		}
+	}
+	hv.count++
+	hv.sum += v
+}
+
+// ObserveSince records the time passed since start in seconds. This is meant to be
+// used together with defer.
+func (h *metricHistogram) ObserveSince(start time.Time, values ...string) {
+	h.Observe(time.Since(start).Seconds(), values...)
+}
+
+func (h *metricHistogram) Write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name) //nolint:errcheck
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		values := strings.Split(k, "\x00")
+		hv := h.values[k]
+		for i, le := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatMetricLabels(h.labels, values, "le", formatMetricValue(le)), hv.counts[i]) //nolint:errcheck
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatMetricLabels(h.labels, values, "le", "+Inf"), hv.count) //nolint:errcheck
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatMetricLabels(h.labels, values), formatMetricValue(hv.sum)) //nolint:errcheck
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatMetricLabels(h.labels, values), hv.count)                //nolint:errcheck
+	}
+}
+
+type Metrics struct {
+	requests         *metricCounter
+	dispatchDuration *metricHistogram
+	upgradesDropped  *metricCounter
+	hookRuns         *metricCounter
+}
+
+var metrics = &Metrics{
+	requests: newMetricCounter("whawty_auth_requests_total",
+		"Number of authentication and administrative requests.", "frontend", "operation", "result"),
+	dispatchDuration: newMetricHistogram("whawty_auth_dispatch_duration_seconds",
+		"Time spent waiting for and processing requests by the store dispatcher.",
+		[]float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}, "operation"), // TODO: hardcoded value
+	upgradesDropped: newMetricCounter("whawty_auth_upgrades_dropped_total",
+		"Number of remote hash upgrades dropped due to rate-limiting."),
+	hookRuns: newMetricCounter("whawty_auth_hook_runs_total",
+		"Number of update hook runs.", "result"),
+}
+
+func writeUserMetrics(w io.Writer, store *Store) {
+	list, err := store.ListFull()
+	if err != nil {
+		wl.Printf("metrics: failed to list users: %v", err)
+		return
+	}
+
+	users := newMetricGauge("whawty_auth_users", "Number of users per hash format and parameter-set.", "format", "paramid")
+	for _, user := range list {
+		users.Inc(user.FormatID, strconv.FormatUint(uint64(user.ParamID), 10))
+	}
+	users.Write(w)
+}
+
+func (m *Metrics) Write(w io.Writer, store *Store) {
+	m.requests.Write(w)
+	m.dispatchDuration.Write(w)
+	m.upgradesDropped.Write(w)
+	m.hookRuns.Write(w)
+	writeUserMetrics(w, store)
+}
+
+func handleMetrics(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	metrics.Write(w, store)
+}
+
+// newMetricsHandler returns the handler of the metrics listeners. The metrics are only
+// exported there since they reveal the number of users and requests to anybody who is
+// able to connect.
+func newMetricsHandler(store *Store) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", webHandler{store, nil, handleMetrics})
+	mux.Handle("GET /healthz", webHandler{store, nil, handleHealthz})
+	mux.Handle("GET /readyz", webHandler{store, nil, handleReadyz})
+	return mux
+}
+
+func runMetricsListener(listener *net.TCPListener, config *metricsConfig, store *Store) error {
+	server := &http.Server{Handler: newMetricsHandler(store), ReadTimeout: 60 * time.Second, WriteTimeout: 60 * time.Second}
+	wl.Printf("metrics: listening on '%s'", listener.Addr())
+	return server.Serve(tcpKeepAliveListener{listener})
+}
+
+func runMetricsAddr(addr string, config *metricsConfig, store *Store) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return runMetricsListener(listener.(*net.TCPListener), config, store)
+}
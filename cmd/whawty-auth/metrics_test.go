@@ -0,0 +1,104 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetricCounter(t *testing.T) {
+	c := newMetricCounter("test_total", "Test counter.", "frontend", "result")
+	c.Inc("http", "success")
+	c.Inc("http", "success")
+	c.Inc("ldap", "fail\"ure")
+
+	var b strings.Builder
+	c.Write(&b)
+	expected := `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{frontend="http",result="success"} 2
+test_total{frontend="ldap",result="fail\"ure"} 1
+`
+	if b.String() != expected {
+		t.Fatalf("unexpected output:\n%s", b.String())
+	}
+}
+
+func TestMetricHistogram(t *testing.T) {
+	h := newMetricHistogram("test_seconds", "Test histogram.", []float64{0.1, 1}, "operation")
+	h.Observe(0.05, "add")
+	h.Observe(0.5, "add")
+	h.Observe(2, "add")
+
+	var b strings.Builder
+	h.Write(&b)
+	expected := `# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{operation="add",le="0.1"} 1
+test_seconds_bucket{operation="add",le="1"} 2
+test_seconds_bucket{operation="add",le="+Inf"} 3
+test_seconds_sum{operation="add"} 2.55
+test_seconds_count{operation="add"} 3
+`
+	if b.String() != expected {
+		t.Fatalf("unexpected output:\n%s", b.String())
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	store := newTestStore(t, policyConfig{}, "")
+
+	w := webTestRequest(newMetricsHandler(store), "GET", "/metrics", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected content type: %s", ct)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "# TYPE whawty_auth_users gauge") ||
+		!strings.Contains(body, "whawty_auth_users{format=\"hmac_sha256_scrypt\",paramid=\"1\"} 1") {
+		t.Fatalf("metrics are missing the user count:\n%s", body)
+	}
+
+	if w := webTestRequest(newMetricsHandler(store), "POST", "/metrics", "", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got %d", w.Code)
+	}
+
+	mux, err := newWebHandler(store, &webConfig{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if w := webTestRequest(mux, "GET", "/metrics", "", ""); w.Code == http.StatusOK {
+		t.Fatal("the web-api should not export any metrics")
+	}
+}
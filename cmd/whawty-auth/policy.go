@@ -32,20 +32,98 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/nbutton23/zxcvbn-go"
 	"github.com/nbutton23/zxcvbn-go/scoring"
+	"gopkg.in/yaml.v3"
 )
 
+// PolicyFeedback describes the strength of a password and whether it fulfills the
+// password policy. Warnings and suggestions are meant to be shown to the user.
+type PolicyFeedback struct {
+	OK               bool     `json:"ok"`
+	Score            int      `json:"score"`
+	Entropy          float64  `json:"entropy"`
+	CrackTime        float64  `json:"crack_time"`
+	CrackTimeDisplay string   `json:"crack_time_display"`
+	Warnings         []string `json:"warnings"`
+	Suggestions      []string `json:"suggestions"`
+}
+
+func zxcvbnStrength(password, username string) scoring.MinEntropyMatch {
+	return zxcvbn.PasswordStrength(password, []string{username, "whawty"})
+}
+
+// zxcvbnHints derives warnings and suggestions from the patterns zxcvbn found in the password.
+// Like the original zxcvbn this only complains about weak passwords.
+func zxcvbnHints(score scoring.MinEntropyMatch) (warnings, suggestions []string) {
+	warnings, suggestions = []string{}, []string{}
+	if score.Score > 2 {
+		return
+	}
+	seen := make(map[string]bool)
+	add := func(list *[]string, hint string) {
+		if !seen[hint] {
+			seen[hint] = true
+			*list = append(*list, hint)
+		}
+	}
+
+	for _, m := range score.MatchSequence {
+		switch m.Pattern {
+		case "dictionary":
+			dict := strings.TrimSuffix(m.DictionaryName, "_3117")
+			switch dict {
+			case "Passwords":
+				add(&warnings, "This is similar to a commonly used password")
+			case "English":
+				add(&warnings, "A word by itself is easy to guess")
+			case "MaleNames", "FemaleNames", "Surname":
+				add(&warnings, "Names and surnames by themselves are easy to guess")
+			case "user_inputs":
+				add(&warnings, "Passwords containing the username are easy to guess")
+			}
+			if dict != m.DictionaryName {
+				add(&suggestions, "Predictable substitutions like '@' instead of 'a' don't help very much")
+			}
+		case "spatial":
+			add(&warnings, "Keyboard patterns are easy to guess")
+			add(&suggestions, "Use a longer keyboard pattern with more turns")
+		case "repeat":
+			add(&warnings, "Repeats like 'aaa' or 'abcabc' are easy to guess")
+			add(&suggestions, "Avoid repeated words and characters")
+		case "sequence":
+			add(&warnings, "Sequences like 'abc' or '6543' are easy to guess")
+			add(&suggestions, "Avoid sequences")
+		case "date":
+			add(&warnings, "Dates are often easy to guess")
+			add(&suggestions, "Avoid dates and years that are associated with you")
+		}
+	}
+	add(&suggestions, "Add another word or two, uncommon words are better")
+	return
+}
+
+func zxcvbnFeedback(score scoring.MinEntropyMatch) (f PolicyFeedback) {
+	f.Score = score.Score
+	f.Entropy = score.Entropy
+	f.CrackTime = score.CrackTime
+	f.CrackTimeDisplay = score.CrackTimeDisplay
+	f.Warnings, f.Suggestions = zxcvbnHints(score)
+	return
+}
+
 type zxcvbnPolicy struct {
 	condition func(score scoring.MinEntropyMatch, threshold uint64) bool
 	threshold uint64
 }
 
 func (z zxcvbnPolicy) Check(password, username string) (result bool, err error) {
-	score := zxcvbn.PasswordStrength(password, []string{username, "whawty"})
+	score := zxcvbnStrength(password, username)
 	result = z.condition(score, z.threshold)
 	if result {
 		wdl.Printf("zxcbvn result: score = %d, entropy = %f, crack-time: %s (%f s) -> success", score.Score, score.Entropy, score.CrackTimeDisplay, score.CrackTime)
@@ -55,6 +133,13 @@ func (z zxcvbnPolicy) Check(password, username string) (result bool, err error)
 	return result, nil
 }
 
+func (z zxcvbnPolicy) Feedback(password, username string) PolicyFeedback {
+	score := zxcvbnStrength(password, username)
+	f := zxcvbnFeedback(score)
+	f.OK = z.condition(score, z.threshold)
+	return f
+}
+
 func zxcvbnConditionScore(score scoring.MinEntropyMatch, threshold uint64) bool {
 	return score.Score >= int(threshold)
 }
@@ -108,8 +193,16 @@ func (z nullPolicy) Check(password, username string) (result bool, err error) {
 	return true, nil
 }
 
+// Feedback still reports the strength of the password, even though every password is accepted.
+func (z nullPolicy) Feedback(password, username string) PolicyFeedback {
+	f := zxcvbnFeedback(zxcvbnStrength(password, username))
+	f.OK = true
+	return f
+}
+
 type PolicyChecker interface {
 	Check(password, username string) (bool, error)
+	Feedback(password, username string) PolicyFeedback
 }
 
 func NewPasswordPolicy(policyType, condition string) (p PolicyChecker, err error) {
@@ -118,7 +211,129 @@ func NewPasswordPolicy(policyType, condition string) (p PolicyChecker, err error
 		return nullPolicy{}, nil
 	case "zxcvbn":
 		return newZXCVBNPolicy(condition)
+	case "composite":
+		return newCompositePolicy(condition)
+	case "pwned":
+		return newPwnedPolicy(condition)
 	default:
 		return nil, fmt.Errorf("unknown password-policy type: %s", policyType)
 	}
 }
+
+// policyConfig holds the configuration of all password policies. The default policy
+// applies to everybody not matched by any of the user policies. If no admin policy is
+// configured admins use the default policy as well.
+type policyConfig struct {
+	Type           string
+	Condition      string
+	AdminType      string
+	AdminCondition string
+	UserPolicies   string
+}
+
+type userPolicyConfig struct {
+	Name      string `yaml:"name"`
+	Users     string `yaml:"users"`
+	Admin     *bool  `yaml:"admin"`
+	Type      string `yaml:"type"`
+	Condition string `yaml:"condition"`
+}
+
+type userPoliciesConfig struct {
+	Policies []userPolicyConfig `yaml:"policies"`
+}
+
+type userPolicy struct {
+	name    string
+	users   *regexp.Regexp
+	admin   *bool
+	checker PolicyChecker
+}
+
+// policySelector picks the password policy for a user based on the username and the
+// admin state. Policies are identified by name, this name gets recorded in the store
+// whenever a password has been checked.
+type policySelector struct {
+	users    []userPolicy
+	admin    PolicyChecker
+	fallback PolicyChecker
+}
+
+const (
+	policyNameDefault = "default"
+	policyNameAdmin   = "admin"
+)
+
+func readUserPolicies(configfile string) (*userPoliciesConfig, error) {
+	file, err := os.Open(configfile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close() //nolint:errcheck
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+
+	c := &userPoliciesConfig{}
+	if err = decoder.Decode(c); err != nil {
+		return nil, fmt.Errorf("failed to parse user policies file: %s", err)
+	}
+	return c, nil
+}
+
+func newPolicySelector(config policyConfig) (p *policySelector, err error) {
+	p = &policySelector{}
+	if p.fallback, err = NewPasswordPolicy(config.Type, config.Condition); err != nil {
+		return nil, err
+	}
+	if config.AdminType != "" {
+		if p.admin, err = NewPasswordPolicy(config.AdminType, config.AdminCondition); err != nil {
+			return nil, fmt.Errorf("admin password policy: %v", err)
+		}
+	}
+	if config.UserPolicies == "" {
+		return p, nil
+	}
+
+	c, err := readUserPolicies(config.UserPolicies)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{policyNameDefault: true, policyNameAdmin: true}
+	for _, uc := range c.Policies {
+		if uc.Name == "" || names[uc.Name] {
+			return nil, fmt.Errorf("every user policy needs a unique name other than '%s' and '%s'", policyNameDefault, policyNameAdmin)
+		}
+		names[uc.Name] = true
+
+		up := userPolicy{name: uc.Name, admin: uc.Admin}
+		if uc.Users != "" {
+			if up.users, err = regexp.Compile(uc.Users); err != nil {
+				return nil, fmt.Errorf("user policy '%s': %v", uc.Name, err)
+			}
+		}
+		if up.checker, err = NewPasswordPolicy(uc.Type, uc.Condition); err != nil {
+			return nil, fmt.Errorf("user policy '%s': %v", uc.Name, err)
+		}
+		p.users = append(p.users, up)
+	}
+	return p, nil
+}
+
+// Select returns the name of the policy and the policy to use for username. The first
+// matching user policy wins, otherwise admins use the admin policy, if one is configured.
+func (p *policySelector) Select(username string, isAdmin bool) (string, PolicyChecker) {
+	for _, up := range p.users {
+		if up.users != nil && !up.users.MatchString(username) {
+			continue
+		}
+		if up.admin != nil && *up.admin != isAdmin {
+			continue
+		}
+		return up.name, up.checker
+	}
+	if isAdmin && p.admin != nil {
+		return policyNameAdmin, p.admin
+	}
+	return policyNameDefault, p.fallback
+}
@@ -0,0 +1,392 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// compositePolicyConfig is a single node of a composite password policy file. Every node
+// must contain exactly one rule, 'all' and 'any' combine other nodes.
+type compositePolicyConfig struct {
+	Name             string                          `yaml:"name"`
+	All              []compositePolicyConfig         `yaml:"all"`
+	Any              []compositePolicyConfig         `yaml:"any"`
+	MinLength        int                             `yaml:"min-length"`
+	MaxLength        int                             `yaml:"max-length"`
+	CharacterClasses *compositePolicyCharClassConfig `yaml:"character-classes"`
+	BannedWords      string                          `yaml:"banned-words"`
+	ZXCVBN           string                          `yaml:"zxcvbn"`
+	NotUsername      bool                            `yaml:"not-username"`
+	Pwned            string                          `yaml:"pwned"`
+}
+
+type compositePolicyCharClassConfig struct {
+	Required []string `yaml:"required"`
+	Min      int      `yaml:"min"`
+}
+
+// policyRuleError is returned if a password does not fulfill a rule of a composite policy.
+type policyRuleError struct {
+	rule   string
+	reason string
+}
+
+func (e policyRuleError) Error() string {
+	return fmt.Sprintf("password policy rule '%s' failed: %s", e.rule, e.reason)
+}
+
+type policyRule interface {
+	String() string
+	check(password, username string) error
+}
+
+type policyRuleAll struct {
+	name  string
+	rules []policyRule
+}
+
+func (r policyRuleAll) String() string { return r.name }
+
+func (r policyRuleAll) check(password, username string) error {
+	for _, rule := range r.rules {
+		if err := rule.check(password, username); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type policyRuleAny struct {
+	name  string
+	rules []policyRule
+}
+
+func (r policyRuleAny) String() string { return r.name }
+
+func (r policyRuleAny) check(password, username string) error {
+	var reasons []string
+	for _, rule := range r.rules {
+		err := rule.check(password, username)
+		if err == nil {
+			return nil
+		}
+		var ruleErr policyRuleError
+		if errors.As(err, &ruleErr) {
+			reasons = append(reasons, fmt.Sprintf("'%s': %s", ruleErr.rule, ruleErr.reason))
+		} else {
+			reasons = append(reasons, err.Error())
+		}
+	}
+	return policyRuleError{r.name, "none of the alternatives is fulfilled (" + strings.Join(reasons, "; ") + ")"}
+}
+
+type policyRuleMinLength struct {
+	name string
+	min  int
+}
+
+func (r policyRuleMinLength) String() string { return r.name }
+
+func (r policyRuleMinLength) check(password, username string) error {
+	if utf8.RuneCountInString(password) < r.min {
+		return policyRuleError{r.name, fmt.Sprintf("password must be at least %d characters long", r.min)}
+	}
+	return nil
+}
+
+type policyRuleMaxLength struct {
+	name string
+	max  int
+}
+
+func (r policyRuleMaxLength) String() string { return r.name }
+
+func (r policyRuleMaxLength) check(password, username string) error {
+	if utf8.RuneCountInString(password) > r.max {
+		return policyRuleError{r.name, fmt.Sprintf("password must not be longer than %d characters", r.max)}
+	}
+	return nil
+}
+
+var policyCharClasses = map[string]func(rune) bool{
+	"lower":  unicode.IsLower,
+	"upper":  unicode.IsUpper,
+	"digit":  unicode.IsDigit,
+	"symbol": func(c rune) bool { return !unicode.IsLower(c) && !unicode.IsUpper(c) && !unicode.IsDigit(c) },
+}
+
+type policyRuleCharClasses struct {
+	name     string
+	required []string
+	min      int
+}
+
+func (r policyRuleCharClasses) String() string { return r.name }
+
+func (r policyRuleCharClasses) check(password, username string) error {
+	found := make(map[string]bool)
+	for _, c := range password {
+		for class, is := range policyCharClasses {
+			if is(c) {
+				found[class] = true
+			}
+		}
+	}
+	for _, class := range r.required {
+		if !found[class] {
+			return policyRuleError{r.name, fmt.Sprintf("password must contain at least one character of class '%s'", class)}
+		}
+	}
+	if len(found) < r.min {
+		return policyRuleError{r.name, fmt.Sprintf("password must contain characters of at least %d different classes (lower, upper, digit, symbol)", r.min)}
+	}
+	return nil
+}
+
+type policyRuleBannedWords struct {
+	name  string
+	words []string
+}
+
+func (r policyRuleBannedWords) String() string { return r.name }
+
+func (r policyRuleBannedWords) check(password, username string) error {
+	lower := strings.ToLower(password)
+	for _, word := range r.words {
+		if strings.Contains(lower, word) {
+			return policyRuleError{r.name, "password contains a banned word"}
+		}
+	}
+	return nil
+}
+
+func loadPolicyBannedWords(filename string) (words []string, err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close() //nolint:errcheck
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		words = append(words, word)
+	}
+	return words, scanner.Err()
+}
+
+type policyRuleZXCVBN struct {
+	name   string
+	policy zxcvbnPolicy
+}
+
+func (r policyRuleZXCVBN) String() string { return r.name }
+
+func (r policyRuleZXCVBN) check(password, username string) error {
+	if ok, _ := r.policy.Check(password, username); !ok {
+		return policyRuleError{r.name, "password is too weak"}
+	}
+	return nil
+}
+
+type policyRulePwned struct {
+	name   string
+	policy pwnedPolicy
+}
+
+func (r policyRulePwned) String() string { return r.name }
+
+func (r policyRulePwned) check(password, username string) error {
+	if ok, err := r.policy.Check(password, username); !ok {
+		return policyRuleError{r.name, err.Error()}
+	}
+	return nil
+}
+
+type policyRuleNotUsername struct {
+	name string
+}
+
+func (r policyRuleNotUsername) String() string { return r.name }
+
+func (r policyRuleNotUsername) check(password, username string) error {
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return policyRuleError{r.name, "password must not contain the username"}
+	}
+	return nil
+}
+
+// newPolicyRule builds the rule described by c. Relative paths are resolved using basedir.
+func newPolicyRule(c compositePolicyConfig, basedir string) (rule policyRule, err error) {
+	n := 0
+	for _, set := range []bool{c.All != nil, c.Any != nil, c.MinLength != 0, c.MaxLength != 0, c.CharacterClasses != nil,
+		c.BannedWords != "", c.ZXCVBN != "", c.NotUsername, c.Pwned != ""} {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		return nil, fmt.Errorf("every policy rule must contain exactly one of all, any, min-length, max-length, character-classes, banned-words, zxcvbn, not-username or pwned")
+	}
+
+	name := func(def string) string {
+		if c.Name != "" {
+			return c.Name
+		}
+		return def
+	}
+
+	switch {
+	case c.All != nil, c.Any != nil:
+		children := c.All
+		if c.Any != nil {
+			children = c.Any
+		}
+		var rules []policyRule
+		for _, child := range children {
+			r, err := newPolicyRule(child, basedir)
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, r)
+		}
+		if len(rules) == 0 {
+			return nil, fmt.Errorf("all and any need at least one rule")
+		}
+		if c.All != nil {
+			return policyRuleAll{name("all"), rules}, nil
+		}
+		return policyRuleAny{name("any"), rules}, nil
+	case c.MinLength != 0:
+		if c.MinLength < 0 {
+			return nil, fmt.Errorf("min-length must not be negative")
+		}
+		return policyRuleMinLength{name(fmt.Sprintf("min-length %d", c.MinLength)), c.MinLength}, nil
+	case c.MaxLength != 0:
+		if c.MaxLength < 0 {
+			return nil, fmt.Errorf("max-length must not be negative")
+		}
+		return policyRuleMaxLength{name(fmt.Sprintf("max-length %d", c.MaxLength)), c.MaxLength}, nil
+	case c.CharacterClasses != nil:
+		for _, class := range c.CharacterClasses.Required {
+			if _, exists := policyCharClasses[class]; !exists {
+				return nil, fmt.Errorf("unknown character class '%s', must be one of lower, upper, digit, symbol", class)
+			}
+		}
+		if c.CharacterClasses.Min < 0 || c.CharacterClasses.Min > len(policyCharClasses) {
+			return nil, fmt.Errorf("character-classes min must be between 0 and %d", len(policyCharClasses))
+		}
+		return policyRuleCharClasses{name("character-classes"), c.CharacterClasses.Required, c.CharacterClasses.Min}, nil
+	case c.BannedWords != "":
+		words, err := loadPolicyBannedWords(policyPath(basedir, c.BannedWords))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load banned words: %v", err)
+		}
+		return policyRuleBannedWords{name("banned-words"), words}, nil
+	case c.ZXCVBN != "":
+		p, err := newZXCVBNPolicy(c.ZXCVBN)
+		if err != nil {
+			return nil, err
+		}
+		return policyRuleZXCVBN{name("zxcvbn " + c.ZXCVBN), p}, nil
+	case c.Pwned != "":
+		p, err := newPwnedPolicy(policyPath(basedir, c.Pwned))
+		if err != nil {
+			return nil, err
+		}
+		return policyRulePwned{name("pwned"), p}, nil
+	default:
+		return policyRuleNotUsername{name("not-username")}, nil
+	}
+}
+
+func policyPath(basedir, filename string) string {
+	if filepath.IsAbs(filename) {
+		return filename
+	}
+	return filepath.Join(basedir, filename)
+}
+
+type compositePolicy struct {
+	rule policyRule
+}
+
+func (p compositePolicy) Check(password, username string) (bool, error) {
+	if err := p.rule.check(password, username); err != nil {
+		wdl.Printf("composite policy: %v", err)
+		return false, err
+	}
+	return true, nil
+}
+
+func (p compositePolicy) Feedback(password, username string) PolicyFeedback {
+	f := zxcvbnFeedback(zxcvbnStrength(password, username))
+	f.OK = true
+	if err := p.rule.check(password, username); err != nil {
+		f.OK = false
+		f.Warnings = append([]string{err.Error()}, f.Warnings...)
+	}
+	return f
+}
+
+func newCompositePolicy(configfile string) (p compositePolicy, err error) {
+	file, err := os.Open(configfile)
+	if err != nil {
+		return
+	}
+	defer file.Close() //nolint:errcheck
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+
+	c := compositePolicyConfig{}
+	if err = decoder.Decode(&c); err != nil {
+		err = fmt.Errorf("failed to parse password policy file: %s", err)
+		return
+	}
+	if p.rule, err = newPolicyRule(c, filepath.Dir(configfile)); err != nil {
+		err = fmt.Errorf("invalid password policy file: %s", err)
+	}
+	return
+}
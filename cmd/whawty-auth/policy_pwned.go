@@ -0,0 +1,269 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4" //nolint:staticcheck // NTLM hashes are MD4 by definition
+)
+
+// The index is a header followed by the sorted, raw hashes of all breached passwords.
+// All records have the same size which allows a binary search directly on the file.
+const (
+	pwnedIndexMagic     = "WHAWTYPW"
+	pwnedIndexHeaderLen = len(pwnedIndexMagic) + 1
+)
+
+type pwnedHashType byte
+
+const (
+	pwnedHashSHA1 pwnedHashType = 1
+	pwnedHashNTLM pwnedHashType = 2
+)
+
+func parsePwnedHashType(name string) (pwnedHashType, error) {
+	switch strings.ToLower(name) {
+	case "sha1":
+		return pwnedHashSHA1, nil
+	case "ntlm":
+		return pwnedHashNTLM, nil
+	}
+	return 0, fmt.Errorf("unknown hash type '%s', must be one of sha1, ntlm", name)
+}
+
+func (t pwnedHashType) Size() int {
+	if t == pwnedHashNTLM {
+		return md4.Size
+	}
+	return sha1.Size
+}
+
+func (t pwnedHashType) Sum(password string) []byte {
+	if t == pwnedHashNTLM {
+		h := md4.New()
+		binary.Write(h, binary.LittleEndian, utf16.Encode([]rune(password))) //nolint:errcheck
+		return h.Sum(nil)
+	}
+	sum := sha1.Sum([]byte(password))
+	return sum[:]
+}
+
+// pwnedIndex is re-opened on SIGHUP so a rebuilt index gets used without a restart.
+type pwnedIndex struct {
+	filename string
+	mutex    sync.RWMutex
+	file     *os.File
+	hashType pwnedHashType
+	records  int64
+}
+
+func openPwnedIndex(filename string) (*pwnedIndex, error) {
+	idx := &pwnedIndex{filename: filename}
+	if err := idx.open(); err != nil {
+		return nil, err
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	go idx.reopenOn(sig)
+	return idx, nil
+}
+
+// open opens the index file and replaces the current one if it is valid. The caller
+// must hold the write lock unless the index isn't used yet.
+func (idx *pwnedIndex) open() error {
+	file, err := os.Open(idx.filename)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, pwnedIndexHeaderLen)
+	if _, err := io.ReadFull(file, header); err != nil || string(header[:len(pwnedIndexMagic)]) != pwnedIndexMagic {
+		file.Close() //nolint:errcheck
+		return fmt.Errorf("'%s' is not a pwned passwords index", idx.filename)
+	}
+	hashType := pwnedHashType(header[len(pwnedIndexMagic)])
+	if hashType != pwnedHashSHA1 && hashType != pwnedHashNTLM {
+		file.Close() //nolint:errcheck
+		return fmt.Errorf("pwned passwords index '%s' uses an unknown hash type", idx.filename)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close() //nolint:errcheck
+		return err
+	}
+	size := info.Size() - int64(pwnedIndexHeaderLen)
+	if size%int64(hashType.Size()) != 0 {
+		file.Close() //nolint:errcheck
+		return fmt.Errorf("pwned passwords index '%s' is truncated", idx.filename)
+	}
+
+	if idx.file != nil {
+		idx.file.Close() //nolint:errcheck
+	}
+	idx.file, idx.hashType, idx.records = file, hashType, size/int64(hashType.Size())
+	return nil
+}
+
+// reopen re-opens the index file. If the new file is invalid the current one stays in use.
+func (idx *pwnedIndex) reopen() {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	if err := idx.open(); err != nil {
+		wl.Printf("pwned-index: failed to re-open '%s', keeping the current index: %v", idx.filename, err)
+	}
+}
+
+// reopenOn re-opens the index whenever a signal is received on sig.
+func (idx *pwnedIndex) reopenOn(sig <-chan os.Signal) {
+	for range sig {
+		idx.reopen()
+	}
+}
+
+// Contains looks up password using a binary search on the index file.
+func (idx *pwnedIndex) Contains(password string) (found bool, err error) {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	sum := idx.hashType.Sum(password)
+	record := make([]byte, len(sum))
+	n := sort.Search(int(idx.records), func(i int) bool {
+		if err != nil {
+			return true
+		}
+		_, err = idx.file.ReadAt(record, int64(pwnedIndexHeaderLen)+int64(i)*int64(len(record)))
+		return bytes.Compare(record, sum) >= 0
+	})
+	if err != nil || int64(n) >= idx.records {
+		return false, err
+	}
+	if _, err = idx.file.ReadAt(record, int64(pwnedIndexHeaderLen)+int64(n)*int64(len(record))); err != nil {
+		return false, err
+	}
+	return bytes.Equal(record, sum), nil
+}
+
+var errPasswordPwned = errors.New("password has been found in a list of breached passwords")
+
+type pwnedPolicy struct {
+	index *pwnedIndex
+}
+
+func (p pwnedPolicy) Check(password, username string) (bool, error) {
+	found, err := p.index.Contains(password)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up password in pwned passwords index: %v", err)
+	}
+	if found {
+		return false, errPasswordPwned
+	}
+	return true, nil
+}
+
+func (p pwnedPolicy) Feedback(password, username string) PolicyFeedback {
+	f := zxcvbnFeedback(zxcvbnStrength(password, username))
+	f.OK = true
+	if ok, err := p.Check(password, username); !ok {
+		f.OK = false
+		f.Warnings = append([]string{err.Error()}, f.Warnings...)
+	}
+	return f
+}
+
+func newPwnedPolicy(indexfile string) (p pwnedPolicy, err error) {
+	p.index, err = openPwnedIndex(indexfile)
+	return
+}
+
+// buildPwnedIndex converts a Pwned Passwords dump, which contains lines of the form
+// <hex-hash>:<count> ordered by hash, into an index. Hashes which were seen less than
+// minCount times are skipped. It returns the number of hashes written.
+func buildPwnedIndex(dump io.Reader, index io.Writer, hashType pwnedHashType, minCount uint64) (n int64, err error) {
+	w := bufio.NewWriter(index)
+	w.WriteString(pwnedIndexMagic) //nolint:errcheck
+	w.WriteByte(byte(hashType))    //nolint:errcheck
+
+	scanner := bufio.NewScanner(dump)
+	var last []byte
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		hashStr, countStr, _ := strings.Cut(text, ":")
+		hash, err := hex.DecodeString(hashStr)
+		if err != nil || len(hash) != hashType.Size() {
+			return n, fmt.Errorf("line %d: invalid hash '%s'", line, hashStr)
+		}
+		if last != nil && bytes.Compare(last, hash) >= 0 {
+			return n, fmt.Errorf("line %d: the dump must be ordered by hash", line)
+		}
+		last = hash
+
+		if countStr != "" && minCount > 1 {
+			count, err := strconv.ParseUint(strings.TrimSpace(countStr), 10, 64)
+			if err != nil {
+				return n, fmt.Errorf("line %d: invalid count '%s'", line, countStr)
+			}
+			if count < minCount {
+				continue
+			}
+		}
+		if _, err := w.Write(hash); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := scanner.Err(); err != nil {
+		return n, err
+	}
+	return n, w.Flush()
+}
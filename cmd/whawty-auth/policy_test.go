@@ -0,0 +1,366 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/nbutton23/zxcvbn-go/match"
+	"github.com/nbutton23/zxcvbn-go/scoring"
+)
+
+func TestZXCVBNPolicy(t *testing.T) {
+	for _, condition := range []string{"", "score", "score > 3", "score >= 5", "foo >= 3", "score >= x"} {
+		if _, err := newZXCVBNPolicy(condition); err == nil {
+			t.Errorf("invalid condition '%s' was accepted", condition)
+		}
+	}
+
+	p, err := newZXCVBNPolicy("score >= 3")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if ok, _ := p.Check("password", "alice"); ok {
+		t.Error("weak password was accepted")
+	}
+	if ok, _ := p.Check("correct horse battery staple", "alice"); !ok {
+		t.Error("strong password was rejected")
+	}
+	if f := p.Feedback("password", "alice"); f.OK || len(f.Warnings) == 0 || len(f.Suggestions) == 0 {
+		t.Errorf("feedback for weak password is wrong: %+v", f)
+	}
+}
+
+func TestZXCVBNHints(t *testing.T) {
+	const another = "Add another word or two, uncommon words are better"
+	testvectors := []struct {
+		matches     []match.Match
+		warnings    []string
+		suggestions []string
+	}{
+		{nil, []string{}, []string{another}},
+		{[]match.Match{{Pattern: "dictionary", DictionaryName: "Passwords"}},
+			[]string{"This is similar to a commonly used password"}, []string{another}},
+		{[]match.Match{{Pattern: "dictionary", DictionaryName: "English_3117"}},
+			[]string{"A word by itself is easy to guess"}, []string{"Predictable substitutions like '@' instead of 'a' don't help very much", another}},
+		// every hint is only reported once
+		{[]match.Match{{Pattern: "dictionary", DictionaryName: "MaleNames"}, {Pattern: "dictionary", DictionaryName: "Surname"}},
+			[]string{"Names and surnames by themselves are easy to guess"}, []string{another}},
+		{[]match.Match{{Pattern: "dictionary", DictionaryName: "user_inputs"}, {Pattern: "bruteforce"}},
+			[]string{"Passwords containing the username are easy to guess"}, []string{another}},
+		{[]match.Match{{Pattern: "spatial"}, {Pattern: "repeat"}},
+			[]string{"Keyboard patterns are easy to guess", "Repeats like 'aaa' or 'abcabc' are easy to guess"},
+			[]string{"Use a longer keyboard pattern with more turns", "Avoid repeated words and characters", another}},
+		{[]match.Match{{Pattern: "sequence"}, {Pattern: "date"}},
+			[]string{"Sequences like 'abc' or '6543' are easy to guess", "Dates are often easy to guess"},
+			[]string{"Avoid sequences", "Avoid dates and years that are associated with you", another}},
+	}
+	for _, vector := range testvectors {
+		warnings, suggestions := zxcvbnHints(scoring.MinEntropyMatch{Score: 1, MatchSequence: vector.matches})
+		if !slices.Equal(warnings, vector.warnings) || !slices.Equal(suggestions, vector.suggestions) {
+			t.Errorf("%+v: expected %q %q, got %q %q", vector.matches, vector.warnings, vector.suggestions, warnings, suggestions)
+		}
+	}
+
+	// like the original zxcvbn only weak passwords get hints, the lists must not be nil
+	// so they are encoded as []
+	warnings, suggestions := zxcvbnHints(scoring.MinEntropyMatch{Score: 3, MatchSequence: []match.Match{{Pattern: "spatial"}}})
+	if warnings == nil || suggestions == nil || len(warnings) != 0 || len(suggestions) != 0 {
+		t.Errorf("strong password should get empty hints, got %q %q", warnings, suggestions)
+	}
+
+	warnings, _ = zxcvbnHints(zxcvbnStrength("alice", "alice"))
+	if !slices.Equal(warnings, []string{"Passwords containing the username are easy to guess"}) {
+		t.Errorf("username should be rejected as password, got %q", warnings)
+	}
+}
+
+func writePolicyTestFile(t *testing.T, dir, name, content string) string {
+	filename := filepath.Join(dir, name)
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	return filename
+}
+
+func TestCompositePolicy(t *testing.T) {
+	dir := t.TempDir()
+	writePolicyTestFile(t, dir, "banned.txt", "# comment\nWhawty\n\nsecret\n")
+	policyfile := writePolicyTestFile(t, dir, "policy.yml", `
+all:
+  - min-length: 8
+  - max-length: 20
+  - not-username: true
+  - banned-words: banned.txt
+  - name: complexity
+    any:
+      - character-classes:
+          required: [ upper, digit ]
+      - min-length: 16
+`)
+
+	p, err := NewPasswordPolicy("composite", policyfile)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	testvectors := []struct {
+		password string
+		rule     string
+	}{
+		{"Abcdef1", "min-length 8"},
+		{"Abcdefghijklmnopqrst1", "max-length 20"},
+		{"xAliceX12", "not-username"},
+		{"My-WHAWTY-1", "banned-words"},
+		{"abcdefgh", "complexity"},
+		{"Abcdefgh1", ""},
+		{"abcdefghijklmnop", ""},
+	}
+	for _, vector := range testvectors {
+		ok, err := p.Check(vector.password, "alice")
+		if vector.rule == "" {
+			if !ok || err != nil {
+				t.Errorf("password '%s' was rejected: %v", vector.password, err)
+			}
+			continue
+		}
+		if ok || err == nil {
+			t.Errorf("password '%s' was accepted", vector.password)
+			continue
+		}
+		if !strings.Contains(err.Error(), "'"+vector.rule+"'") {
+			t.Errorf("error for password '%s' doesn't name rule '%s': %v", vector.password, vector.rule, err)
+		}
+	}
+
+	if f := p.Feedback("abcdefgh", "alice"); f.OK || len(f.Warnings) == 0 || !strings.Contains(f.Warnings[0], "complexity") {
+		t.Errorf("feedback doesn't contain the failed rule: %+v", f)
+	}
+}
+
+func TestCompositePolicyInvalid(t *testing.T) {
+	dir := t.TempDir()
+	for _, config := range []string{
+		"min-length: 8\nmax-length: 20\n",
+		"all: []\n",
+		"unknown-rule: 3\n",
+		"character-classes:\n  required: [ emoji ]\n",
+		"banned-words: does-not-exist.txt\n",
+		"zxcvbn: score >= 7\n",
+	} {
+		if _, err := newCompositePolicy(writePolicyTestFile(t, dir, "policy.yml", config)); err == nil {
+			t.Errorf("invalid policy was accepted: %q", config)
+		}
+	}
+}
+
+func TestPwnedPolicy(t *testing.T) {
+	for _, hash := range []string{"sha1", "ntlm"} {
+		hashType, err := parsePwnedHashType(hash)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		var sums []string
+		for _, password := range []string{"password", "123456", "qwerty", "seen-once"} {
+			sums = append(sums, strings.ToUpper(hex.EncodeToString(hashType.Sum(password))))
+		}
+		sort.Strings(sums)
+		var dump strings.Builder
+		for _, sum := range sums {
+			count := 100
+			if sum == strings.ToUpper(hex.EncodeToString(hashType.Sum("seen-once"))) {
+				count = 1
+			}
+			fmt.Fprintf(&dump, "%s:%d\r\n", sum, count)
+		}
+
+		indexfile := filepath.Join(t.TempDir(), "index")
+		index, err := os.Create(indexfile)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		n, err := buildPwnedIndex(strings.NewReader(dump.String()), index, hashType, 2)
+		index.Close() //nolint:errcheck
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if n != 3 {
+			t.Fatalf("index should contain 3 hashes but contains %d", n)
+		}
+
+		p, err := NewPasswordPolicy("pwned", indexfile)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		for _, password := range []string{"password", "123456", "qwerty"} {
+			if ok, err := p.Check(password, "alice"); ok || err != errPasswordPwned {
+				t.Errorf("%s: breached password '%s' was accepted: %v", hash, password, err)
+			}
+		}
+		for _, password := range []string{"seen-once", "correct horse battery staple", "0", "zzzzzzzz"} {
+			if ok, err := p.Check(password, "alice"); !ok || err != nil {
+				t.Errorf("%s: password '%s' was rejected: %v", hash, password, err)
+			}
+		}
+	}
+}
+
+func TestPwnedIndexUnsorted(t *testing.T) {
+	dump := "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF:1\n0000000000000000000000000000000000000000:1\n"
+	var index bytes.Buffer
+	if _, err := buildPwnedIndex(strings.NewReader(dump), &index, pwnedHashSHA1, 1); err == nil {
+		t.Fatal("unsorted dump was accepted")
+	}
+	if _, err := buildPwnedIndex(strings.NewReader("0000:1\n"), &index, pwnedHashSHA1, 1); err == nil {
+		t.Fatal("dump with wrong hash type was accepted")
+	}
+}
+
+func writePwnedTestIndex(t *testing.T, indexfile string, passwords ...string) {
+	var sums []string
+	for _, password := range passwords {
+		sums = append(sums, strings.ToUpper(hex.EncodeToString(pwnedHashSHA1.Sum(password))))
+	}
+	sort.Strings(sums)
+	var index bytes.Buffer
+	if _, err := buildPwnedIndex(strings.NewReader(strings.Join(sums, "\n")), &index, pwnedHashSHA1, 1); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	// the index gets replaced just like the pwned-index command does it
+	tmp := indexfile + ".tmp"
+	if err := os.WriteFile(tmp, index.Bytes(), 0600); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := os.Rename(tmp, indexfile); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func TestPwnedIndexReopen(t *testing.T) {
+	indexfile := filepath.Join(t.TempDir(), "index")
+	writePwnedTestIndex(t, indexfile, "password")
+	idx, err := openPwnedIndex(indexfile)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	writePwnedTestIndex(t, indexfile, "qwerty", "123456")
+	if found, err := idx.Contains("qwerty"); err != nil || found {
+		t.Fatalf("index should not change before it is re-opened: %t, %v", found, err)
+	}
+	idx.reopen()
+	if found, err := idx.Contains("qwerty"); err != nil || !found {
+		t.Fatalf("password of the new index wasn't found: %t, %v", found, err)
+	}
+	if found, err := idx.Contains("password"); err != nil || found {
+		t.Fatalf("password of the old index was found: %t, %v", found, err)
+	}
+
+	// an invalid index is ignored and the current one stays in use
+	if err := os.WriteFile(indexfile+".tmp", []byte("invalid"), 0600); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := os.Rename(indexfile+".tmp", indexfile); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	idx.reopen()
+	if found, err := idx.Contains("123456"); err != nil || !found {
+		t.Fatalf("invalid index replaced the current one: %t, %v", found, err)
+	}
+}
+
+func TestPolicySelector(t *testing.T) {
+	dir := t.TempDir()
+	userpolicies := writePolicyTestFile(t, dir, "user-policies.yml", `
+policies:
+  - name: service
+    users: '^svc-'
+    admin: false
+    type: zxcvbn
+    condition: 'score >= 1'
+  - name: operators
+    users: '^ops-'
+    type: zxcvbn
+    condition: 'score >= 3'
+`)
+
+	p, err := newPolicySelector(policyConfig{Type: "zxcvbn", Condition: "score >= 2",
+		AdminType: "zxcvbn", AdminCondition: "score >= 4", UserPolicies: userpolicies})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	testvectors := []struct {
+		username string
+		isAdmin  bool
+		policy   string
+	}{
+		{"alice", false, policyNameDefault},
+		{"alice", true, policyNameAdmin},
+		{"svc-backup", false, "service"},
+		{"svc-backup", true, policyNameAdmin},
+		{"ops-bob", false, "operators"},
+		{"ops-bob", true, "operators"},
+	}
+	for _, vector := range testvectors {
+		if name, _ := p.Select(vector.username, vector.isAdmin); name != vector.policy {
+			t.Errorf("user '%s' (admin: %t) should use policy '%s' but got '%s'", vector.username, vector.isAdmin, vector.policy, name)
+		}
+	}
+
+	p, err = newPolicySelector(policyConfig{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if name, _ := p.Select("alice", true); name != policyNameDefault {
+		t.Errorf("admins should use the default policy if no admin policy is configured but got '%s'", name)
+	}
+
+	for _, c := range []string{
+		"policies:\n  - name: admin\n    type: zxcvbn\n    condition: 'score >= 1'\n",
+		"policies:\n  - name: a\n  - name: a\n",
+		"policies:\n  - name: a\n    users: '('\n",
+		"policies:\n  - name: a\n    type: unknown\n",
+	} {
+		if _, err := newPolicySelector(policyConfig{UserPolicies: writePolicyTestFile(t, dir, "invalid.yml", c)}); err == nil {
+			t.Errorf("invalid user policies were accepted:\n%s", c)
+		}
+	}
+}
@@ -31,17 +31,55 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net"
 	"os"
+	"time"
 
 	"github.com/whawty/auth/sasl"
 )
 
-func callback(login, password, service, realm, path string, store *Store) (ok bool, msg string, err error) {
-	wdl.Printf("auth request on '%s': [user=%s] [service=%s] [realm=%s]", path, login, service, realm)
+// saslRemote returns the client address of a connection. Clients connected using a unix
+// socket have no address, so they are only throttled per user.
+func saslRemote(info sasl.ConnInfo) string {
+	if addr, ok := info.RemoteAddr.(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+	return ""
+}
 
-	ok, _, _, err = store.Authenticate(login, password)
-	if err != nil {
+// saslClientCert returns the subject of the verified client certificate of a connection.
+// It is empty for connections without TLS or client certificate.
+func saslClientCert(info sasl.ConnInfo) string {
+	if info.TLS == nil || len(info.TLS.VerifiedChains) == 0 || len(info.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return info.TLS.VerifiedChains[0][0].Subject.String()
+}
+
+func callback(info sasl.ConnInfo, login, password, service, realm, path string, store *Store) (ok bool, msg string, err error) {
+	remote := saslRemote(info)
+	clientCert := saslClientCert(info)
+	wdl.Printf("auth request on '%s' from '%s' [cert=%s]: [user=%s] [service=%s] [realm=%s]", path, remote, clientCert, login, service, realm)
+
+	// sasl.Client.Ping sends an empty login, this must neither be throttled nor audited
+	if login == "" {
+		return false, "wrong credentials", nil
+	}
+	ok, _, appPassword, err := store.AuthenticateWithAppPasswords(login, password, remote)
+	detail := fmt.Sprintf("service=%s realm=%s", service, realm)
+	if clientCert != "" {
+		detail += fmt.Sprintf(" client-cert=%q", clientCert)
+	}
+	if appPassword != "" {
+		detail += " " + auditAppPasswordDetail(appPassword)
+	}
+	ok, err = authorizeService(store, login, service, ok, err)
+	audit.LogAuth(auditRecord{Frontend: "sasl", Remote: remote, User: login, Detail: detail}, ok, err)
+	// a service which is not allowed must not reveal that the password was correct
+	if err != nil && !errors.Is(err, errServiceNotAllowed) {
 		return false, "", err
 	}
 	if ok {
@@ -53,35 +91,114 @@ func callback(login, password, service, realm, path string, store *Store) (ok bo
 	return ok, msg, nil
 }
 
-func runSaslAuthSocket(path string, store *Store) error {
+const (
+	saslDefaultMaxConnections  = 100
+	saslDefaultShutdownTimeout = 10 * time.Second
+)
+
+// apply configures s using the settings of config. Unset values keep the defaults.
+func (config saslServerConfig) apply(s *sasl.Server) {
+	s.MaxConnections = saslDefaultMaxConnections
+	if config.MaxConnections > 0 {
+		s.MaxConnections = config.MaxConnections
+	}
+	if config.ReadTimeout > 0 {
+		s.ReadTimeout = config.ReadTimeout
+	}
+	if config.WriteTimeout > 0 {
+		s.WriteTimeout = config.WriteTimeout
+	}
+}
+
+func (config saslServerConfig) shutdownTimeout() time.Duration {
+	if config.ShutdownTimeout > 0 {
+		return config.ShutdownTimeout
+	}
+	return saslDefaultShutdownTimeout
+}
+
+// runSaslServer runs s until ctx is done. After that in-flight authentications have
+// the configured shutdown timeout to complete.
+func runSaslServer(ctx context.Context, s *sasl.Server, name string, config saslServerConfig) {
+	config.apply(s)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Run()
+	}()
+	select {
+	case err := <-errCh:
+		wl.Printf("error on sasl socket '%s': %s", name, err)
+		return
+	case <-ctx.Done():
+	}
+
+	wl.Printf("sasl socket '%s': shutting down", name)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.shutdownTimeout())
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		wl.Printf("sasl socket '%s': failed to finish all authentications: %s", name, err)
+	}
+	<-errCh
+}
+
+func runSaslAuthSocket(ctx context.Context, path string, config *saslauthdConfig, store *Store) error {
 	os.Remove(path) //nolint:errcheck
-	s, err := sasl.NewServer(path, func(log string, pwd string, srv string, rlm string) (bool, string, error) {
-		return callback(log, pwd, srv, rlm, path, store)
-	})
+	s, err := sasl.NewServer(path, nil)
 	if err != nil {
 		return err
 	}
+	s.ConnCallback = func(info sasl.ConnInfo, log string, pwd string, srv string, rlm string) (bool, string, error) {
+		return callback(info, log, pwd, srv, rlm, path, store)
+	}
 	wl.Printf("listening on '%s'", path)
 
 	defer os.Remove(path) //nolint:errcheck
-	if err := s.Run(); err != nil {
-		wl.Printf("error on sasl socket '%s': %s", path, err)
-	}
+	runSaslServer(ctx, s, path, config.saslServerConfig)
 	return nil
 }
 
-func runSaslAuthSocketListener(listener *net.UnixListener, store *Store) error {
+func runSaslAuthSocketListener(ctx context.Context, listener *net.UnixListener, config *saslauthdConfig, store *Store) error {
 	path := listener.Addr().String()
-	s, err := sasl.NewServerFromListener(listener, func(log string, pwd string, srv string, rlm string) (bool, string, error) {
-		return callback(log, pwd, srv, rlm, path, store)
-	})
+	s, err := sasl.NewServerFromListener(listener, nil)
 	if err != nil {
 		return err
 	}
+	s.ConnCallback = func(info sasl.ConnInfo, log string, pwd string, srv string, rlm string) (bool, string, error) {
+		return callback(info, log, pwd, srv, rlm, path, store)
+	}
 	wl.Printf("listening on '%s'", path)
 
-	if err := s.Run(); err != nil {
-		wl.Printf("error on sasl socket '%s': %s", path, err)
+	runSaslServer(ctx, s, path, config.saslServerConfig)
+	return nil
+}
+
+func runSaslAuthTLSListener(ctx context.Context, listener *net.TCPListener, config *saslauthdTLSConfig, store *Store) error {
+	if config.TLS == nil {
+		return errors.New("saslauthd-tls: no TLS configuration found")
+	}
+	tlsConfig, err := config.TLS.ToGoTLSConfig()
+	if err != nil {
+		return err
+	}
+	addr := listener.Addr().String()
+	s, err := sasl.NewTLSServerFromListener(listener, tlsConfig, nil)
+	if err != nil {
+		return err
+	}
+	s.ConnCallback = func(info sasl.ConnInfo, log string, pwd string, srv string, rlm string) (bool, string, error) {
+		return callback(info, log, pwd, srv, rlm, addr, store)
 	}
+	wl.Printf("listening on '%s' using TLS", addr)
+
+	runSaslServer(ctx, s, addr, config.saslServerConfig)
 	return nil
 }
+
+func runSaslAuthTLSAddr(ctx context.Context, addr string, config *saslauthdTLSConfig, store *Store) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return runSaslAuthTLSListener(ctx, listener.(*net.TCPListener), config, store)
+}
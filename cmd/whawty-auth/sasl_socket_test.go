@@ -0,0 +1,138 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/whawty/auth/sasl"
+)
+
+func TestSaslConnInfo(t *testing.T) {
+	info := sasl.ConnInfo{RemoteAddr: &net.UnixAddr{Name: "@", Net: "unix"}}
+	if remote := saslRemote(info); remote != "" {
+		t.Errorf("unix socket connections should have no remote address, got '%s'", remote)
+	}
+	if cert := saslClientCert(info); cert != "" {
+		t.Errorf("connections without TLS should have no client certificate, got '%s'", cert)
+	}
+
+	info = sasl.ConnInfo{RemoteAddr: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1234}, TLS: &tls.ConnectionState{}}
+	if remote := saslRemote(info); remote != "192.0.2.1" {
+		t.Errorf("wrong remote address '%s'", remote)
+	}
+	if cert := saslClientCert(info); cert != "" {
+		t.Errorf("connections without client certificate should have no subject, got '%s'", cert)
+	}
+
+	// unverified peer certificates must be ignored
+	client := &x509.Certificate{Subject: pkix.Name{CommonName: "mail.example.com", Organization: []string{"example"}}}
+	info.TLS.PeerCertificates = []*x509.Certificate{client}
+	if cert := saslClientCert(info); cert != "" {
+		t.Errorf("unverified client certificate was used: '%s'", cert)
+	}
+	info.TLS.VerifiedChains = [][]*x509.Certificate{{client}}
+	if cert := saslClientCert(info); cert != "CN=mail.example.com,O=example" {
+		t.Errorf("wrong client certificate subject '%s'", cert)
+	}
+}
+
+func TestSaslServerConfig(t *testing.T) {
+	s := &sasl.Server{ReadTimeout: sasl.DefaultTimeout, WriteTimeout: sasl.DefaultTimeout}
+	config := saslServerConfig{}
+	config.apply(s)
+	if s.MaxConnections != saslDefaultMaxConnections || s.ReadTimeout != sasl.DefaultTimeout || s.WriteTimeout != sasl.DefaultTimeout {
+		t.Errorf("unset values should keep the defaults: %+v", s)
+	}
+	if timeout := config.shutdownTimeout(); timeout != saslDefaultShutdownTimeout {
+		t.Errorf("wrong default shutdown timeout %v", timeout)
+	}
+
+	config = saslServerConfig{MaxConnections: 5, ReadTimeout: time.Second, WriteTimeout: 2 * time.Second, ShutdownTimeout: 3 * time.Second}
+	config.apply(s)
+	if s.MaxConnections != 5 || s.ReadTimeout != time.Second || s.WriteTimeout != 2*time.Second {
+		t.Errorf("configured values were not applied: %+v", s)
+	}
+	if timeout := config.shutdownTimeout(); timeout != 3*time.Second {
+		t.Errorf("wrong shutdown timeout %v", timeout)
+	}
+}
+
+func TestSaslPing(t *testing.T) {
+	store := newTestStore(t, policyConfig{}, "")
+	// the path of unix sockets is limited to about 100 characters
+	dir, err := os.MkdirTemp("", "whawty-sasl")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer os.RemoveAll(dir) //nolint:errcheck
+	path := filepath.Join(dir, "sock")
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runSaslAuthSocketListener(ctx, ln, &saslauthdConfig{}, store) //nolint:errcheck
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	c := sasl.NewClient(path)
+	info := sasl.ConnInfo{RemoteAddr: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1234}}
+	for i := 0; i < 10; i++ {
+		if err := c.Ping(context.Background()); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if ok, msg, err := callback(info, "", "", "", "", "test", store); ok || msg != "wrong credentials" || err != nil {
+			t.Fatalf("the empty login should be answered with wrong credentials, got %t, '%s', %v", ok, msg, err)
+		}
+	}
+	list, err := store.ListThrottled()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(list) != 0 {
+		t.Fatalf("pings must not be throttled, got %v", list)
+	}
+}
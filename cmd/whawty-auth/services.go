@@ -0,0 +1,115 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	lib "github.com/whawty/auth/store"
+	"gopkg.in/yaml.v3"
+)
+
+const serviceAll = lib.ServiceAll
+
+var errServiceNotAllowed = errors.New("service is not allowed")
+
+type serviceRulesConfig struct {
+	Default []string            `yaml:"default"`
+	Roles   map[string][]string `yaml:"roles"`
+}
+
+// serviceRules decides which services users without their own list of services may
+// authenticate for. A nil *serviceRules allows all services.
+type serviceRules struct {
+	defaults []string
+	roles    map[string][]string
+}
+
+func readServiceRules(configfile string) (*serviceRulesConfig, error) {
+	file, err := os.Open(configfile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close() //nolint:errcheck
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+
+	c := &serviceRulesConfig{}
+	if err = decoder.Decode(c); err != nil {
+		return nil, fmt.Errorf("failed to parse service rules file: %s", err)
+	}
+	return c, nil
+}
+
+func newServiceRules(configfile string) (*serviceRules, error) {
+	if configfile == "" {
+		return nil, nil
+	}
+	c, err := readServiceRules(configfile)
+	if err != nil {
+		return nil, err
+	}
+	return &serviceRules{defaults: c.Default, roles: c.Roles}, nil
+}
+
+// Allowed returns whether a user with the given list of services and roles may
+// authenticate for service. The list of the user takes precedence over the rules. In
+// both the service '*' allows all services.
+func (r *serviceRules) Allowed(service string, services, roles []string) bool {
+	if len(services) > 0 {
+		return slices.Contains(services, serviceAll) || slices.Contains(services, service)
+	}
+	if r == nil {
+		return true
+	}
+	allowed := slices.Clone(r.defaults)
+	for _, role := range roles {
+		allowed = append(allowed, r.roles[role]...)
+	}
+	return slices.Contains(allowed, serviceAll) || slices.Contains(allowed, service)
+}
+
+// authorizeService checks whether username may authenticate for service once the
+// credentials have been verified. ok and err are the result of the authentication and
+// are passed through if it failed. If the service is not allowed err is errServiceNotAllowed.
+func authorizeService(store *Store, username, service string, ok bool, err error) (bool, error) {
+	if !ok || err != nil {
+		return ok, err
+	}
+	if ok, err = store.CheckService(username, service); err == nil && !ok {
+		err = errServiceNotAllowed
+	}
+	return ok, err
+}
@@ -0,0 +1,120 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServiceRules(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := newServiceRules(writePolicyTestFile(t, dir, "invalid.yml", "defaults: [imap]\n")); err == nil {
+		t.Fatal("unknown field was accepted")
+	}
+	if rules, err := newServiceRules(""); err != nil || rules != nil {
+		t.Fatalf("no rules file should allow all services: %v, %v", rules, err)
+	}
+
+	rules, err := newServiceRules(writePolicyTestFile(t, dir, "services.yml", `
+default: [ imap, smtp ]
+roles:
+  chat: [ xmpp ]
+  ops: [ '*' ]
+`))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	testvectors := []struct {
+		service  string
+		services []string
+		roles    []string
+		ok       bool
+	}{
+		{"imap", nil, nil, true},
+		{"xmpp", nil, nil, false},
+		{"xmpp", nil, []string{"chat"}, true},
+		{"sieve", nil, []string{"chat"}, false},
+		{"sieve", nil, []string{"ops"}, true},
+		{"sieve", []string{"sieve"}, nil, true},
+		{"imap", []string{"sieve"}, []string{"ops"}, false},
+		{"", []string{"sieve"}, nil, false},
+		{"sieve", []string{"*"}, nil, true},
+		{"imap", []string{"*"}, []string{"chat"}, true},
+	}
+	for _, vector := range testvectors {
+		if ok := rules.Allowed(vector.service, vector.services, vector.roles); ok != vector.ok {
+			t.Errorf("service '%s' (services: %v, roles: %v): expected %t, got %t", vector.service, vector.services, vector.roles, vector.ok, ok)
+		}
+		if ok := (*serviceRules)(nil).Allowed(vector.service, vector.services, vector.roles); ok != (len(vector.services) == 0 || vector.ok) {
+			t.Errorf("service '%s' (services: %v) without rules: got %t", vector.service, vector.services, ok)
+		}
+	}
+}
+
+func TestWebBasicAuthService(t *testing.T) {
+	if _, err := newWebBasicAuth(&webBasicAuthConfig{TrustedProxies: []string{"not-an-address"}}); err == nil {
+		t.Fatal("invalid trusted proxy was accepted")
+	}
+	ba, err := newWebBasicAuth(&webBasicAuthConfig{Service: "http", VHosts: map[string]string{"webmail.example.com": "webmail"}, TrustedProxies: []string{"192.0.2.1"}})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	testvectors := []struct {
+		remote    string
+		host      string
+		forwarded string
+		service   string
+	}{
+		{"192.0.2.1:1234", "auth.example.com", "", "http"},
+		{"192.0.2.1:1234", "webmail.example.com", "", "webmail"},
+		{"192.0.2.1:1234", "webmail.example.com:8443", "", "webmail"},
+		{"192.0.2.1:1234", "auth.example.com", "WebMail.example.com", "webmail"},
+		{"192.0.2.1:1234", "webmail.example.com", "wiki.example.com", "http"},
+		// X-Forwarded-Host is ignored unless the request was sent by a trusted proxy
+		{"192.0.2.2:1234", "auth.example.com", "webmail.example.com", "http"},
+		{"192.0.2.2:1234", "webmail.example.com", "wiki.example.com", "webmail"},
+		{"127.0.0.1:1234", "auth.example.com", "webmail.example.com", "http"},
+	}
+	for _, vector := range testvectors {
+		r := httptest.NewRequest("GET", "/basic-auth", nil)
+		r.RemoteAddr = vector.remote
+		r.Host = vector.host
+		if vector.forwarded != "" {
+			r.Header.Set("X-Forwarded-Host", vector.forwarded)
+		}
+		if service := ba.service(r); service != vector.service {
+			t.Errorf("host '%s' (forwarded: '%s', remote: %s): expected service '%s', got '%s'", vector.host, vector.forwarded, vector.remote, vector.service, service)
+		}
+	}
+}
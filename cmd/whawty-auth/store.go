@@ -32,12 +32,18 @@ package main
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -102,6 +108,50 @@ type setAdminRequest struct {
 	response chan<- setAdminResult
 }
 
+type modifyUserResult struct {
+	created bool
+	err     error
+}
+
+type modifyUserRequest struct {
+	username string
+	password *string
+	isAdmin  *bool
+	create   bool
+	response chan<- modifyUserResult
+}
+
+type setRolesResult struct {
+	err error
+}
+
+type setRolesRequest struct {
+	username string
+	roles    []string
+	response chan<- setRolesResult
+}
+
+type setServicesResult struct {
+	err error
+}
+
+type setServicesRequest struct {
+	username string
+	services []string
+	response chan<- setServicesResult
+}
+
+type checkServiceResult struct {
+	ok  bool
+	err error
+}
+
+type checkServiceRequest struct {
+	username string
+	service  string
+	response chan<- checkServiceResult
+}
+
 type listResult struct {
 	list lib.UserList
 	err  error
@@ -124,31 +174,168 @@ type authenticateResult struct {
 	ok          bool
 	isAdmin     bool
 	upgradeable bool
+	mustChange  bool
 	lastChanged time.Time
-	err         error
+	appPassword string
+	// set if the application password with this hash must be checked by the caller
+	appPasswordHash *lib.AppPasswordHash
+	err             error
 }
 
 type authenticateRequest struct {
-	username string
+	username     string
+	password     string
+	remote       string
+	appPasswords bool
+	response     chan<- authenticateResult
+}
+
+type addAppPasswordResult struct {
 	password string
-	response chan<- authenticateResult
+	err      error
+}
+
+type addAppPasswordRequest struct {
+	username string
+	name     string
+	response chan<- addAppPasswordResult
+}
+
+type removeAppPasswordResult struct {
+	err error
+}
+
+type removeAppPasswordRequest struct {
+	username string
+	name     string
+	response chan<- removeAppPasswordResult
+}
+
+type listAppPasswordsResult struct {
+	list []lib.AppPassword
+	err  error
+}
+
+type listAppPasswordsRequest struct {
+	username string
+	response chan<- listAppPasswordsResult
+}
+
+type throttleListResult struct {
+	list lib.ThrottleList
+	err  error
+}
+
+type throttleListRequest struct {
+	response chan<- throttleListResult
 }
 
+type throttleResetResult struct {
+	found bool
+	err   error
+}
+
+type throttleResetRequest struct {
+	key      string
+	response chan<- throttleResetResult
+}
+
+type readyResult struct {
+	err error
+}
+
+type readyRequest struct {
+	response chan<- readyResult
+}
+
+type createResetTokenResult struct {
+	token   string
+	expires time.Time
+	err     error
+}
+
+type createResetTokenRequest struct {
+	username string
+	validFor time.Duration
+	response chan<- createResetTokenResult
+}
+
+type checkResetTokenResult struct {
+	policyName string
+	policy     PolicyChecker
+	err        error
+}
+
+type checkResetTokenRequest struct {
+	username string
+	token    string
+	remote   string
+	response chan<- checkResetTokenResult
+}
+
+type resetPasswordResult struct {
+	err error
+}
+
+type resetPasswordRequest struct {
+	username   string
+	token      string
+	password   string
+	policyName string
+	remote     string
+	response   chan<- resetPasswordResult
+}
+
+type checkPasswordResult struct {
+	policy PolicyChecker
+}
+
+type checkPasswordRequest struct {
+	username string
+	response chan<- checkPasswordResult
+}
+
+var (
+	errResetTokenInvalid = errors.New("reset token is invalid or expired")
+	errUserNotFound      = errors.New("user does not exist")
+	errPasswordPolicy    = errors.New("password policy checked failed")
+)
+
 type store struct {
-	configfile       string
-	dir              *lib.Dir
-	policy           PolicyChecker
-	hooks            *HooksCaller
-	initChan         chan initRequest
-	checkChan        chan checkRequest
-	addChan          chan addRequest
-	removeChan       chan removeRequest
-	updateChan       chan updateRequest
-	setAdminChan     chan setAdminRequest
-	listChan         chan listRequest
-	listFullChan     chan listFullRequest
-	authenticateChan chan authenticateRequest
-	upgradeChan      chan updateRequest
+	configfile            string
+	dir                   *lib.Dir
+	policies              *policySelector
+	services              *serviceRules
+	hooks                 *HooksCaller
+	throttle              *authThrottle
+	reloadErr             error
+	readiness             readinessConfig
+	resetTokenValidity    time.Duration
+	checker               *readinessChecker
+	initChan              chan initRequest
+	checkChan             chan checkRequest
+	addChan               chan addRequest
+	removeChan            chan removeRequest
+	updateChan            chan updateRequest
+	setAdminChan          chan setAdminRequest
+	modifyUserChan        chan modifyUserRequest
+	setRolesChan          chan setRolesRequest
+	setServicesChan       chan setServicesRequest
+	checkServiceChan      chan checkServiceRequest
+	listChan              chan listRequest
+	listFullChan          chan listFullRequest
+	authenticateChan      chan authenticateRequest
+	upgradeChan           chan updateRequest
+	throttleListChan      chan throttleListRequest
+	throttleResetChan     chan throttleResetRequest
+	readyChan             chan readyRequest
+	addAppPasswordChan    chan addAppPasswordRequest
+	removeAppPasswordChan chan removeAppPasswordRequest
+	listAppPasswordsChan  chan listAppPasswordsRequest
+	createResetTokenChan  chan createResetTokenRequest
+	checkResetTokenChan   chan checkResetTokenRequest
+	resetPasswordChan     chan resetPasswordRequest
+	checkPasswordChan     chan checkPasswordRequest
 }
 
 func (s *store) reload() {
@@ -156,28 +343,52 @@ func (s *store) reload() {
 	newdir, err := lib.NewDirFromConfig(s.configfile)
 	if err != nil {
 		wl.Printf("store: reload failed: %v, keeping current configuration", err)
+		s.reloadErr = err
 		return
 	}
 	if err := newdir.Check(); err != nil {
 		wl.Printf("store: reload failed: %v, keeping current configuration", err)
+		s.reloadErr = err
 		return
 	}
 
+	s.reloadErr = nil
 	s.dir = newdir
+	s.checker.setDir(s.dir)
 	s.hooks.NewStore <- s.dir.BaseDir
 	wl.Printf("store: successfully reloaded")
 }
 
-func (s *store) init(username, password string) (result initResult) {
-	if ok, err := s.policy.Check(password, username); !ok || err != nil {
+// checkPolicy checks password against the policy for username and returns the name of that policy.
+func (s *store) checkPolicy(username, password string, isAdmin bool) (string, error) {
+	name, policy := s.policies.Select(username, isAdmin)
+	if ok, err := policy.Check(password, username); !ok || err != nil {
 		if err != nil {
-			result.err = err
-		} else {
-			result.err = errors.New("password policy checked failed")
+			return name, err
 		}
+		return name, errPasswordPolicy
+	}
+	return name, nil
+}
+
+// recordPolicy stores which policy the password of username has been checked against.
+// The password has already been changed at this point so errors are only logged.
+func (s *store) recordPolicy(username, policy string) {
+	if err := s.dir.SetPasswordPolicy(username, policy); err != nil {
+		wl.Printf("store: failed to record password policy '%s' for '%s': %v", policy, username, err)
+	}
+}
+
+func (s *store) init(username, password string) (result initResult) {
+	policy, err := s.checkPolicy(username, password, true)
+	if err != nil {
+		result.err = err
 		return
 	}
-	result.err = s.dir.Init(username, password)
+	if result.err = s.dir.Init(username, password); result.err == nil {
+		s.recordPolicy(username, policy)
+	}
+	s.checker.recheck()
 	return
 }
 
@@ -187,16 +398,14 @@ func (s *store) check() (result checkResult) {
 }
 
 func (s *store) add(username, password string, isAdmin bool) (result addResult) {
-	if ok, err := s.policy.Check(password, username); !ok || err != nil {
-		if err != nil {
-			result.err = err
-		} else {
-			result.err = errors.New("password policy checked failed")
-		}
+	policy, err := s.checkPolicy(username, password, isAdmin)
+	if err != nil {
+		result.err = err
 		return
 	}
 	result.err = s.dir.AddUser(username, password, isAdmin)
 	if result.err == nil {
+		s.recordPolicy(username, policy)
 		s.hooks.Notify <- true
 	}
 	return
@@ -209,16 +418,19 @@ func (s *store) remove(username string) (result removeResult) {
 }
 
 func (s *store) update(username, password string) (result updateResult) {
-	if ok, err := s.policy.Check(password, username); !ok || err != nil {
-		if err != nil {
-			result.err = err
-		} else {
-			result.err = errors.New("password policy checked failed")
-		}
+	_, isAdmin, err := s.dir.Exists(username)
+	if err != nil {
+		result.err = err
+		return
+	}
+	policy, err := s.checkPolicy(username, password, isAdmin)
+	if err != nil {
+		result.err = err
 		return
 	}
 	result.err = s.dir.UpdateUser(username, password)
 	if result.err == nil {
+		s.recordPolicy(username, policy)
 		s.hooks.Notify <- true
 	}
 	return
@@ -226,12 +438,105 @@ func (s *store) update(username, password string) (result updateResult) {
 
 func (s *store) setAdmin(username string, isAdmin bool) (result setAdminResult) {
 	result.err = s.dir.SetAdmin(username, isAdmin)
+	if result.err != nil {
+		return
+	}
+	if isAdmin {
+		// the current password might have been checked against a weaker policy
+		adminPolicy, _ := s.policies.Select(username, true)
+		current, err := s.dir.GetPasswordPolicy(username)
+		if err == nil && current == "" {
+			current, _ = s.policies.Select(username, false)
+		}
+		if current != adminPolicy {
+			wl.Printf("store: password of '%s' has been checked against policy '%s' instead of '%s', flagging it to be changed", username, current, adminPolicy)
+			if err := s.dir.SetMustChange(username); err != nil {
+				wl.Printf("store: failed to flag password of '%s' to be changed: %v", username, err)
+			}
+		}
+	}
+	s.hooks.Notify <- true
+	return
+}
+
+// modifyUser changes the password and/or the admin status of username. The new password
+// is validated before the first change is written so a failing password policy doesn't
+// leave a half-applied change behind. The password is written before the admin status:
+// if the latter fails the user keeps the new password, which has already been checked
+// against the policy of the requested status. If create is set and the user does not
+// exist it gets added.
+func (s *store) modifyUser(username string, password *string, isAdmin *bool, create bool) (result modifyUserResult) {
+	exists, currentAdmin, err := s.dir.Exists(username)
+	if err != nil {
+		result.err = err
+		return
+	}
+	if !exists {
+		if !create || password == nil {
+			result.err = errUserNotFound
+			return
+		}
+		res := s.add(username, *password, isAdmin != nil && *isAdmin)
+		result.created, result.err = res.err == nil, res.err
+		return
+	}
+
+	admin := currentAdmin
+	if isAdmin != nil {
+		admin = *isAdmin
+	}
+	var policy string
+	if password != nil {
+		if policy, result.err = s.checkPolicy(username, *password, admin); result.err != nil {
+			return
+		}
+	}
+	if password != nil {
+		if result.err = s.dir.UpdateUser(username, *password); result.err != nil {
+			return
+		}
+		// the recorded policy already matches the new admin status so setAdmin won't
+		// flag the new password to be changed
+		s.recordPolicy(username, policy)
+		s.hooks.Notify <- true
+	}
+	if admin != currentAdmin {
+		result.err = s.setAdmin(username, admin).err
+	}
+	return
+}
+
+func (s *store) setRoles(username string, roles []string) (result setRolesResult) {
+	result.err = s.dir.SetRoles(username, roles)
+	if result.err == nil {
+		s.hooks.Notify <- true
+	}
+	return
+}
+
+func (s *store) setServices(username string, services []string) (result setServicesResult) {
+	result.err = s.dir.SetServices(username, services)
 	if result.err == nil {
 		s.hooks.Notify <- true
 	}
 	return
 }
 
+func (s *store) checkService(username, service string) (result checkServiceResult) {
+	services, err := s.dir.GetServices(username)
+	if err != nil {
+		result.err = err
+		return
+	}
+	roles, err := s.dir.GetRoles(username)
+	if err != nil {
+		result.err = err
+		return
+	}
+	result.ok = s.services.Allowed(service, services, roles)
+	return
+}
+
 func (s *store) list() (result listResult) {
 	result.list, result.err = s.dir.List()
 	return
@@ -242,14 +547,265 @@ func (s *store) listFull() (result listFullResult) {
 	return
 }
 
-func (s *store) authenticate(username, password string) (result authenticateResult) {
+// readinessConfig holds the parameters of the readiness check. Timeout is the time to wait
+// for the store dispatcher. Since checking the consistency of a large store directory is
+// expensive it is only run every CheckInterval.
+type readinessConfig struct {
+	Timeout       time.Duration
+	CheckInterval time.Duration
+}
+
+// readinessChecker runs the consistency check of the store directory in its own goroutine
+// so the dispatcher never has to scan the directory. The dispatcher only reads the result
+// of the last check.
+type readinessChecker struct {
+	mutex   sync.Mutex
+	dir     *lib.Dir
+	err     error
+	trigger chan struct{}
+}
+
+func newReadinessChecker(dir *lib.Dir) *readinessChecker {
+	return &readinessChecker{dir: dir, err: errors.New("store has not been checked yet"), trigger: make(chan struct{}, 1)}
+}
+
+// setDir replaces the directory to check. The caller has already checked dir.
+func (c *readinessChecker) setDir(dir *lib.Dir) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.dir, c.err = dir, nil
+}
+
+// recheck asks for a check before the next interval has passed.
+func (c *readinessChecker) recheck() {
+	select {
+	case c.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (c *readinessChecker) result() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
+
+func (c *readinessChecker) check() {
+	c.mutex.Lock()
+	dir := c.dir
+	c.mutex.Unlock()
+
+	err := dir.Check()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.dir == dir { // the directory might have been replaced by a reload in the meantime
+		c.err = err
+	}
+}
+
+func (c *readinessChecker) run(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		c.check()
+		select {
+		case <-t.C:
+		case <-c.trigger:
+		}
+	}
+}
+
+func (s *store) authenticate(username, password, remote string, appPasswords bool) (result authenticateResult) {
+	if ok, retryAfter := s.throttle.allow(username, remote); !ok {
+		wl.Printf("store: throttling authentication of '%s' from '%s'", username, remote)
+		result.err = fmt.Errorf("too many failed authentication attempts, try again in %v", retryAfter.Round(time.Second))
+		return
+	}
+
 	result.ok, result.isAdmin, result.upgradeable, result.lastChanged, result.err = s.dir.Authenticate(username, password)
-	if result.ok && result.upgradeable && s.upgradeChan != nil {
+	if !result.ok && appPasswords {
+		// checking the application password is expensive, it is done by the caller so the
+		// dispatcher is not blocked. The caller also updates the throttle state.
+		if hash, isAdmin, err := s.dir.FindAppPassword(username, password); err == nil && hash != nil {
+			return authenticateResult{isAdmin: isAdmin, appPasswordHash: hash}
+		}
+	}
+	if !result.ok {
+		s.throttle.failure(username, remote)
+		return
+	}
+	s.throttle.success(username)
+	if !appPasswords {
+		// only the frontends which don't accept application passwords are able to tell
+		// the user to change the password
+		result.mustChange, _ = s.dir.MustChange(username)
+	}
+	if result.upgradeable && s.upgradeChan != nil {
 		s.upgradeChan <- updateRequest{username: username, password: password}
 	}
 	return
 }
 
+// generateAppPassword returns a random password of 24 lowercase letters and digits,
+// grouped in blocks of four to make it easier to copy it to other devices. The first
+// block is used as tag of the application password and stored in clear text, the
+// remaining 100 bits are secret.
+func generateAppPassword() (string, error) {
+	buf := make([]byte, 15)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	encoded := strings.ToLower(base32.StdEncoding.EncodeToString(buf))
+	var groups []string
+	for i := 0; i < len(encoded); i += 4 {
+		groups = append(groups, encoded[i:i+4])
+	}
+	return strings.Join(groups, "-"), nil
+}
+
+func (s *store) addAppPassword(username, name string) (result addAppPasswordResult) {
+	// the tag of the new password may collide with an existing one, just try again
+	for i := 0; i < 3; i++ {
+		if result.password, result.err = generateAppPassword(); result.err != nil {
+			return
+		}
+		if result.err = s.dir.AddAppPassword(username, name, result.password); result.err != lib.ErrAppPasswordTagInUse {
+			break
+		}
+	}
+	if result.err != nil {
+		result.password = ""
+		return
+	}
+	s.hooks.Notify <- true
+	return
+}
+
+func (s *store) removeAppPassword(username, name string) (result removeAppPasswordResult) {
+	result.err = s.dir.RemoveAppPassword(username, name)
+	if result.err == nil {
+		s.hooks.Notify <- true
+	}
+	return
+}
+
+func (s *store) listAppPasswords(username string) (result listAppPasswordsResult) {
+	result.list, result.err = s.dir.ListAppPasswords(username)
+	return
+}
+
+func (s *store) createResetToken(username string, validFor time.Duration) (result createResetTokenResult) {
+	if exists, _, err := s.dir.Exists(username); err != nil {
+		result.err = err
+		return
+	} else if !exists {
+		result.err = fmt.Errorf("user '%s' does not exist", username)
+		return
+	}
+
+	buf := make([]byte, 32)
+	if _, result.err = rand.Read(buf); result.err != nil {
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	expires := time.Now().Add(validFor).Truncate(time.Second)
+	if result.err = s.dir.SetResetToken(username, token, expires); result.err != nil {
+		return
+	}
+	result.token, result.expires = token, expires
+	return
+}
+
+// checkResetToken checks the reset token of username without using it up and returns the
+// password policy of the user. The token is checked first so the policy gives nobody
+// without a valid token any hint about the user. Rating the new password is expensive, it
+// is done by the caller so the dispatcher is not blocked.
+func (s *store) checkResetToken(username, token, remote string) (result checkResetTokenResult) {
+	if ok, retryAfter := s.throttle.allow(username, remote); !ok {
+		wl.Printf("store: throttling password reset of '%s' from '%s'", username, remote)
+		result.err = fmt.Errorf("too many failed attempts, try again in %v", retryAfter.Round(time.Second))
+		return
+	}
+	if ok, err := s.dir.CheckResetToken(username, token); err != nil || !ok {
+		if err != nil {
+			wdl.Printf("store: checking reset token of '%s' failed: %v", username, err)
+		}
+		s.throttle.failure(username, remote)
+		result.err = errResetTokenInvalid
+		return
+	}
+
+	_, isAdmin, err := s.dir.Exists(username)
+	if err != nil {
+		result.err = err
+		return
+	}
+	result.policyName, result.policy = s.policies.Select(username, isAdmin)
+	return
+}
+
+// resetPassword uses up the reset token of username and sets the new password, which has
+// already been checked against the policy named policyName by the caller.
+func (s *store) resetPassword(username, token, password, policyName, remote string) (result resetPasswordResult) {
+	_, isAdmin, err := s.dir.Exists(username)
+	if err != nil {
+		result.err = err
+		return
+	}
+	// the admin status of the user might have changed in between
+	if name, _ := s.policies.Select(username, isAdmin); name != policyName {
+		result.err = fmt.Errorf("the password policy of '%s' has changed, please try again", username)
+		return
+	}
+
+	// the token is removed before the password is changed: if the update fails the token
+	// is gone but it can never be used twice
+	if ok, err := s.dir.ConsumeResetToken(username, token); err != nil || !ok {
+		if err != nil {
+			wdl.Printf("store: checking reset token of '%s' failed: %v", username, err)
+		}
+		s.throttle.failure(username, remote)
+		result.err = errResetTokenInvalid
+		return
+	}
+	s.throttle.success(username)
+
+	if result.err = s.dir.UpdateUser(username, password); result.err != nil {
+		return
+	}
+	s.recordPolicy(username, policyName)
+	s.hooks.Notify <- true
+	return
+}
+
+// checkPassword only selects the policy of username, rating the password is done by the
+// caller so the dispatcher isn't blocked by it.
+func (s *store) checkPassword(username string) (result checkPasswordResult) {
+	_, isAdmin, _ := s.dir.Exists(username)
+	_, result.policy = s.policies.Select(username, isAdmin)
+	return
+}
+
+func (s *store) throttleList() (result throttleListResult) {
+	result.list = s.throttle.list()
+	return
+}
+
+func (s *store) throttleReset(key string) (result throttleResetResult) {
+	result.found = s.throttle.reset(key)
+	return
+}
+
+func (s *store) ready() (result readyResult) {
+	if s.reloadErr != nil {
+		result.err = fmt.Errorf("last reload failed: %v", s.reloadErr)
+		return
+	}
+	result.err = s.checker.result()
+	return
+}
+
 func (s *store) dispatchRequests() {
 	reload := make(chan os.Signal, 1)
 	signal.Notify(reload, syscall.SIGHUP)
@@ -271,7 +827,9 @@ func (s *store) dispatchRequests() {
 				req.response <- s.update(req.username, req.password)
 			} else {
 				wdl.Printf("upgrade(local): upgrading '%s'", req.username)
-				if resp := s.update(req.username, req.password); resp.err != nil {
+				resp := s.update(req.username, req.password)
+				audit.Log(auditRecord{Frontend: "store", User: req.username, Operation: "upgrade", Detail: "local"}, resp.err)
+				if resp.err != nil {
 					wl.Printf("upgrade(local): failed for '%s': %v", req.username, resp.err)
 				} else {
 					wdl.Printf("upgrade(local): successfully upgraded '%s'", req.username)
@@ -279,12 +837,40 @@ func (s *store) dispatchRequests() {
 			}
 		case req := <-s.setAdminChan:
 			req.response <- s.setAdmin(req.username, req.isAdmin)
+		case req := <-s.modifyUserChan:
+			req.response <- s.modifyUser(req.username, req.password, req.isAdmin, req.create)
+		case req := <-s.setRolesChan:
+			req.response <- s.setRoles(req.username, req.roles)
+		case req := <-s.setServicesChan:
+			req.response <- s.setServices(req.username, req.services)
+		case req := <-s.checkServiceChan:
+			req.response <- s.checkService(req.username, req.service)
 		case req := <-s.listChan:
 			req.response <- s.list()
 		case req := <-s.listFullChan:
 			req.response <- s.listFull()
 		case req := <-s.authenticateChan:
-			req.response <- s.authenticate(req.username, req.password)
+			req.response <- s.authenticate(req.username, req.password, req.remote, req.appPasswords)
+		case req := <-s.throttleListChan:
+			req.response <- s.throttleList()
+		case req := <-s.throttleResetChan:
+			req.response <- s.throttleReset(req.key)
+		case req := <-s.readyChan:
+			req.response <- s.ready()
+		case req := <-s.addAppPasswordChan:
+			req.response <- s.addAppPassword(req.username, req.name)
+		case req := <-s.removeAppPasswordChan:
+			req.response <- s.removeAppPassword(req.username, req.name)
+		case req := <-s.listAppPasswordsChan:
+			req.response <- s.listAppPasswords(req.username)
+		case req := <-s.createResetTokenChan:
+			req.response <- s.createResetToken(req.username, req.validFor)
+		case req := <-s.checkResetTokenChan:
+			req.response <- s.checkResetToken(req.username, req.token, req.remote)
+		case req := <-s.resetPasswordChan:
+			req.response <- s.resetPassword(req.username, req.token, req.password, req.policyName, req.remote)
+		case req := <-s.checkPasswordChan:
+			req.response <- s.checkPassword(req.username)
 		}
 	}
 }
@@ -298,14 +884,18 @@ func remoteHTTPUpgrade(update updateRequest, remote string) {
 	req, _ := http.NewRequest("POST", remote, bytes.NewReader(reqdata))
 	req.Header.Set("Content-Type", "application/json")
 	client := &http.Client{}
+	rec := auditRecord{Frontend: "store", User: update.username, Operation: "upgrade", Detail: "remote=" + remote}
 	resp, err := client.Do(req)
 	if err != nil {
 		wl.Printf("upgrade(remote): error sending update request: %v", err)
+		audit.Log(rec, err)
 		return
 	}
 	if resp.StatusCode != http.StatusOK {
 		wl.Printf("upgrade(remote): failed for '%s' with status: %s", update.username, resp.Status)
+		audit.Log(rec, fmt.Errorf("remote returned status: %s", resp.Status))
 	} else {
+		audit.Log(rec, nil)
 		wdl.Printf("upgrade(remote): successfully upgraded '%s'", update.username)
 	}
 }
@@ -322,6 +912,7 @@ func remoteHTTPUpgrader(upgradeChan <-chan updateRequest, remote string) {
 			}(update, remote)
 		default:
 			wdl.Printf("upgrade(remote): ignoring upgrade request for '%s' due to rate-limiting", update.username)
+			metrics.upgradesDropped.Inc()
 		}
 	}
 }
@@ -348,18 +939,37 @@ func runRemoteUpgrader(remote string) (upgradeChan chan updateRequest, err error
 // Public Interface
 
 type Store struct {
-	initChan         chan<- initRequest
-	checkChan        chan<- checkRequest
-	addChan          chan<- addRequest
-	removeChan       chan<- removeRequest
-	updateChan       chan<- updateRequest
-	setAdminChan     chan<- setAdminRequest
-	listChan         chan<- listRequest
-	listFullChan     chan<- listFullRequest
-	authenticateChan chan<- authenticateRequest
+	readyTimeout          time.Duration
+	resetTokenValidity    time.Duration
+	throttle              *authThrottle
+	initChan              chan<- initRequest
+	checkChan             chan<- checkRequest
+	addChan               chan<- addRequest
+	removeChan            chan<- removeRequest
+	updateChan            chan<- updateRequest
+	setAdminChan          chan<- setAdminRequest
+	modifyUserChan        chan<- modifyUserRequest
+	setRolesChan          chan<- setRolesRequest
+	setServicesChan       chan<- setServicesRequest
+	checkServiceChan      chan<- checkServiceRequest
+	listChan              chan<- listRequest
+	listFullChan          chan<- listFullRequest
+	authenticateChan      chan<- authenticateRequest
+	throttleListChan      chan<- throttleListRequest
+	throttleResetChan     chan<- throttleResetRequest
+	readyChan             chan<- readyRequest
+	addAppPasswordChan    chan<- addAppPasswordRequest
+	removeAppPasswordChan chan<- removeAppPasswordRequest
+	listAppPasswordsChan  chan<- listAppPasswordsRequest
+	createResetTokenChan  chan<- createResetTokenRequest
+	checkResetTokenChan   chan<- checkResetTokenRequest
+	resetPasswordChan     chan<- resetPasswordRequest
+	checkPasswordChan     chan<- checkPasswordRequest
 }
 
 func (s *Store) Init(username, password string) error {
+	defer metrics.dispatchDuration.ObserveSince(time.Now(), "init")
+
 	resCh := make(chan initResult)
 	req := initRequest{}
 	req.username = username
@@ -372,6 +982,8 @@ func (s *Store) Init(username, password string) error {
 }
 
 func (s *Store) Check() error {
+	defer metrics.dispatchDuration.ObserveSince(time.Now(), "check")
+
 	resCh := make(chan checkResult)
 	req := checkRequest{}
 	req.response = resCh
@@ -382,6 +994,8 @@ func (s *Store) Check() error {
 }
 
 func (s *Store) Add(username, password string, isAdmin bool) error {
+	defer metrics.dispatchDuration.ObserveSince(time.Now(), "add")
+
 	resCh := make(chan addResult)
 	req := addRequest{}
 	req.username = username
@@ -395,6 +1009,8 @@ func (s *Store) Add(username, password string, isAdmin bool) error {
 }
 
 func (s *Store) Remove(username string) error {
+	defer metrics.dispatchDuration.ObserveSince(time.Now(), "remove")
+
 	resCh := make(chan removeResult)
 	req := removeRequest{}
 	req.username = username
@@ -406,6 +1022,8 @@ func (s *Store) Remove(username string) error {
 }
 
 func (s *Store) Update(username, password string) error {
+	defer metrics.dispatchDuration.ObserveSince(time.Now(), "update")
+
 	resCh := make(chan updateResult)
 	req := updateRequest{}
 	req.username = username
@@ -418,6 +1036,8 @@ func (s *Store) Update(username, password string) error {
 }
 
 func (s *Store) SetAdmin(username string, isAdmin bool) error {
+	defer metrics.dispatchDuration.ObserveSince(time.Now(), "set-admin")
+
 	resCh := make(chan setAdminResult)
 	req := setAdminRequest{}
 	req.username = username
@@ -429,7 +1049,71 @@ func (s *Store) SetAdmin(username string, isAdmin bool) error {
 	return res.err
 }
 
+// ModifyUser changes the password and/or admin status of username, nil values are left
+// unchanged. If create is set a missing user gets added, created tells whether this
+// happened. If the user does not exist and create is not set errUserNotFound is returned.
+func (s *Store) ModifyUser(username string, password *string, isAdmin *bool, create bool) (created bool, err error) {
+	defer metrics.dispatchDuration.ObserveSince(time.Now(), "modify-user")
+
+	resCh := make(chan modifyUserResult)
+	req := modifyUserRequest{}
+	req.username = username
+	req.password = password
+	req.isAdmin = isAdmin
+	req.create = create
+	req.response = resCh
+	s.modifyUserChan <- req
+
+	res := <-resCh
+	return res.created, res.err
+}
+
+func (s *Store) SetRoles(username string, roles []string) error {
+	defer metrics.dispatchDuration.ObserveSince(time.Now(), "set-roles")
+
+	resCh := make(chan setRolesResult)
+	req := setRolesRequest{}
+	req.username = username
+	req.roles = roles
+	req.response = resCh
+	s.setRolesChan <- req
+
+	res := <-resCh
+	return res.err
+}
+
+func (s *Store) SetServices(username string, services []string) error {
+	defer metrics.dispatchDuration.ObserveSince(time.Now(), "set-services")
+
+	resCh := make(chan setServicesResult)
+	req := setServicesRequest{}
+	req.username = username
+	req.services = services
+	req.response = resCh
+	s.setServicesChan <- req
+
+	res := <-resCh
+	return res.err
+}
+
+// CheckService returns whether username may authenticate for service.
+func (s *Store) CheckService(username, service string) (bool, error) {
+	defer metrics.dispatchDuration.ObserveSince(time.Now(), "check-service")
+
+	resCh := make(chan checkServiceResult)
+	req := checkServiceRequest{}
+	req.username = username
+	req.service = service
+	req.response = resCh
+	s.checkServiceChan <- req
+
+	res := <-resCh
+	return res.ok, res.err
+}
+
 func (s *Store) List() (lib.UserList, error) {
+	defer metrics.dispatchDuration.ObserveSince(time.Now(), "list")
+
 	resCh := make(chan listResult)
 	req := listRequest{}
 	req.response = resCh
@@ -440,6 +1124,8 @@ func (s *Store) List() (lib.UserList, error) {
 }
 
 func (s *Store) ListFull() (lib.UserListFull, error) {
+	defer metrics.dispatchDuration.ObserveSince(time.Now(), "list-full")
+
 	resCh := make(chan listFullResult)
 	req := listFullRequest{}
 	req.response = resCh
@@ -449,44 +1135,277 @@ func (s *Store) ListFull() (lib.UserListFull, error) {
 	return res.list, res.err
 }
 
-func (s *Store) Authenticate(username, password string) (bool, bool, time.Time, error) {
+// Authenticate checks username and password. remote is the address of the client, if
+// known, and is used to throttle failed attempts. mustChange is set if the user has been
+// flagged to change the password, e.g. after being promoted to admin.
+func (s *Store) Authenticate(username, password, remote string) (ok, isAdmin, mustChange bool, lastChanged time.Time, err error) {
+	defer metrics.dispatchDuration.ObserveSince(time.Now(), "authenticate")
+
+	resCh := make(chan authenticateResult)
+	req := authenticateRequest{}
+	req.username = username
+	req.password = password
+	req.remote = remote
+	req.response = resCh
+	s.authenticateChan <- req
+
+	res := <-resCh
+	return res.ok, res.isAdmin, res.mustChange, res.lastChanged, res.err
+}
+
+// AuthenticateWithAppPasswords works like Authenticate but also accepts the application
+// passwords of username. If one of them was used its name is returned as appPassword.
+// This must only be used by frontends which don't grant access to the management
+// interfaces.
+func (s *Store) AuthenticateWithAppPasswords(username, password, remote string) (ok, isAdmin bool, appPassword string, err error) {
+	defer metrics.dispatchDuration.ObserveSince(time.Now(), "authenticate-app-password")
+
 	resCh := make(chan authenticateResult)
 	req := authenticateRequest{}
 	req.username = username
 	req.password = password
+	req.remote = remote
+	req.appPasswords = true
 	req.response = resCh
 	s.authenticateChan <- req
 
 	res := <-resCh
-	return res.ok, res.isAdmin, res.lastChanged, res.err
+	if res.appPasswordHash != nil {
+		if !res.appPasswordHash.Check(password) {
+			s.throttle.failure(username, remote)
+			return false, res.isAdmin, "", nil
+		}
+		s.throttle.success(username)
+		return true, res.isAdmin, res.appPasswordHash.Name, nil
+	}
+	return res.ok, res.isAdmin, res.appPassword, res.err
+}
+
+// AddAppPassword creates a new application password called name for username and
+// returns the generated password. The password can not be retrieved later on.
+func (s *Store) AddAppPassword(username, name string) (string, error) {
+	defer metrics.dispatchDuration.ObserveSince(time.Now(), "add-app-password")
+
+	resCh := make(chan addAppPasswordResult)
+	req := addAppPasswordRequest{}
+	req.username = username
+	req.name = name
+	req.response = resCh
+	s.addAppPasswordChan <- req
+
+	res := <-resCh
+	return res.password, res.err
+}
+
+func (s *Store) RemoveAppPassword(username, name string) error {
+	defer metrics.dispatchDuration.ObserveSince(time.Now(), "remove-app-password")
+
+	resCh := make(chan removeAppPasswordResult)
+	req := removeAppPasswordRequest{}
+	req.username = username
+	req.name = name
+	req.response = resCh
+	s.removeAppPasswordChan <- req
+
+	res := <-resCh
+	return res.err
+}
+
+func (s *Store) ListAppPasswords(username string) ([]lib.AppPassword, error) {
+	defer metrics.dispatchDuration.ObserveSince(time.Now(), "list-app-passwords")
+
+	resCh := make(chan listAppPasswordsResult)
+	req := listAppPasswordsRequest{}
+	req.username = username
+	req.response = resCh
+	s.listAppPasswordsChan <- req
+
+	res := <-resCh
+	return res.list, res.err
+}
+
+// CreateResetToken creates a single-use token which allows to set a new password for
+// username without knowing the old one. The token expires after validFor.
+func (s *Store) CreateResetToken(username string, validFor time.Duration) (string, time.Time, error) {
+	defer metrics.dispatchDuration.ObserveSince(time.Now(), "create-reset-token")
+
+	resCh := make(chan createResetTokenResult)
+	req := createResetTokenRequest{}
+	req.username = username
+	req.validFor = validFor
+	req.response = resCh
+	s.createResetTokenChan <- req
+
+	res := <-resCh
+	return res.token, res.expires, res.err
+}
+
+// ResetPassword sets the password of username to password if token is the current reset
+// token of the user. On success the token is used up. If the password is rejected by the
+// password policy the token stays valid. remote is the address of the client, if known, and
+// is used to throttle failed attempts.
+func (s *Store) ResetPassword(username, token, password, remote string) error {
+	defer metrics.dispatchDuration.ObserveSince(time.Now(), "reset-password")
+
+	checkCh := make(chan checkResetTokenResult)
+	checkReq := checkResetTokenRequest{}
+	checkReq.username = username
+	checkReq.token = token
+	checkReq.remote = remote
+	checkReq.response = checkCh
+	s.checkResetTokenChan <- checkReq
+
+	checkRes := <-checkCh
+	if checkRes.err != nil {
+		return checkRes.err
+	}
+	if ok, err := checkRes.policy.Check(password, username); !ok || err != nil {
+		if err != nil {
+			return err
+		}
+		return errPasswordPolicy
+	}
+
+	resCh := make(chan resetPasswordResult)
+	req := resetPasswordRequest{}
+	req.username = username
+	req.token = token
+	req.password = password
+	req.policyName = checkRes.policyName
+	req.remote = remote
+	req.response = resCh
+	s.resetPasswordChan <- req
+
+	res := <-resCh
+	return res.err
+}
+
+// CheckPassword rates password using the configured password policy. The store is not
+// modified.
+func (s *Store) CheckPassword(username, password string) PolicyFeedback {
+	defer metrics.dispatchDuration.ObserveSince(time.Now(), "check-password")
+
+	resCh := make(chan checkPasswordResult)
+	req := checkPasswordRequest{}
+	req.username = username
+	req.response = resCh
+	s.checkPasswordChan <- req
+
+	res := <-resCh
+	return res.policy.Feedback(password, username)
+}
+
+func (s *Store) ListThrottled() (lib.ThrottleList, error) {
+	defer metrics.dispatchDuration.ObserveSince(time.Now(), "list-throttled")
+
+	resCh := make(chan throttleListResult)
+	req := throttleListRequest{}
+	req.response = resCh
+	s.throttleListChan <- req
+
+	res := <-resCh
+	return res.list, res.err
+}
+
+func (s *Store) ResetThrottled(key string) (bool, error) {
+	defer metrics.dispatchDuration.ObserveSince(time.Now(), "reset-throttled")
+
+	resCh := make(chan throttleResetResult)
+	req := throttleResetRequest{}
+	req.key = key
+	req.response = resCh
+	s.throttleResetChan <- req
+
+	res := <-resCh
+	return res.found, res.err
+}
+
+// Ready checks whether the store is able to serve requests. It fails if the last reload
+// of the store configuration failed, the store directory is not consistent or if the
+// dispatcher does not answer within the configured timeout.
+func (s *Store) Ready() error {
+	defer metrics.dispatchDuration.ObserveSince(time.Now(), "ready")
+
+	t := time.NewTimer(s.readyTimeout)
+	defer t.Stop()
+
+	resCh := make(chan readyResult, 1)
+	req := readyRequest{}
+	req.response = resCh
+	select {
+	case s.readyChan <- req:
+	case <-t.C:
+		return errors.New("timeout while waiting for store dispatcher")
+	}
+
+	select {
+	case res := <-resCh:
+		return res.err
+	case <-t.C:
+		return errors.New("timeout while waiting for store dispatcher")
+	}
 }
 
 func (s *store) GetInterface() *Store {
 	ch := &Store{}
+	ch.readyTimeout = s.readiness.Timeout
+	ch.resetTokenValidity = s.resetTokenValidity
+	ch.throttle = s.throttle
 	ch.initChan = s.initChan
 	ch.checkChan = s.checkChan
 	ch.addChan = s.addChan
 	ch.removeChan = s.removeChan
 	ch.updateChan = s.updateChan
 	ch.setAdminChan = s.setAdminChan
+	ch.modifyUserChan = s.modifyUserChan
+	ch.setRolesChan = s.setRolesChan
+	ch.setServicesChan = s.setServicesChan
+	ch.checkServiceChan = s.checkServiceChan
 	ch.listChan = s.listChan
 	ch.listFullChan = s.listFullChan
 	ch.authenticateChan = s.authenticateChan
+	ch.throttleListChan = s.throttleListChan
+	ch.throttleResetChan = s.throttleResetChan
+	ch.readyChan = s.readyChan
+	ch.addAppPasswordChan = s.addAppPasswordChan
+	ch.removeAppPasswordChan = s.removeAppPasswordChan
+	ch.listAppPasswordsChan = s.listAppPasswordsChan
+	ch.createResetTokenChan = s.createResetTokenChan
+	ch.checkResetTokenChan = s.checkResetTokenChan
+	ch.resetPasswordChan = s.resetPasswordChan
+	ch.checkPasswordChan = s.checkPasswordChan
 	return ch
 }
 
-func NewStore(configfile, doUpgrades, policyType, policyCondition, hooksDir string) (s *store, err error) {
+func NewStore(configfile, doUpgrades string, policy policyConfig, serviceRules, hooksDir string, throttle throttleConfig, readiness readinessConfig, resetTokenValidity time.Duration) (s *store, err error) {
 	s = &store{}
 	if s.dir, err = lib.NewDirFromConfig(configfile); err != nil {
 		return
 	}
 	s.configfile = configfile
-	if s.policy, err = NewPasswordPolicy(policyType, policyCondition); err != nil {
+	if s.policies, err = newPolicySelector(policy); err != nil {
+		return
+	}
+	if s.services, err = newServiceRules(serviceRules); err != nil {
 		return
 	}
 	if s.hooks, err = NewHooksCaller(hooksDir, s.dir.BaseDir); err != nil {
 		return
 	}
+	if s.throttle, err = newAuthThrottle(throttle); err != nil {
+		return
+	}
+	s.readiness = readiness
+	if readiness.CheckInterval <= 0 {
+		err = fmt.Errorf("the interval of the readiness check must be positive")
+		return
+	}
+	s.checker = newReadinessChecker(s.dir)
+	if resetTokenValidity <= 0 {
+		err = fmt.Errorf("the validity of reset tokens must be positive")
+		return
+	}
+	s.resetTokenValidity = resetTokenValidity
 
 	s.initChan = make(chan initRequest, 1)
 	s.checkChan = make(chan checkRequest, 1)
@@ -494,9 +1413,23 @@ func NewStore(configfile, doUpgrades, policyType, policyCondition, hooksDir stri
 	s.removeChan = make(chan removeRequest, 10)
 	s.updateChan = make(chan updateRequest, 10)
 	s.setAdminChan = make(chan setAdminRequest, 10)
+	s.modifyUserChan = make(chan modifyUserRequest, 10)
+	s.setRolesChan = make(chan setRolesRequest, 10)
+	s.setServicesChan = make(chan setServicesRequest, 10)
+	s.checkServiceChan = make(chan checkServiceRequest, 10)
 	s.listChan = make(chan listRequest, 10)
 	s.listFullChan = make(chan listFullRequest, 10)
 	s.authenticateChan = make(chan authenticateRequest, 10)
+	s.throttleListChan = make(chan throttleListRequest, 1)
+	s.throttleResetChan = make(chan throttleResetRequest, 1)
+	s.readyChan = make(chan readyRequest, 1)
+	s.addAppPasswordChan = make(chan addAppPasswordRequest, 10)
+	s.removeAppPasswordChan = make(chan removeAppPasswordRequest, 10)
+	s.listAppPasswordsChan = make(chan listAppPasswordsRequest, 10)
+	s.createResetTokenChan = make(chan createResetTokenRequest, 10)
+	s.checkResetTokenChan = make(chan checkResetTokenRequest, 10)
+	s.resetPasswordChan = make(chan resetPasswordRequest, 10)
+	s.checkPasswordChan = make(chan checkPasswordRequest, 10)
 
 	switch doUpgrades {
 	case "":
@@ -509,6 +1442,7 @@ func NewStore(configfile, doUpgrades, policyType, policyCondition, hooksDir stri
 		}
 	}
 
+	go s.checker.run(s.readiness.CheckInterval)
 	go s.dispatchRequests()
 	return
 }
@@ -0,0 +1,182 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	storeLib "github.com/whawty/auth/store"
+)
+
+const (
+	testAdminName     = "admin"
+	testAdminPassword = "correct horse battery staple"
+)
+
+var (
+	testThrottleConfig = throttleConfig{
+		User: storeLib.ThrottleConfig{Attempts: 100, Backoff: time.Second, MaxBackoff: time.Minute, Expire: time.Hour},
+		Addr: storeLib.ThrottleConfig{Attempts: 100, Backoff: time.Second, MaxBackoff: time.Minute, Expire: time.Hour},
+	}
+	testReadinessConfig = readinessConfig{Timeout: 5 * time.Second, CheckInterval: time.Minute}
+)
+
+// newTestStore creates a store inside a temporary directory which contains the admin
+// testAdminName. Low scrypt parameters are used to keep the tests fast.
+func newTestStore(t *testing.T, policy policyConfig, services string) *Store {
+	basedir := filepath.Join(t.TempDir(), "store")
+	return newTestStoreWithConfig(t, basedir, policy, services, testThrottleConfig, testReadinessConfig)
+}
+
+// newTestStoreWithConfig works like newTestStore but the store is created inside basedir
+// and the throttle and readiness configuration can be changed.
+func newTestStoreWithConfig(t *testing.T, basedir string, policy policyConfig, services string, throttle throttleConfig, readiness readinessConfig) *Store {
+	if err := os.Mkdir(basedir, 0700); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	configfile := filepath.Join(filepath.Dir(basedir), "store.yaml")
+	config := fmt.Sprintf(`basedir: "%s"
+default: 1
+params:
+  - id: 1
+    scryptauth:
+      hmackey: "iVFvz2PW5g1Tge9mLttgRxBuu0OBXgD7uAOHySqi4QI="
+      cost: 10
+`, basedir)
+	if err := os.WriteFile(configfile, []byte(config), 0600); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	s, err := NewStore(configfile, "", policy, services, "", throttle, readiness, 24*time.Hour)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	store := s.GetInterface()
+	if err := store.Init(testAdminName, testAdminPassword); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	return store
+}
+
+// webTestRequest sends a request to h. If token is not empty it is used as bearer token.
+func webTestRequest(h http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.RemoteAddr = "192.0.2.1:1234"
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestStoreThrottle(t *testing.T) {
+	store := newTestStoreWithConfig(t, filepath.Join(t.TempDir(), "store"), policyConfig{}, "", throttleConfig{
+		User:   storeLib.ThrottleConfig{Attempts: 2, Backoff: time.Minute, MaxBackoff: time.Hour, LockoutAttempts: 3, Lockout: time.Hour, Expire: time.Hour},
+		Addr:   storeLib.ThrottleConfig{Attempts: 4, Backoff: time.Minute, MaxBackoff: time.Minute, Expire: time.Hour},
+		Exempt: []string{"127.0.0.0/8"},
+	}, testReadinessConfig)
+
+	for i := 0; i < 10; i++ {
+		user := fmt.Sprintf("user%d", i)
+		if ok, _, _, _, _ := store.Authenticate(user, "wrong", "127.0.0.1"); ok {
+			t.Fatal("authentication of unknown user should fail")
+		}
+	}
+	if ok, _, _, _, err := store.Authenticate(testAdminName, testAdminPassword, "127.0.0.1"); !ok || err != nil {
+		t.Fatalf("exempt addresses should not be throttled, got ok = %t, err = %v", ok, err)
+	}
+
+	for i := 0; i < 4; i++ {
+		store.Authenticate(fmt.Sprintf("user%d", i), "wrong", "192.0.2.1") //nolint:errcheck
+	}
+	if _, _, _, _, err := store.Authenticate(testAdminName, testAdminPassword, "192.0.2.1"); err == nil {
+		t.Fatal("too many failures from a client address should be throttled")
+	}
+	if ok, _, _, _, err := store.Authenticate(testAdminName, testAdminPassword, "192.0.2.2"); !ok || err != nil {
+		t.Fatalf("other client addresses should not be throttled, got ok = %t, err = %v", ok, err)
+	}
+
+	list, err := store.ListThrottled()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if state, exists := list["addr:192.0.2.1"]; !exists || state.Locked {
+		t.Fatalf("client address should be delayed but not locked out, got %v", list)
+	}
+	if _, exists := list["addr:127.0.0.1"]; exists {
+		t.Fatalf("exempt client address should not be tracked, got %v", list)
+	}
+	if found, err := store.ResetThrottled("addr:192.0.2.1"); !found || err != nil {
+		t.Fatalf("reset of throttled client address failed: found = %t, err = %v", found, err)
+	}
+	if ok, _, _, _, err := store.Authenticate(testAdminName, testAdminPassword, "192.0.2.1"); !ok || err != nil {
+		t.Fatalf("authentication after reset should succeed, got ok = %t, err = %v", ok, err)
+	}
+}
+
+func TestStoreAppPasswords(t *testing.T) {
+	store := newTestStore(t, policyConfig{}, "")
+
+	password, err := store.AddAppPassword(testAdminName, "mail")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	ok, isAdmin, name, err := store.AuthenticateWithAppPasswords(testAdminName, password, "192.0.2.1")
+	if err != nil || !ok || !isAdmin || name != "mail" {
+		t.Fatalf("authentication using the application password failed: ok = %t, admin = %t, name = %q, err = %v", ok, isAdmin, name, err)
+	}
+	if ok, _, _, _, _ := store.Authenticate(testAdminName, password, "192.0.2.1"); ok {
+		t.Fatal("application passwords must not be accepted by Authenticate")
+	}
+
+	tag, _, _ := strings.Cut(password, "-")
+	if ok, _, name, err := store.AuthenticateWithAppPasswords(testAdminName, tag+"-wrong", "192.0.2.1"); ok || name != "" || err != nil {
+		t.Fatalf("authentication using a wrong application password should fail: ok = %t, name = %q, err = %v", ok, name, err)
+	}
+	list, err := store.ListThrottled()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if list["user:"+testAdminName].Failures != 2 || list["addr:192.0.2.1"].Failures != 2 {
+		t.Fatalf("failed authentications should be throttled, got %v", list)
+	}
+	if ok, _, _, err := store.AuthenticateWithAppPasswords(testAdminName, testAdminPassword, "192.0.2.1"); !ok || err != nil {
+		t.Fatalf("authentication using the main password failed: ok = %t, err = %v", ok, err)
+	}
+}
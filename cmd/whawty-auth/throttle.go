@@ -0,0 +1,115 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	lib "github.com/whawty/auth/store"
+)
+
+// throttleConfig holds the parameters of the user and the client address throttle. Many
+// users may share a single client address, e.g. behind a reverse proxy, therefore addresses
+// should not be locked out. Addresses which are part of Exempt are not throttled at all.
+type throttleConfig struct {
+	User   lib.ThrottleConfig
+	Addr   lib.ThrottleConfig
+	Exempt []string
+}
+
+// authThrottle throttles failed authentications per user and per client address. It is
+// safe for concurrent use, so it may be used from outside of the store dispatcher.
+type authThrottle struct {
+	user   *lib.Throttle
+	addr   *lib.Throttle
+	exempt networkList
+}
+
+func newAuthThrottle(config throttleConfig) (t *authThrottle, err error) {
+	t = &authThrottle{}
+	if t.exempt, err = parseNetworkList(config.Exempt); err != nil {
+		return nil, fmt.Errorf("invalid throttle exemptions: %v", err)
+	}
+	t.user = lib.NewThrottle(config.User)
+	t.addr = lib.NewThrottle(config.Addr)
+	return
+}
+
+func (t *authThrottle) addrKey(remote string) string {
+	if remote == "" {
+		return ""
+	}
+	if ip := net.ParseIP(remote); ip != nil && t.exempt.Contains(ip) {
+		return ""
+	}
+	return "addr:" + remote
+}
+
+func (t *authThrottle) allow(username, remote string) (bool, time.Duration) {
+	if ok, retryAfter := t.user.Allow("user:" + username); !ok {
+		return ok, retryAfter
+	}
+	if key := t.addrKey(remote); key != "" {
+		return t.addr.Allow(key)
+	}
+	return true, 0
+}
+
+func (t *authThrottle) failure(username, remote string) {
+	t.user.Failure("user:" + username)
+	if key := t.addrKey(remote); key != "" {
+		t.addr.Failure(key)
+	}
+}
+
+// success only clears the state of the user. Otherwise a client could reset its failures
+// by authenticating as a user it knows the password of in between guesses.
+func (t *authThrottle) success(username string) {
+	t.user.Success("user:" + username)
+}
+
+func (t *authThrottle) list() lib.ThrottleList {
+	list := t.user.List()
+	for key, state := range t.addr.List() {
+		list[key] = state
+	}
+	return list
+}
+
+func (t *authThrottle) reset(key string) bool {
+	if strings.HasPrefix(key, "addr:") {
+		return t.addr.Reset(key)
+	}
+	return t.user.Reset(key)
+}
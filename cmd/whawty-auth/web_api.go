@@ -32,17 +32,69 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	_ "net/http/pprof"
+	"strings"
 	"time"
 
 	storeLib "github.com/whawty/auth/store"
 	"github.com/whawty/auth/ui"
 )
 
-func handleWebBasicAuth(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+// webClientAddr returns the address of the client without the port.
+func webClientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// webBasicAuth handles the /basic-auth endpoint which is meant to be used by reverse
+// proxies such as nginx' auth_request.
+type webBasicAuth struct {
+	config         *webBasicAuthConfig
+	trustedProxies networkList
+}
+
+func newWebBasicAuth(config *webBasicAuthConfig) (ba webBasicAuth, err error) {
+	ba.config = config
+	if ba.trustedProxies, err = parseNetworkList(config.TrustedProxies); err != nil {
+		err = fmt.Errorf("invalid trusted proxies for basic-auth: %v", err)
+	}
+	return
+}
+
+// forwardedHeader returns the value of the header name if the request was sent by one of the
+// trusted proxies. Headers set by any other client are ignored.
+func (ba webBasicAuth) forwardedHeader(r *http.Request, name string) string {
+	if ip := net.ParseIP(webClientAddr(r)); ip != nil && ba.trustedProxies.Contains(ip) {
+		return r.Header.Get(name)
+	}
+	return ""
+}
+
+// service returns the name of the service users must be allowed to authenticate for. The
+// virtual host is taken from X-Forwarded-Host if the request was sent by one of the trusted
+// proxies and from the Host header otherwise. An empty result means the service is not checked.
+func (ba webBasicAuth) service(r *http.Request) string {
+	host := r.Host
+	if forwarded := ba.forwardedHeader(r, "X-Forwarded-Host"); forwarded != "" {
+		host = forwarded
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if service, exists := ba.config.VHosts[strings.ToLower(host)]; exists {
+		return service
+	}
+	return ba.config.Service
+}
+
+func (ba webBasicAuth) handleBasicAuth(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
 	username, password, ok := r.BasicAuth()
 	if !ok {
 		w.Header().Set("WWW-Authenticate", `Basic realm="restricted", charset="UTF-8"`)
@@ -50,8 +102,15 @@ func handleWebBasicAuth(store *Store, sessions *webSessionFactory, w http.Respon
 		return
 	}
 
-	ok, _, _, err := store.Authenticate(username, password)
-	if err != nil {
+	ok, _, appPassword, err := store.AuthenticateWithAppPasswords(username, password, webClientAddr(r))
+	detail := auditAppPasswordDetail(appPassword)
+	if service := ba.service(r); service != "" {
+		ok, err = authorizeService(store, username, service, ok, err)
+		detail = strings.TrimSpace("service=" + service + " " + detail)
+	}
+	audit.LogAuth(auditRecord{Frontend: "http", Remote: webClientAddr(r), User: username, Detail: detail}, ok, err)
+	// a service which is not allowed must not reveal that the password was correct
+	if err != nil && !errors.Is(err, errServiceNotAllowed) {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	} else if !ok {
@@ -74,6 +133,7 @@ type webAuthenticateResponse struct {
 	Username    string    `json:"username"`
 	IsAdmin     bool      `json:"admin"`
 	LastChanged time.Time `json:"lastchanged"`
+	MustChange  bool      `json:"mustchange"`
 	Error       string    `json:"error,omitempty"`
 }
 
@@ -96,7 +156,8 @@ func handleWebAuthenticate(store *Store, sessions *webSessionFactory, w http.Res
 		return
 	}
 
-	ok, isAdmin, lastChanged, err := store.Authenticate(reqdata.Username, reqdata.Password)
+	ok, isAdmin, mustChange, lastChanged, err := store.Authenticate(reqdata.Username, reqdata.Password, webClientAddr(r))
+	audit.LogAuth(auditRecord{Frontend: "http", Remote: webClientAddr(r), User: reqdata.Username}, ok, err)
 	if err != nil || !ok {
 		respdata.Error = "authentication failed"
 		if err != nil {
@@ -109,6 +170,7 @@ func handleWebAuthenticate(store *Store, sessions *webSessionFactory, w http.Res
 	respdata.Username = reqdata.Username
 	respdata.IsAdmin = isAdmin
 	respdata.LastChanged = lastChanged
+	respdata.MustChange = mustChange
 	var status int
 	status, respdata.Error, respdata.Session = sessions.Generate(reqdata.Username, isAdmin)
 	sendWebResponse(w, status, respdata)
@@ -153,15 +215,20 @@ func handleWebAdd(store *Store, sessions *webSessionFactory, w http.ResponseWrit
 		return
 	}
 
+	rec := auditRecord{Frontend: "http", Remote: webClientAddr(r), Actor: username, User: reqdata.Username,
+		Operation: "add", Detail: fmt.Sprintf("admin=%t", reqdata.IsAdmin)}
 	if !isAdmin {
 		respdata.Error = "only admins are allowed to add users"
+		audit.Log(rec, errors.New(respdata.Error))
 		sendWebResponse(w, http.StatusForbidden, respdata)
 		return
 	}
 
 	wdl.Printf("admin '%s' want's to add user '%s' and admin status: %t", username, reqdata.Username, reqdata.IsAdmin)
 
-	if err := store.Add(reqdata.Username, reqdata.Password, reqdata.IsAdmin); err != nil {
+	err := store.Add(reqdata.Username, reqdata.Password, reqdata.IsAdmin)
+	audit.Log(rec, err)
+	if err != nil {
 		respdata.Error = err.Error()
 		sendWebResponse(w, http.StatusBadRequest, respdata)
 		return
@@ -207,15 +274,19 @@ func handleWebRemove(store *Store, sessions *webSessionFactory, w http.ResponseW
 		return
 	}
 
+	rec := auditRecord{Frontend: "http", Remote: webClientAddr(r), Actor: username, User: reqdata.Username, Operation: "remove"}
 	if !isAdmin {
 		respdata.Error = "only admins are allowed to remove users"
+		audit.Log(rec, errors.New(respdata.Error))
 		sendWebResponse(w, http.StatusForbidden, respdata)
 		return
 	}
 
 	wdl.Printf("admin '%s' want's to remove user '%s'", username, reqdata.Username)
 
-	if err := store.Remove(reqdata.Username); err != nil {
+	err := store.Remove(reqdata.Username)
+	audit.Log(rec, err)
+	if err != nil {
 		respdata.Error = err.Error()
 		sendWebResponse(w, http.StatusBadRequest, respdata)
 		return
@@ -255,6 +326,7 @@ func handleWebUpdate(store *Store, sessions *webSessionFactory, w http.ResponseW
 		return
 	}
 
+	rec := auditRecord{Frontend: "http", Remote: webClientAddr(r), User: reqdata.Username, Operation: "update"}
 	if reqdata.Session != "" && reqdata.OldPassword == "" {
 		if reqdata.NewPassword == "" {
 			respdata.Error = "empty newpassword is not allowed when using session based authentication"
@@ -269,14 +341,17 @@ func handleWebUpdate(store *Store, sessions *webSessionFactory, w http.ResponseW
 			return
 		}
 
+		rec.Actor = username
 		if !isAdmin && username != reqdata.Username {
 			respdata.Error = "only admins are allowed to update any users' password"
+			audit.Log(rec, errors.New(respdata.Error))
 			sendWebResponse(w, http.StatusForbidden, respdata)
 			return
 		}
 		wdl.Printf("user '%s' want's to update user '%s', using a valid session", username, reqdata.Username)
 	} else if reqdata.Session == "" && reqdata.OldPassword != "" {
-		ok, _, _, err := store.Authenticate(reqdata.Username, reqdata.OldPassword)
+		ok, _, _, _, err := store.Authenticate(reqdata.Username, reqdata.OldPassword, webClientAddr(r))
+		audit.LogAuth(auditRecord{Frontend: "http", Remote: webClientAddr(r), User: reqdata.Username}, ok, err)
 		if err != nil || !ok {
 			respdata.Error = "authentication failed"
 			if err != nil {
@@ -291,6 +366,7 @@ func handleWebUpdate(store *Store, sessions *webSessionFactory, w http.ResponseW
 			sendWebResponse(w, http.StatusOK, respdata)
 			return
 		}
+		rec.Actor = reqdata.Username
 		wdl.Printf("update user '%s', using current(old) password", reqdata.Username)
 	} else {
 		respdata.Error = "exactly one of session or old-password must be supplied"
@@ -298,7 +374,9 @@ func handleWebUpdate(store *Store, sessions *webSessionFactory, w http.ResponseW
 		return
 	}
 
-	if err := store.Update(reqdata.Username, reqdata.NewPassword); err != nil {
+	err := store.Update(reqdata.Username, reqdata.NewPassword)
+	audit.Log(rec, err)
+	if err != nil {
 		respdata.Error = err.Error()
 		sendWebResponse(w, http.StatusBadRequest, respdata)
 		return
@@ -307,6 +385,58 @@ func handleWebUpdate(store *Store, sessions *webSessionFactory, w http.ResponseW
 	sendWebResponse(w, http.StatusOK, respdata)
 }
 
+type webCheckPasswordRequest struct {
+	Session  string `json:"session"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type webCheckPasswordResponse struct {
+	PolicyFeedback
+	Error string `json:"error,omitempty"`
+}
+
+func handleWebCheckPassword(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	wdl.Printf("web-api: got CHECK-PASSWORD request from %s", r.RemoteAddr)
+
+	decoder := json.NewDecoder(r.Body)
+	reqdata := &webCheckPasswordRequest{}
+	respdata := &webCheckPasswordResponse{}
+
+	if err := decoder.Decode(reqdata); err != nil {
+		respdata.Error = fmt.Sprintf("Error parsing JSON response: %s", err)
+		sendWebResponse(w, http.StatusBadRequest, respdata)
+		return
+	}
+
+	status, errorStr, username, isAdmin := sessions.Check(reqdata.Session)
+	if status != http.StatusOK {
+		respdata.Error = errorStr
+		sendWebResponse(w, status, respdata)
+		return
+	}
+
+	// the policy of a user tells whether it is an admin, only admins may check the
+	// passwords of other users
+	if reqdata.Username == "" {
+		reqdata.Username = username
+	}
+	if !isAdmin && username != reqdata.Username {
+		respdata.Error = "only admins are allowed to check passwords of other users"
+		sendWebResponse(w, http.StatusForbidden, respdata)
+		return
+	}
+
+	if reqdata.Password == "" {
+		respdata.Error = "empty password is not allowed"
+		sendWebResponse(w, http.StatusBadRequest, respdata)
+		return
+	}
+
+	respdata.PolicyFeedback = store.CheckPassword(reqdata.Username, reqdata.Password)
+	sendWebResponse(w, http.StatusOK, respdata)
+}
+
 type webSetAdminRequest struct {
 	Session  string `json:"session"`
 	Username string `json:"username"`
@@ -345,15 +475,20 @@ func handleWebSetAdmin(store *Store, sessions *webSessionFactory, w http.Respons
 		return
 	}
 
+	rec := auditRecord{Frontend: "http", Remote: webClientAddr(r), Actor: username, User: reqdata.Username,
+		Operation: "set-admin", Detail: fmt.Sprintf("admin=%t", reqdata.IsAdmin)}
 	if !isAdmin {
 		respdata.Error = "only admins are allowed to change the admin status of users"
+		audit.Log(rec, errors.New(respdata.Error))
 		sendWebResponse(w, http.StatusForbidden, respdata)
 		return
 	}
 
 	wdl.Printf("admin '%s' want's to set admin status of user '%s' to %t", username, reqdata.Username, reqdata.IsAdmin)
 
-	if err := store.SetAdmin(reqdata.Username, reqdata.IsAdmin); err != nil {
+	err := store.SetAdmin(reqdata.Username, reqdata.IsAdmin)
+	audit.Log(rec, err)
+	if err != nil {
 		respdata.Error = err.Error()
 		sendWebResponse(w, http.StatusBadRequest, respdata)
 		return
@@ -499,21 +634,114 @@ func (ln tcpKeepAliveListener) Accept() (c net.Conn, err error) {
 	return tc, nil
 }
 
-func newWebHandler(store *Store) (mux *http.ServeMux, err error) {
+func newWebSessionFactory(config *webSessionConfig) (*webSessionFactory, error) {
+	lifetime := config.Lifetime
+	if lifetime < 0 {
+		return nil, fmt.Errorf("invalid session lifetime '%v'", lifetime)
+	}
+	if lifetime == 0 {
+		lifetime = 10 * time.Minute
+	}
+	switch config.Format {
+	case "", "aes-gcm":
+		return NewWebSessionFactory(lifetime)
+	case "jwt":
+		signer, err := loadJWTSigner(config.SigningKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load session signing key: %v", err)
+		}
+		if config.SigningKey == "" {
+			wl.Printf("web-api: no session signing key configured, using a temporary key")
+		}
+		return NewJWTWebSessionFactory(lifetime, signer)
+	}
+	return nil, fmt.Errorf("unknown session format '%s', must be either 'aes-gcm' or 'jwt'", config.Format)
+}
+
+func newWebHandler(store *Store, config *webConfig) (mux *http.ServeMux, err error) {
 	var sessions *webSessionFactory
-	if sessions, err = NewWebSessionFactory(600 * time.Second); err != nil { // TODO: hardcoded value
+	if sessions, err = newWebSessionFactory(&config.Sessions); err != nil {
+		return
+	}
+	var jwks webJWKS
+	if sessions.signer != nil {
+		jwks = append(jwks, sessions.signer)
+	}
+	tokenCheckers := []webTokenChecker{sessions.Introspect}
+
+	var requireTLS *webRequireTLS
+	if requireTLS, err = newWebRequireTLS(config.RequireTLS); err != nil {
 		return
 	}
 
+	var ba webBasicAuth
+	if ba, err = newWebBasicAuth(&config.BasicAuth); err != nil {
+		return
+	}
+
+	// all handlers which accept passwords, reset tokens or client secrets, or which return
+	// newly generated ones, are wrapped using withTLS
+	withTLS := requireTLS.handler
 	mux = http.NewServeMux()
-	mux.Handle("/basic-auth", webHandler{store, sessions, handleWebBasicAuth})
-	mux.Handle("/api/authenticate", webHandler{store, sessions, handleWebAuthenticate})
-	mux.Handle("/api/add", webHandler{store, sessions, handleWebAdd})
+	mux.Handle("/basic-auth", webHandler{store, sessions, withTLS(ba.handleBasicAuth)})
+	mux.Handle("/api/authenticate", webHandler{store, sessions, withTLS(handleWebAuthenticate)})
+	mux.Handle("/api/add", webHandler{store, sessions, withTLS(handleWebAdd)})
 	mux.Handle("/api/remove", webHandler{store, sessions, handleWebRemove})
-	mux.Handle("/api/update", webHandler{store, sessions, handleWebUpdate})
+	mux.Handle("/api/update", webHandler{store, sessions, withTLS(handleWebUpdate)})
 	mux.Handle("/api/set-admin", webHandler{store, sessions, handleWebSetAdmin})
+	mux.Handle("/api/check-password", webHandler{store, sessions, withTLS(handleWebCheckPassword)})
 	mux.Handle("/api/list", webHandler{store, sessions, handleWebList})
 	mux.Handle("/api/list-full", webHandler{store, sessions, handleWebListFull})
+	mux.Handle("GET /healthz", webHandler{store, sessions, handleHealthz})
+	mux.Handle("GET /readyz", webHandler{store, sessions, handleReadyz})
+
+	fa := newWebForwardAuth(&config.ForwardAuth, ba)
+	mux.Handle("/forward-auth", webHandler{store, sessions, withTLS(fa.handleForwardAuth)})
+	mux.Handle("/login", webHandler{store, sessions, withTLS(fa.handleLogin)})
+	mux.Handle("POST /logout", webHandler{store, sessions, fa.handleLogout})
+
+	if config.OIDC != nil {
+		var oidc *webOIDCProvider
+		if oidc, err = newWebOIDCProvider(config.OIDC, fa); err != nil {
+			return
+		}
+		mux.Handle("GET /.well-known/openid-configuration", webHandler{store, sessions, oidc.handleDiscovery})
+		jwks = append(jwks, oidc.signer)
+		tokenCheckers = append(tokenCheckers, oidc.Introspect)
+		mux.Handle("/oidc/authorize", webHandler{store, sessions, withTLS(oidc.handleAuthorize)})
+		mux.Handle("POST /oidc/token", webHandler{store, sessions, withTLS(oidc.handleToken)})
+		mux.Handle("/oidc/userinfo", webHandler{store, sessions, oidc.handleUserinfo})
+	}
+	if len(jwks) > 0 {
+		mux.Handle("GET /.well-known/jwks.json", webHandler{store, sessions, jwks.handle})
+	}
+
+	var introspection *webIntrospection
+	if introspection, err = newWebIntrospection(&config.Introspection, tokenCheckers...); err != nil {
+		return
+	}
+	mux.Handle("POST /api/introspect", webHandler{store, sessions, withTLS(introspection.handle)})
+
+	var openapi http.HandlerFunc
+	if openapi, err = newOpenAPIHandler(); err != nil {
+		return
+	}
+	mux.HandleFunc("GET /api/openapi.json", openapi)
+
+	mux.Handle("POST /api/v2/sessions", webHandler{store, sessions, withTLS(handleWebV2CreateSession)})
+	mux.Handle("GET /api/v2/users", webHandler{store, sessions, handleWebV2ListUsers})
+	mux.Handle("GET /api/v2/users/{name}", webHandler{store, sessions, handleWebV2GetUser})
+	mux.Handle("PUT /api/v2/users/{name}", webHandler{store, sessions, withTLS(handleWebV2PutUser)})
+	mux.Handle("PATCH /api/v2/users/{name}", webHandler{store, sessions, withTLS(handleWebV2PatchUser)})
+	mux.Handle("DELETE /api/v2/users/{name}", webHandler{store, sessions, handleWebV2DeleteUser})
+	mux.Handle("GET /api/v2/users/{name}/app-passwords", webHandler{store, sessions, handleWebV2ListAppPasswords})
+	mux.Handle("PUT /api/v2/users/{name}/app-passwords/{app}", webHandler{store, sessions, withTLS(handleWebV2PutAppPassword)})
+	mux.Handle("DELETE /api/v2/users/{name}/app-passwords/{app}", webHandler{store, sessions, handleWebV2DeleteAppPassword})
+	mux.Handle("POST /api/v2/users/{name}/reset-token", webHandler{store, sessions, withTLS(handleWebV2CreateResetToken)})
+	mux.Handle("POST /api/v2/password-reset", webHandler{store, sessions, withTLS(handleWebV2PasswordReset)})
+	mux.Handle("GET /api/v2/throttle", webHandler{store, sessions, handleWebV2ListThrottled})
+	mux.Handle("DELETE /api/v2/throttle/{key}", webHandler{store, sessions, handleWebV2ResetThrottled})
+	mux.Handle("/api/v2/", webHandler{store, sessions, webV2Fallback(mux)})
 
 	mux.Handle("/admin/", http.StripPrefix("/admin/", http.FileServer(http.FS(ui.Assets))))
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -528,7 +756,7 @@ func newWebHandler(store *Store) (mux *http.ServeMux, err error) {
 
 func runHTTPsListener(listener *net.TCPListener, config *httpsConfig, store *Store) (err error) {
 	server := &http.Server{ReadTimeout: 60 * time.Second, WriteTimeout: 60 * time.Second}
-	if server.Handler, err = newWebHandler(store); err != nil {
+	if server.Handler, err = newWebHandler(store, &config.webConfig); err != nil {
 		return
 	}
 	if server.TLSConfig, err = config.TLS.ToGoTLSConfig(); err != nil {
@@ -551,7 +779,7 @@ func runHTTPsAddr(addr string, config *httpsConfig, store *Store) error {
 
 func runHTTPListener(listener *net.TCPListener, config *httpConfig, store *Store) (err error) {
 	server := &http.Server{ReadTimeout: 60 * time.Second, WriteTimeout: 60 * time.Second}
-	if server.Handler, err = newWebHandler(store); err != nil {
+	if server.Handler, err = newWebHandler(store, &config.webConfig); err != nil {
 		return
 	}
 	wl.Printf("web-api: listening on '%s'", listener.Addr())
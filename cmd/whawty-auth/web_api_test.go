@@ -0,0 +1,95 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestWebCheckPassword(t *testing.T) {
+	store := newTestStore(t, policyConfig{Type: "zxcvbn", Condition: "score >= 3", AdminType: "zxcvbn", AdminCondition: "score >= 4"}, "")
+	h, err := newWebHandler(store, &webConfig{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := store.Add("alice", "tiny purple elephant dances", false); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	session := webV2TestSession(t, h, testAdminName, testAdminPassword)
+	alice := webV2TestSession(t, h, "alice", "tiny purple elephant dances")
+
+	testvectors := []struct {
+		body   string
+		status int
+		ok     bool
+		error  bool
+	}{
+		{`{"session": "`, http.StatusBadRequest, false, true},
+		{`{"session": "invalid", "username": "alice", "password": "password"}`, http.StatusBadRequest, false, true},
+		{`{"session": "` + session + `", "username": "alice", "password": ""}`, http.StatusBadRequest, false, true},
+		{`{"session": "` + session + `", "username": "alice", "password": "password"}`, http.StatusOK, false, false},
+		{`{"session": "` + session + `", "username": "alice", "password": "purple monkey dishwasher"}`, http.StatusOK, true, false},
+		// admins use the stricter admin policy
+		{`{"session": "` + session + `", "username": "` + testAdminName + `", "password": "purple monkey dishwasher"}`, http.StatusOK, false, false},
+		{`{"session": "` + session + `", "password": "purple monkey dishwasher"}`, http.StatusOK, false, false},
+		// normal users may only check their own passwords
+		{`{"session": "` + alice + `", "password": "purple monkey dishwasher"}`, http.StatusOK, true, false},
+		{`{"session": "` + alice + `", "username": "alice", "password": "purple monkey dishwasher"}`, http.StatusOK, true, false},
+		{`{"session": "` + alice + `", "username": "` + testAdminName + `", "password": "purple monkey dishwasher"}`, http.StatusForbidden, false, true},
+	}
+	for _, vector := range testvectors {
+		w := webTestRequest(h, "POST", "/api/check-password", "", vector.body)
+		if w.Code != vector.status {
+			t.Fatalf("%s: expected status %d, got %d: %s", vector.body, vector.status, w.Code, w.Body.String())
+		}
+		resp := &webCheckPasswordResponse{}
+		if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+			t.Fatalf("%s: invalid response: %v", vector.body, err)
+		}
+		if (resp.Error != "") != vector.error {
+			t.Fatalf("%s: unexpected error value '%s'", vector.body, resp.Error)
+		}
+		if resp.OK != vector.ok {
+			t.Fatalf("%s: expected ok to be %t, got %+v", vector.body, vector.ok, resp.PolicyFeedback)
+		}
+		if vector.status != http.StatusOK {
+			continue
+		}
+		if resp.Warnings == nil || resp.Suggestions == nil || resp.CrackTimeDisplay == "" {
+			t.Fatalf("%s: incomplete feedback %s", vector.body, w.Body.String())
+		}
+		if resp.Score <= 2 && len(resp.Warnings) == 0 {
+			t.Fatalf("%s: weak password should come with warnings: %+v", vector.body, resp.PolicyFeedback)
+		}
+	}
+}
@@ -0,0 +1,669 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	storeLib "github.com/whawty/auth/store"
+)
+
+// error codes used by the v2 API
+const (
+	webV2ErrBadRequest           = "bad_request"
+	webV2ErrUnauthorized         = "unauthorized"
+	webV2ErrInvalidSession       = "invalid_session"
+	webV2ErrAuthenticationFailed = "authentication_failed"
+	webV2ErrForbidden            = "forbidden"
+	webV2ErrNotFound             = "not_found"
+	webV2ErrMethodNotAllowed     = "method_not_allowed"
+	webV2ErrPasswordPolicy       = "password_policy"
+	webV2ErrAppPasswordExists    = "app_password_exists"
+	webV2ErrInvalidResetToken    = "invalid_reset_token"
+	webV2ErrStoreError           = "store_error"
+	webV2ErrInternal             = "internal_error"
+)
+
+type webV2Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type webV2ErrorResponse struct {
+	Error webV2Error `json:"error"`
+}
+
+func sendWebV2Error(w http.ResponseWriter, status int, code, message string) {
+	sendWebResponse(w, status, &webV2ErrorResponse{Error: webV2Error{Code: code, Message: message}})
+}
+
+// sendWebV2StoreError sends the status and error code matching an error returned by the store.
+func sendWebV2StoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errUserNotFound):
+		sendWebV2Error(w, http.StatusNotFound, webV2ErrNotFound, err.Error())
+	case errors.Is(err, errPasswordPolicy):
+		sendWebV2Error(w, http.StatusUnprocessableEntity, webV2ErrPasswordPolicy, err.Error())
+	default:
+		sendWebV2Error(w, http.StatusBadRequest, webV2ErrStoreError, err.Error())
+	}
+}
+
+func decodeWebV2Request(w http.ResponseWriter, r *http.Request, reqdata interface{}) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(reqdata); err != nil {
+		sendWebV2Error(w, http.StatusBadRequest, webV2ErrBadRequest, fmt.Sprintf("Error parsing JSON request: %s", err))
+		return false
+	}
+	return true
+}
+
+func webBearerToken(r *http.Request) (token string, ok bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// checkWebV2Session validates the bearer token of the request. If the token is missing or
+// invalid an error response is sent and ok will be false.
+func checkWebV2Session(sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) (username string, isAdmin bool, ok bool) {
+	token, ok := webBearerToken(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="whawty.auth"`)
+		sendWebV2Error(w, http.StatusUnauthorized, webV2ErrUnauthorized, "missing bearer token")
+		return "", false, false
+	}
+
+	status, errorStr, username, isAdmin := sessions.Check(token)
+	if status != http.StatusOK {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="whawty.auth", error="invalid_token"`)
+		sendWebV2Error(w, status, webV2ErrInvalidSession, errorStr)
+		return "", false, false
+	}
+	return username, isAdmin, true
+}
+
+type webV2User struct {
+	Username    string    `json:"username"`
+	IsAdmin     bool      `json:"admin"`
+	LastChanged time.Time `json:"lastchanged"`
+	MustChange  bool      `json:"mustchange"`
+	Roles       []string  `json:"roles,omitempty"`
+	Services    []string  `json:"services,omitempty"`
+}
+
+func lookupWebV2User(store *Store, username string) (user *webV2User, err error) {
+	list, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	u, exists := list[username]
+	if !exists {
+		return nil, nil
+	}
+	return &webV2User{Username: username, IsAdmin: u.IsAdmin, LastChanged: u.LastChanged, MustChange: u.MustChange, Roles: u.Roles, Services: u.Services}, nil
+}
+
+func sendWebV2User(store *Store, w http.ResponseWriter, status int, username string) {
+	user, err := lookupWebV2User(store, username)
+	if err != nil {
+		sendWebV2Error(w, http.StatusInternalServerError, webV2ErrStoreError, err.Error())
+		return
+	}
+	if user == nil {
+		sendWebV2Error(w, http.StatusNotFound, webV2ErrNotFound, fmt.Sprintf("user '%s' does not exist", username))
+		return
+	}
+	sendWebResponse(w, status, user)
+}
+
+type webV2SessionRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type webV2SessionResponse struct {
+	Session     string    `json:"session"`
+	Username    string    `json:"username"`
+	IsAdmin     bool      `json:"admin"`
+	LastChanged time.Time `json:"lastchanged"`
+	MustChange  bool      `json:"mustchange"`
+}
+
+func handleWebV2CreateSession(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	wdl.Printf("web-api(v2): got CREATE SESSION request from %s", r.RemoteAddr)
+
+	reqdata := &webV2SessionRequest{}
+	if !decodeWebV2Request(w, r, reqdata) {
+		return
+	}
+	if reqdata.Username == "" || reqdata.Password == "" {
+		sendWebV2Error(w, http.StatusBadRequest, webV2ErrBadRequest, "empty username or password is not allowed")
+		return
+	}
+
+	ok, isAdmin, mustChange, lastChanged, err := store.Authenticate(reqdata.Username, reqdata.Password, webClientAddr(r))
+	audit.LogAuth(auditRecord{Frontend: "http", Remote: webClientAddr(r), User: reqdata.Username}, ok, err)
+	if err != nil || !ok {
+		sendWebV2Error(w, http.StatusUnauthorized, webV2ErrAuthenticationFailed, "authentication failed")
+		return
+	}
+
+	status, errorStr, session := sessions.Generate(reqdata.Username, isAdmin)
+	if status != http.StatusOK {
+		sendWebV2Error(w, status, webV2ErrInternal, errorStr)
+		return
+	}
+	respdata := &webV2SessionResponse{Session: session, Username: reqdata.Username, IsAdmin: isAdmin, LastChanged: lastChanged, MustChange: mustChange}
+	sendWebResponse(w, http.StatusCreated, respdata)
+}
+
+type webV2UserListResponse struct {
+	Users storeLib.UserList `json:"users"`
+}
+
+type webV2UserListFullResponse struct {
+	Users storeLib.UserListFull `json:"users"`
+}
+
+func handleWebV2ListUsers(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	wdl.Printf("web-api(v2): got LIST USERS request from %s", r.RemoteAddr)
+
+	username, isAdmin, ok := checkWebV2Session(sessions, w, r)
+	if !ok {
+		return
+	}
+	if !isAdmin {
+		sendWebV2Error(w, http.StatusForbidden, webV2ErrForbidden, "only admins are allowed to list users")
+		return
+	}
+
+	if r.URL.Query().Get("full") == "true" {
+		wdl.Printf("admin '%s' want's to list all users", username)
+		list, err := store.ListFull()
+		if err != nil {
+			sendWebV2Error(w, http.StatusInternalServerError, webV2ErrStoreError, err.Error())
+			return
+		}
+		sendWebResponse(w, http.StatusOK, &webV2UserListFullResponse{Users: list})
+		return
+	}
+
+	wdl.Printf("admin '%s' want's to list all supported users", username)
+	list, err := store.List()
+	if err != nil {
+		sendWebV2Error(w, http.StatusInternalServerError, webV2ErrStoreError, err.Error())
+		return
+	}
+	sendWebResponse(w, http.StatusOK, &webV2UserListResponse{Users: list})
+}
+
+func handleWebV2GetUser(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	wdl.Printf("web-api(v2): got GET USER request from %s", r.RemoteAddr)
+
+	username, isAdmin, ok := checkWebV2Session(sessions, w, r)
+	if !ok {
+		return
+	}
+	name := r.PathValue("name")
+	if !isAdmin && username != name {
+		sendWebV2Error(w, http.StatusForbidden, webV2ErrForbidden, "only admins are allowed to view other users")
+		return
+	}
+	sendWebV2User(store, w, http.StatusOK, name)
+}
+
+type webV2PutUserRequest struct {
+	Password string `json:"password"`
+	IsAdmin  bool   `json:"admin"`
+}
+
+func handleWebV2PutUser(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	wdl.Printf("web-api(v2): got PUT USER request from %s", r.RemoteAddr)
+
+	username, isAdmin, ok := checkWebV2Session(sessions, w, r)
+	if !ok {
+		return
+	}
+	rec := auditRecord{Frontend: "http", Remote: webClientAddr(r), Actor: username, User: r.PathValue("name"), Operation: "add"}
+	if !isAdmin {
+		audit.Log(rec, errors.New("only admins are allowed to add users"))
+		sendWebV2Error(w, http.StatusForbidden, webV2ErrForbidden, "only admins are allowed to add users")
+		return
+	}
+
+	reqdata := &webV2PutUserRequest{}
+	if !decodeWebV2Request(w, r, reqdata) {
+		return
+	}
+	if reqdata.Password == "" {
+		sendWebV2Error(w, http.StatusBadRequest, webV2ErrBadRequest, "empty password is not allowed")
+		return
+	}
+
+	name := r.PathValue("name")
+	wdl.Printf("admin '%s' want's to add or replace user '%s' and admin status: %t", username, name, reqdata.IsAdmin)
+
+	rec.Detail = fmt.Sprintf("admin=%t", reqdata.IsAdmin)
+	created, err := store.ModifyUser(name, &reqdata.Password, &reqdata.IsAdmin, true)
+	if !created && err == nil {
+		rec.Operation = "update"
+	}
+	audit.Log(rec, err)
+	if err != nil {
+		sendWebV2StoreError(w, err)
+		return
+	}
+	if created {
+		sendWebV2User(store, w, http.StatusCreated, name)
+		return
+	}
+	sendWebV2User(store, w, http.StatusOK, name)
+}
+
+type webV2PatchUserRequest struct {
+	Password *string `json:"password,omitempty"`
+	IsAdmin  *bool   `json:"admin,omitempty"`
+}
+
+func handleWebV2PatchUser(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	wdl.Printf("web-api(v2): got PATCH USER request from %s", r.RemoteAddr)
+
+	username, isAdmin, ok := checkWebV2Session(sessions, w, r)
+	if !ok {
+		return
+	}
+
+	reqdata := &webV2PatchUserRequest{}
+	if !decodeWebV2Request(w, r, reqdata) {
+		return
+	}
+	if reqdata.Password == nil && reqdata.IsAdmin == nil {
+		sendWebV2Error(w, http.StatusBadRequest, webV2ErrBadRequest, "at least one of password or admin must be supplied")
+		return
+	}
+	if reqdata.Password != nil && *reqdata.Password == "" {
+		sendWebV2Error(w, http.StatusBadRequest, webV2ErrBadRequest, "empty password is not allowed")
+		return
+	}
+
+	name := r.PathValue("name")
+	rec := auditRecord{Frontend: "http", Remote: webClientAddr(r), Actor: username, User: name}
+	if !isAdmin {
+		if username != name {
+			rec.Operation = "update"
+			audit.Log(rec, errors.New("only admins are allowed to update any users' password"))
+			sendWebV2Error(w, http.StatusForbidden, webV2ErrForbidden, "only admins are allowed to update any users' password")
+			return
+		}
+		if reqdata.IsAdmin != nil {
+			rec.Operation = "set-admin"
+			audit.Log(rec, errors.New("only admins are allowed to change the admin status of users"))
+			sendWebV2Error(w, http.StatusForbidden, webV2ErrForbidden, "only admins are allowed to change the admin status of users")
+			return
+		}
+	}
+
+	wdl.Printf("user '%s' want's to update user '%s', using a valid session", username, name)
+	_, err := store.ModifyUser(name, reqdata.Password, reqdata.IsAdmin, false)
+	if reqdata.Password != nil {
+		rec.Operation = "update"
+		audit.Log(rec, err)
+	}
+	if reqdata.IsAdmin != nil {
+		rec.Operation = "set-admin"
+		rec.Detail = fmt.Sprintf("admin=%t", *reqdata.IsAdmin)
+		audit.Log(rec, err)
+	}
+	if err != nil {
+		sendWebV2StoreError(w, err)
+		return
+	}
+	sendWebV2User(store, w, http.StatusOK, name)
+}
+
+func handleWebV2DeleteUser(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	wdl.Printf("web-api(v2): got DELETE USER request from %s", r.RemoteAddr)
+
+	username, isAdmin, ok := checkWebV2Session(sessions, w, r)
+	if !ok {
+		return
+	}
+	rec := auditRecord{Frontend: "http", Remote: webClientAddr(r), Actor: username, User: r.PathValue("name"), Operation: "remove"}
+	if !isAdmin {
+		audit.Log(rec, errors.New("only admins are allowed to remove users"))
+		sendWebV2Error(w, http.StatusForbidden, webV2ErrForbidden, "only admins are allowed to remove users")
+		return
+	}
+
+	name := r.PathValue("name")
+	list, err := store.ListFull()
+	if err != nil {
+		sendWebV2Error(w, http.StatusInternalServerError, webV2ErrStoreError, err.Error())
+		return
+	}
+	if _, exists := list[name]; !exists {
+		sendWebV2Error(w, http.StatusNotFound, webV2ErrNotFound, fmt.Sprintf("user '%s' does not exist", name))
+		return
+	}
+
+	wdl.Printf("admin '%s' want's to remove user '%s'", username, name)
+
+	err = store.Remove(name)
+	audit.Log(rec, err)
+	if err != nil {
+		sendWebV2StoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type webV2AppPasswordListResponse struct {
+	AppPasswords []storeLib.AppPassword `json:"app_passwords"`
+}
+
+type webV2AppPasswordResponse struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+func lookupWebV2AppPassword(store *Store, username, name string) (exists bool, err error) {
+	list, err := store.ListAppPasswords(username)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range list {
+		if p.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func handleWebV2ListAppPasswords(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	wdl.Printf("web-api(v2): got LIST APP PASSWORDS request from %s", r.RemoteAddr)
+
+	username, isAdmin, ok := checkWebV2Session(sessions, w, r)
+	if !ok {
+		return
+	}
+	name := r.PathValue("name")
+	if !isAdmin && username != name {
+		sendWebV2Error(w, http.StatusForbidden, webV2ErrForbidden, "only admins are allowed to list application passwords of other users")
+		return
+	}
+	if user, err := lookupWebV2User(store, name); err != nil {
+		sendWebV2Error(w, http.StatusInternalServerError, webV2ErrStoreError, err.Error())
+		return
+	} else if user == nil {
+		sendWebV2Error(w, http.StatusNotFound, webV2ErrNotFound, fmt.Sprintf("user '%s' does not exist", name))
+		return
+	}
+
+	list, err := store.ListAppPasswords(name)
+	if err != nil {
+		sendWebV2Error(w, http.StatusInternalServerError, webV2ErrStoreError, err.Error())
+		return
+	}
+	sendWebResponse(w, http.StatusOK, &webV2AppPasswordListResponse{AppPasswords: list})
+}
+
+func handleWebV2PutAppPassword(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	wdl.Printf("web-api(v2): got PUT APP PASSWORD request from %s", r.RemoteAddr)
+
+	username, _, ok := checkWebV2Session(sessions, w, r)
+	if !ok {
+		return
+	}
+	name, app := r.PathValue("name"), r.PathValue("app")
+	rec := auditRecord{Frontend: "http", Remote: webClientAddr(r), Actor: username, User: name, Operation: "add-app-password", Detail: app}
+	if username != name {
+		audit.Log(rec, errors.New("application passwords can only be created by the user itself"))
+		sendWebV2Error(w, http.StatusForbidden, webV2ErrForbidden, "application passwords can only be created by the user itself")
+		return
+	}
+
+	if exists, err := lookupWebV2AppPassword(store, name, app); err != nil {
+		sendWebV2Error(w, http.StatusInternalServerError, webV2ErrStoreError, err.Error())
+		return
+	} else if exists {
+		sendWebV2Error(w, http.StatusConflict, webV2ErrAppPasswordExists, fmt.Sprintf("application password '%s' already exists", app))
+		return
+	}
+
+	wdl.Printf("user '%s' want's to add application password '%s'", username, app)
+
+	password, err := store.AddAppPassword(name, app)
+	audit.Log(rec, err)
+	if err != nil {
+		sendWebV2StoreError(w, err)
+		return
+	}
+	sendWebResponse(w, http.StatusCreated, &webV2AppPasswordResponse{Name: app, Password: password})
+}
+
+func handleWebV2DeleteAppPassword(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	wdl.Printf("web-api(v2): got DELETE APP PASSWORD request from %s", r.RemoteAddr)
+
+	username, isAdmin, ok := checkWebV2Session(sessions, w, r)
+	if !ok {
+		return
+	}
+	name, app := r.PathValue("name"), r.PathValue("app")
+	rec := auditRecord{Frontend: "http", Remote: webClientAddr(r), Actor: username, User: name, Operation: "remove-app-password", Detail: app}
+	if !isAdmin && username != name {
+		audit.Log(rec, errors.New("only admins are allowed to revoke application passwords of other users"))
+		sendWebV2Error(w, http.StatusForbidden, webV2ErrForbidden, "only admins are allowed to revoke application passwords of other users")
+		return
+	}
+
+	if exists, err := lookupWebV2AppPassword(store, name, app); err != nil {
+		sendWebV2Error(w, http.StatusInternalServerError, webV2ErrStoreError, err.Error())
+		return
+	} else if !exists {
+		sendWebV2Error(w, http.StatusNotFound, webV2ErrNotFound, fmt.Sprintf("application password '%s' does not exist", app))
+		return
+	}
+
+	wdl.Printf("user '%s' want's to revoke application password '%s' of user '%s'", username, app, name)
+
+	err := store.RemoveAppPassword(name, app)
+	audit.Log(rec, err)
+	if err != nil {
+		sendWebV2StoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type webV2ResetTokenResponse struct {
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+func handleWebV2CreateResetToken(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	wdl.Printf("web-api(v2): got CREATE RESET TOKEN request from %s", r.RemoteAddr)
+
+	username, isAdmin, ok := checkWebV2Session(sessions, w, r)
+	if !ok {
+		return
+	}
+	name := r.PathValue("name")
+	rec := auditRecord{Frontend: "http", Remote: webClientAddr(r), Actor: username, User: name, Operation: "create-reset-token"}
+	if !isAdmin {
+		audit.Log(rec, errors.New("only admins are allowed to create reset tokens"))
+		sendWebV2Error(w, http.StatusForbidden, webV2ErrForbidden, "only admins are allowed to create reset tokens")
+		return
+	}
+
+	validFor := store.resetTokenValidity
+	if v := r.URL.Query().Get("valid_for"); v != "" {
+		var err error
+		if validFor, err = time.ParseDuration(v); err != nil || validFor <= 0 {
+			sendWebV2Error(w, http.StatusBadRequest, webV2ErrBadRequest, fmt.Sprintf("invalid value for valid_for: '%s'", v))
+			return
+		}
+	}
+
+	if user, err := lookupWebV2User(store, name); err != nil {
+		sendWebV2Error(w, http.StatusInternalServerError, webV2ErrStoreError, err.Error())
+		return
+	} else if user == nil {
+		sendWebV2Error(w, http.StatusNotFound, webV2ErrNotFound, fmt.Sprintf("user '%s' does not exist", name))
+		return
+	}
+
+	wdl.Printf("admin '%s' want's to create a reset token for user '%s' valid for %v", username, name, validFor)
+
+	rec.Detail = fmt.Sprintf("valid-for=%v", validFor)
+	token, expires, err := store.CreateResetToken(name, validFor)
+	audit.Log(rec, err)
+	if err != nil {
+		sendWebV2StoreError(w, err)
+		return
+	}
+	sendWebResponse(w, http.StatusCreated, &webV2ResetTokenResponse{Token: token, Expires: expires})
+}
+
+type webV2PasswordResetRequest struct {
+	Username string `json:"username"`
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func handleWebV2PasswordReset(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	wdl.Printf("web-api(v2): got PASSWORD RESET request from %s", r.RemoteAddr)
+
+	reqdata := &webV2PasswordResetRequest{}
+	if !decodeWebV2Request(w, r, reqdata) {
+		return
+	}
+	if reqdata.Username == "" || reqdata.Token == "" || reqdata.Password == "" {
+		sendWebV2Error(w, http.StatusBadRequest, webV2ErrBadRequest, "empty username, token or password is not allowed")
+		return
+	}
+
+	err := store.ResetPassword(reqdata.Username, reqdata.Token, reqdata.Password, webClientAddr(r))
+	audit.Log(auditRecord{Frontend: "http", Remote: webClientAddr(r), User: reqdata.Username, Operation: "reset-password"}, err)
+	if err == errResetTokenInvalid {
+		sendWebV2Error(w, http.StatusForbidden, webV2ErrInvalidResetToken, err.Error())
+		return
+	} else if err != nil {
+		sendWebV2StoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type webV2ThrottleListResponse struct {
+	Entries storeLib.ThrottleList `json:"entries"`
+}
+
+func handleWebV2ListThrottled(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	wdl.Printf("web-api(v2): got LIST THROTTLED request from %s", r.RemoteAddr)
+
+	username, isAdmin, ok := checkWebV2Session(sessions, w, r)
+	if !ok {
+		return
+	}
+	if !isAdmin {
+		sendWebV2Error(w, http.StatusForbidden, webV2ErrForbidden, "only admins are allowed to list throttled users and clients")
+		return
+	}
+
+	wdl.Printf("admin '%s' want's to list throttled users and clients", username)
+
+	list, err := store.ListThrottled()
+	if err != nil {
+		sendWebV2Error(w, http.StatusInternalServerError, webV2ErrStoreError, err.Error())
+		return
+	}
+	sendWebResponse(w, http.StatusOK, &webV2ThrottleListResponse{Entries: list})
+}
+
+func handleWebV2ResetThrottled(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	wdl.Printf("web-api(v2): got RESET THROTTLED request from %s", r.RemoteAddr)
+
+	username, isAdmin, ok := checkWebV2Session(sessions, w, r)
+	if !ok {
+		return
+	}
+	if !isAdmin {
+		sendWebV2Error(w, http.StatusForbidden, webV2ErrForbidden, "only admins are allowed to reset throttled users and clients")
+		return
+	}
+
+	key := r.PathValue("key")
+	wdl.Printf("admin '%s' want's to reset throttling state of '%s'", username, key)
+
+	found, err := store.ResetThrottled(key)
+	audit.Log(auditRecord{Frontend: "http", Remote: webClientAddr(r), Actor: username, Operation: "reset-throttle", Detail: key}, err)
+	if err != nil {
+		sendWebV2Error(w, http.StatusInternalServerError, webV2ErrStoreError, err.Error())
+		return
+	}
+	if !found {
+		sendWebV2Error(w, http.StatusNotFound, webV2ErrNotFound, fmt.Sprintf("'%s' is not throttled", key))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// webV2Fallback returns the handler for all requests which don't match any other v2 route of
+// mux, it must be registered as '/api/v2/'. If the path matches a route using another method
+// 405 is sent, otherwise 404.
+func webV2Fallback(mux *http.ServeMux) func(*Store, *webSessionFactory, http.ResponseWriter, *http.Request) {
+	return func(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+		var allowed []string
+		for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+			probe := r.Clone(r.Context())
+			probe.Method = method
+			if _, pattern := mux.Handler(probe); pattern != "/api/v2/" {
+				allowed = append(allowed, method)
+			}
+		}
+		if len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			sendWebV2Error(w, http.StatusMethodNotAllowed, webV2ErrMethodNotAllowed, fmt.Sprintf("method %s is not allowed for %s", r.Method, r.URL.Path))
+			return
+		}
+		sendWebV2Error(w, http.StatusNotFound, webV2ErrNotFound, fmt.Sprintf("no such resource: %s %s", r.Method, r.URL.Path))
+	}
+}
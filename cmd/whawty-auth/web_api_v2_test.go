@@ -0,0 +1,334 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func webV2TestSession(t *testing.T, h http.Handler, username, password string) string {
+	w := webTestRequest(h, "POST", "/api/v2/sessions", "", `{"username": "`+username+`", "password": "`+password+`"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("creating session for '%s' failed: %d %s", username, w.Code, w.Body.String())
+	}
+	resp := &webV2SessionResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	return resp.Session
+}
+
+func TestWebV2Users(t *testing.T) {
+	store := newTestStore(t, policyConfig{Type: "zxcvbn", Condition: "score >= 3"}, "")
+	h, err := newWebHandler(store, &webConfig{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	admin := webV2TestSession(t, h, testAdminName, testAdminPassword)
+
+	testvectors := []struct {
+		method string
+		path   string
+		token  string
+		body   string
+		status int
+		code   string
+	}{
+		{"PUT", "/api/v2/users/alice", "", `{"password": "purple monkey dishwasher"}`, http.StatusUnauthorized, webV2ErrUnauthorized},
+		{"PUT", "/api/v2/users/alice", admin, `{"password": "secret"}`, http.StatusUnprocessableEntity, webV2ErrPasswordPolicy},
+		{"PUT", "/api/v2/users/alice", admin, `{"password": "purple monkey dishwasher"}`, http.StatusCreated, ""},
+		// PUT on an existing user replaces it
+		{"PUT", "/api/v2/users/alice", admin, `{"password": "purple monkey dishwasher"}`, http.StatusOK, ""},
+		{"GET", "/api/v2/users/alice", admin, "", http.StatusOK, ""},
+		{"GET", "/api/v2/users/bob", admin, "", http.StatusNotFound, webV2ErrNotFound},
+		{"PATCH", "/api/v2/users/bob", admin, `{"admin": true}`, http.StatusNotFound, webV2ErrNotFound},
+		{"PATCH", "/api/v2/users/alice", admin, `{}`, http.StatusBadRequest, webV2ErrBadRequest},
+		// the password policy fails, so the admin status must not be changed either
+		{"PATCH", "/api/v2/users/alice", admin, `{"password": "secret", "admin": true}`, http.StatusUnprocessableEntity, webV2ErrPasswordPolicy},
+		{"POST", "/api/v2/users/alice", admin, `{}`, http.StatusMethodNotAllowed, webV2ErrMethodNotAllowed},
+		{"GET", "/api/v2/does-not-exist", admin, "", http.StatusNotFound, webV2ErrNotFound},
+		{"DELETE", "/api/v2/users/alice", admin, "", http.StatusNoContent, ""},
+		{"DELETE", "/api/v2/users/alice", admin, "", http.StatusNotFound, webV2ErrNotFound},
+	}
+	for _, vector := range testvectors {
+		w := webTestRequest(h, vector.method, vector.path, vector.token, vector.body)
+		if w.Code != vector.status {
+			t.Fatalf("%s %s %s: expected status %d, got %d: %s", vector.method, vector.path, vector.body, vector.status, w.Code, w.Body.String())
+		}
+		if vector.code == "" {
+			continue
+		}
+		resp := &webV2ErrorResponse{}
+		if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+			t.Fatalf("%s %s: invalid error response: %v", vector.method, vector.path, err)
+		}
+		if resp.Error.Code != vector.code {
+			t.Fatalf("%s %s %s: expected error code '%s', got '%s'", vector.method, vector.path, vector.body, vector.code, resp.Error.Code)
+		}
+		if vector.path == "/api/v2/users/alice" && vector.method == "PATCH" {
+			if user, err := lookupWebV2User(store, "alice"); err != nil || user == nil || user.IsAdmin {
+				t.Fatalf("failed PATCH has been partially applied: %+v, %v", user, err)
+			}
+		}
+	}
+
+	w := webTestRequest(h, "POST", "/api/v2/users/alice", admin, "")
+	if allow := w.Header().Get("Allow"); allow != "GET, PUT, PATCH, DELETE" {
+		t.Errorf("wrong Allow header: '%s'", allow)
+	}
+}
+
+func TestWebV2UsersPermissions(t *testing.T) {
+	store := newTestStore(t, policyConfig{}, "")
+	h, err := newWebHandler(store, &webConfig{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := store.Add("alice", "alice-secret", false); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	alice := webV2TestSession(t, h, "alice", "alice-secret")
+
+	testvectors := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"GET", "/api/v2/users/alice", "", http.StatusOK},
+		{"GET", "/api/v2/users/admin", "", http.StatusForbidden},
+		{"GET", "/api/v2/users", "", http.StatusForbidden},
+		{"PUT", "/api/v2/users/bob", `{"password": "bob-secret"}`, http.StatusForbidden},
+		{"PATCH", "/api/v2/users/alice", `{"admin": true}`, http.StatusForbidden},
+		{"PATCH", "/api/v2/users/admin", `{"password": "new-secret"}`, http.StatusForbidden},
+		{"PATCH", "/api/v2/users/alice", `{"password": "new-secret"}`, http.StatusOK},
+		{"DELETE", "/api/v2/users/alice", "", http.StatusForbidden},
+	}
+	for _, vector := range testvectors {
+		if w := webTestRequest(h, vector.method, vector.path, alice, vector.body); w.Code != vector.status {
+			t.Errorf("%s %s %s: expected status %d, got %d: %s", vector.method, vector.path, vector.body, vector.status, w.Code, w.Body.String())
+		}
+	}
+	if ok, _, _, _, err := store.Authenticate("alice", "new-secret", ""); err != nil || !ok {
+		t.Errorf("password has not been changed: %v", err)
+	}
+}
+
+func webV2TestResetToken(t *testing.T, h http.Handler, session, name, query string) *webV2ResetTokenResponse {
+	w := webTestRequest(h, "POST", "/api/v2/users/"+name+"/reset-token"+query, session, "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("creating reset token for '%s' failed: %d %s", name, w.Code, w.Body.String())
+	}
+	resp := &webV2ResetTokenResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	return resp
+}
+
+func webV2TestPasswordReset(h http.Handler, username, token, password string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(&webV2PasswordResetRequest{Username: username, Token: token, Password: password})
+	return webTestRequest(h, "POST", "/api/v2/password-reset", "", string(body))
+}
+
+func TestWebV2ResetToken(t *testing.T) {
+	store := newTestStore(t, policyConfig{}, "")
+	store.resetTokenValidity = time.Hour
+	h, err := newWebHandler(store, &webConfig{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := store.Add("alice", "alice-secret", false); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	admin := webV2TestSession(t, h, testAdminName, testAdminPassword)
+	alice := webV2TestSession(t, h, "alice", "alice-secret")
+
+	testvectors := []struct {
+		path   string
+		token  string
+		status int
+	}{
+		{"/api/v2/users/alice/reset-token", "", http.StatusUnauthorized},
+		{"/api/v2/users/alice/reset-token", alice, http.StatusForbidden},
+		{"/api/v2/users/bob/reset-token", admin, http.StatusNotFound},
+		{"/api/v2/users/alice/reset-token?valid_for=invalid", admin, http.StatusBadRequest},
+		{"/api/v2/users/alice/reset-token?valid_for=-1h", admin, http.StatusBadRequest},
+	}
+	for _, vector := range testvectors {
+		if w := webTestRequest(h, "POST", vector.path, vector.token, ""); w.Code != vector.status {
+			t.Errorf("POST %s: expected status %d, got %d: %s", vector.path, vector.status, w.Code, w.Body.String())
+		}
+	}
+
+	resp := webV2TestResetToken(t, h, admin, "alice", "")
+	if resp.Token == "" {
+		t.Fatal("reset token is empty")
+	}
+	if d := time.Until(resp.Expires); d > time.Hour || d < 59*time.Minute {
+		t.Fatalf("reset token should use the configured default validity, expires in %v", d)
+	}
+	resp = webV2TestResetToken(t, h, admin, "alice", "?valid_for=10m")
+	if d := time.Until(resp.Expires); d > 10*time.Minute || d < 9*time.Minute {
+		t.Fatalf("reset token should be valid for 10m, expires in %v", d)
+	}
+}
+
+func TestWebV2PasswordReset(t *testing.T) {
+	store := newTestStore(t, policyConfig{Type: "zxcvbn", Condition: "score >= 3"}, "")
+	h, err := newWebHandler(store, &webConfig{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := store.Add("alice", "tiny purple elephant dances", false); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	admin := webV2TestSession(t, h, testAdminName, testAdminPassword)
+	old := webV2TestResetToken(t, h, admin, "alice", "")
+	token := webV2TestResetToken(t, h, admin, "alice", "").Token
+
+	testvectors := []struct {
+		username string
+		token    string
+		password string
+		status   int
+		code     string
+	}{
+		{"alice", "", "purple monkey dishwasher", http.StatusBadRequest, webV2ErrBadRequest},
+		{"alice", token, "", http.StatusBadRequest, webV2ErrBadRequest},
+		{"alice", "invalid", "purple monkey dishwasher", http.StatusForbidden, webV2ErrInvalidResetToken},
+		// creating a new token replaces the old one
+		{"alice", old.Token, "purple monkey dishwasher", http.StatusForbidden, webV2ErrInvalidResetToken},
+		{"bob", token, "purple monkey dishwasher", http.StatusForbidden, webV2ErrInvalidResetToken},
+		{testAdminName, token, "purple monkey dishwasher", http.StatusForbidden, webV2ErrInvalidResetToken},
+		// the token is checked before the password policy
+		{testAdminName, "invalid", "secret", http.StatusForbidden, webV2ErrInvalidResetToken},
+		// a password rejected by the policy doesn't use up the token
+		{"alice", token, "secret", http.StatusUnprocessableEntity, webV2ErrPasswordPolicy},
+		{"alice", token, "purple monkey dishwasher", http.StatusNoContent, ""},
+		// the token can only be used once
+		{"alice", token, "another purple monkey dishwasher", http.StatusForbidden, webV2ErrInvalidResetToken},
+	}
+	for _, vector := range testvectors {
+		w := webV2TestPasswordReset(h, vector.username, vector.token, vector.password)
+		if w.Code != vector.status {
+			t.Fatalf("reset of '%s' using '%s': expected status %d, got %d: %s", vector.username, vector.token, vector.status, w.Code, w.Body.String())
+		}
+		if vector.code == "" {
+			continue
+		}
+		resp := &webV2ErrorResponse{}
+		if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+			t.Fatalf("invalid error response: %v", err)
+		}
+		if resp.Error.Code != vector.code {
+			t.Fatalf("reset of '%s' using '%s': expected error code '%s', got '%s'", vector.username, vector.token, vector.code, resp.Error.Code)
+		}
+	}
+
+	if ok, _, _, _, err := store.Authenticate("alice", "purple monkey dishwasher", ""); err != nil || !ok {
+		t.Fatalf("password has not been changed: %v", err)
+	}
+	if ok, _, _, _, _ := store.Authenticate("alice", "tiny purple elephant dances", ""); ok {
+		t.Fatal("old password is still valid")
+	}
+}
+
+func TestWebV2PasswordResetThrottle(t *testing.T) {
+	throttle := testThrottleConfig
+	throttle.User.Attempts = 1
+	store := newTestStoreWithConfig(t, filepath.Join(t.TempDir(), "store"), policyConfig{}, "", throttle, testReadinessConfig)
+	h, err := newWebHandler(store, &webConfig{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := store.Add("alice", "alice-secret", false); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	admin := webV2TestSession(t, h, testAdminName, testAdminPassword)
+	token := webV2TestResetToken(t, h, admin, "alice", "").Token
+
+	if w := webV2TestPasswordReset(h, "alice", "invalid", "new-secret"); w.Code != http.StatusForbidden {
+		t.Fatalf("invalid token should be rejected with 403, got %d: %s", w.Code, w.Body.String())
+	}
+	// the valid token is rejected as well as long as the user is throttled
+	if w := webV2TestPasswordReset(h, "alice", token, "new-secret"); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "too many failed attempts") {
+		t.Fatalf("password reset should be throttled after a failed attempt, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestWebV2SessionMustChange(t *testing.T) {
+	store := newTestStore(t, policyConfig{AdminType: "zxcvbn", AdminCondition: "score >= 3"}, "")
+	h, err := newWebHandler(store, &webConfig{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := store.Add("alice", "alice-secret", false); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	mustChange := func(path, body string) bool {
+		w := webTestRequest(h, "POST", path, "", body)
+		if w.Code != http.StatusCreated && w.Code != http.StatusOK {
+			t.Fatalf("POST %s failed: %d %s", path, w.Code, w.Body.String())
+		}
+		resp := &webV2SessionResponse{}
+		if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		return resp.MustChange
+	}
+	credentials := `{"username": "alice", "password": "alice-secret"}`
+	if mustChange("/api/v2/sessions", credentials) || mustChange("/api/authenticate", credentials) {
+		t.Fatal("must-change flag is set for a new user")
+	}
+
+	// the password has been checked against the default policy which is weaker
+	if err := store.SetAdmin("alice", true); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if !mustChange("/api/v2/sessions", credentials) || !mustChange("/api/authenticate", credentials) {
+		t.Fatal("must-change flag of promoted user is not returned")
+	}
+
+	if err := store.Update("alice", "purple monkey dishwasher"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if mustChange("/api/v2/sessions", `{"username": "alice", "password": "purple monkey dishwasher"}`) {
+		t.Fatal("must-change flag is still set after the password has been changed")
+	}
+}
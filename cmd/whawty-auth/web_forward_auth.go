@@ -0,0 +1,312 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const webSessionCookieName = "whawty-auth-session"
+
+var webLoginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>whawty.auth login</title>
+</head>
+<body>
+  <h1>whawty.auth</h1>
+{{- if .Username }}
+  <p>You are logged in as <strong>{{ .Username }}</strong>.</p>
+  <form method="post" action="logout">
+    <button type="submit">Logout</button>
+  </form>
+{{- else }}
+{{- if .Error }}
+  <p><strong>{{ .Error }}</strong></p>
+{{- end }}
+  <form method="post" action="login">
+    <input type="hidden" name="rd" value="{{ .Redirect }}">
+    <p><label>Username <input type="text" name="username" autocomplete="username" required autofocus></label></p>
+    <p><label>Password <input type="password" name="password" autocomplete="current-password" required></label></p>
+    <p><button type="submit">Login</button></p>
+  </form>
+{{- end }}
+</body>
+</html>
+`))
+
+type webLoginPage struct {
+	Username string
+	Redirect string
+	Error    string
+}
+
+// webForwardAuth implements the forward-auth endpoint for reverse proxies as well as the
+// login page which is used to get a session cookie. Logins and logouts are only accepted
+// if they have been sent by the login page itself. The service users must be allowed to
+// use is selected just like for /basic-auth.
+type webForwardAuth struct {
+	config    *webForwardAuthConfig
+	basicAuth webBasicAuth
+	csrf      *http.CrossOriginProtection
+}
+
+func newWebForwardAuth(config *webForwardAuthConfig, basicAuth webBasicAuth) webForwardAuth {
+	return webForwardAuth{config: config, basicAuth: basicAuth, csrf: http.NewCrossOriginProtection()}
+}
+
+// webOriginalURL returns the URL of the request the reverse proxy wants to authorize.
+// Traefik and Caddy use the X-Forwarded-* headers, for nginx X-Original-URL must be set
+// using proxy_set_header.
+func webOriginalURL(r *http.Request) string {
+	if u := r.Header.Get("X-Original-URL"); u != "" {
+		return u
+	}
+	host := r.Header.Get("X-Forwarded-Host")
+	if host == "" {
+		return ""
+	}
+	proto := r.Header.Get("X-Forwarded-Proto")
+	if proto == "" {
+		proto = "https"
+	}
+	return proto + "://" + host + r.Header.Get("X-Forwarded-Uri")
+}
+
+// requestIsSecure checks whether the browser has used TLS. X-Forwarded-Proto is only honoured
+// for the trusted proxies of the section basic-auth.
+func (fa webForwardAuth) requestIsSecure(r *http.Request) bool {
+	return r.TLS != nil || fa.basicAuth.forwardedHeader(r, "X-Forwarded-Proto") == "https"
+}
+
+// redirectAllowed checks whether it is safe to send the user to rd after the login. Only
+// relative URLs and URLs which point to the cookie domain (or the host of the login page
+// if no cookie domain is configured) are allowed.
+func (fa webForwardAuth) redirectAllowed(rd string, r *http.Request) bool {
+	u, err := url.Parse(rd)
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "" && u.Host == "" {
+		return strings.HasPrefix(u.Path, "/") && !strings.HasPrefix(rd, "//") && !strings.HasPrefix(rd, "/\\")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+
+	domain := strings.TrimPrefix(fa.config.CookieDomain, ".")
+	if domain == "" {
+		domain = r.Host
+		if host, _, err := net.SplitHostPort(r.Host); err == nil {
+			domain = host
+		}
+	}
+	host := strings.ToLower(u.Hostname())
+	domain = strings.ToLower(domain)
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+func (fa webForwardAuth) loginURL(rd string) string {
+	login := fa.config.LoginURL
+	if login == "" {
+		login = "/login"
+	}
+	if rd == "" {
+		return login
+	}
+	sep := "?"
+	if strings.Contains(login, "?") {
+		sep = "&"
+	}
+	return login + sep + "rd=" + url.QueryEscape(rd)
+}
+
+func (fa webForwardAuth) setSessionCookie(w http.ResponseWriter, r *http.Request, session string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     webSessionCookieName,
+		Value:    session,
+		Path:     "/",
+		Domain:   fa.config.CookieDomain,
+		MaxAge:   maxAge,
+		Secure:   fa.requestIsSecure(r),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// checkSession returns the user of a valid session cookie. Only forward-auth sessions are
+// accepted, the session tokens of the web-api are not valid as cookie and vice versa.
+func (fa webForwardAuth) checkSession(sessions *webSessionFactory, r *http.Request) (username string, isAdmin, ok bool) {
+	cookie, err := r.Cookie(webSessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return
+	}
+	status, _, username, isAdmin := sessions.CheckForwardAuth(cookie.Value)
+	return username, isAdmin, status == http.StatusOK
+}
+
+func (fa webForwardAuth) handleForwardAuth(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	wdl.Printf("web-api: got FORWARD_AUTH request from %s", r.RemoteAddr)
+
+	service := fa.basicAuth.service(r)
+	username, isAdmin, ok := "", false, false
+	if user, password, basic := r.BasicAuth(); basic {
+		var admin bool
+		var appPassword string
+		var err error
+		ok, admin, appPassword, err = store.AuthenticateWithAppPasswords(user, password, webClientAddr(r))
+		detail := auditAppPasswordDetail(appPassword)
+		if service != "" {
+			ok, err = authorizeService(store, user, service, ok, err)
+			detail = strings.TrimSpace("service=" + service + " " + detail)
+		}
+		audit.LogAuth(auditRecord{Frontend: "http", Remote: webClientAddr(r), User: user, Detail: detail}, ok, err)
+		// application passwords never grant admin privileges
+		username, isAdmin = user, admin && appPassword == ""
+		// a service which is not allowed must not reveal that the password was correct
+		ok = ok && err == nil
+	} else if username, isAdmin, ok = fa.checkSession(sessions, r); ok && service != "" {
+		var err error
+		if ok, err = authorizeService(store, username, service, ok, nil); !ok {
+			audit.LogAuth(auditRecord{Frontend: "http", Remote: webClientAddr(r), User: username, Detail: "service=" + service}, ok, err)
+			// sending the user to the login page would loop since it sends logged in users
+			// straight back
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+	}
+
+	if ok {
+		w.Header().Set("X-Remote-User", username)
+		w.Header().Set("X-Remote-Admin", strconv.FormatBool(isAdmin))
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("success\n")) //nolint:errcheck
+		return
+	}
+
+	// nginx' auth_request only understands 2xx, 401 and 403 so the redirect to the login page
+	// must be done by nginx itself using error_page.
+	if r.Header.Get("X-Forwarded-Host") == "" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="restricted", charset="UTF-8"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	http.Redirect(w, r, fa.loginURL(webOriginalURL(r)), http.StatusFound)
+}
+
+func (fa webForwardAuth) sendLoginPage(w http.ResponseWriter, status int, page webLoginPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	webLoginTemplate.Execute(w, page) //nolint:errcheck
+}
+
+func (fa webForwardAuth) handleLogin(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	page := webLoginPage{Redirect: r.FormValue("rd")}
+	if page.Redirect != "" && !fa.redirectAllowed(page.Redirect, r) {
+		wl.Printf("web-api: ignoring invalid login redirect to '%s'", page.Redirect)
+		page.Redirect = ""
+	}
+
+	if r.Method != http.MethodPost {
+		if username, _, ok := fa.checkSession(sessions, r); ok {
+			if page.Redirect != "" {
+				http.Redirect(w, r, page.Redirect, http.StatusSeeOther)
+				return
+			}
+			page.Username = username
+		}
+		fa.sendLoginPage(w, http.StatusOK, page)
+		return
+	}
+
+	wdl.Printf("web-api: got LOGIN request from %s", r.RemoteAddr)
+	if err := fa.csrf.Check(r); err != nil {
+		wl.Printf("web-api: refusing LOGIN request from %s: %v", r.RemoteAddr, err)
+		page.Error = "cross-origin login requests are not allowed"
+		fa.sendLoginPage(w, http.StatusForbidden, page)
+		return
+	}
+	username := r.PostFormValue("username")
+	password := r.PostFormValue("password")
+	if username == "" || password == "" {
+		page.Error = "empty username or password is not allowed"
+		fa.sendLoginPage(w, http.StatusBadRequest, page)
+		return
+	}
+
+	ok, isAdmin, _, _, err := store.Authenticate(username, password, webClientAddr(r))
+	audit.LogAuth(auditRecord{Frontend: "http", Remote: webClientAddr(r), User: username}, ok, err)
+	if err != nil || !ok {
+		page.Error = "authentication failed"
+		fa.sendLoginPage(w, http.StatusUnauthorized, page)
+		return
+	}
+
+	status, errorStr, session := sessions.GenerateForwardAuth(username, isAdmin)
+	if status != http.StatusOK {
+		page.Error = errorStr
+		fa.sendLoginPage(w, status, page)
+		return
+	}
+	fa.setSessionCookie(w, r, session, int(sessions.lifetime.Seconds()))
+
+	if page.Redirect != "" {
+		http.Redirect(w, r, page.Redirect, http.StatusSeeOther)
+		return
+	}
+	page.Username = username
+	fa.sendLoginPage(w, http.StatusOK, page)
+}
+
+func (fa webForwardAuth) handleLogout(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	if err := fa.csrf.Check(r); err != nil {
+		wl.Printf("web-api: refusing LOGOUT request from %s: %v", r.RemoteAddr, err)
+		http.Error(w, "cross-origin logout requests are not allowed", http.StatusForbidden)
+		return
+	}
+	fa.setSessionCookie(w, r, "", -1)
+
+	rd := r.FormValue("rd")
+	if rd != "" && fa.redirectAllowed(rd, r) {
+		http.Redirect(w, r, rd, http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "login", http.StatusSeeOther)
+}
@@ -0,0 +1,325 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestForwardAuthRedirectAllowed(t *testing.T) {
+	fa := webForwardAuth{config: &webForwardAuthConfig{CookieDomain: ".example.com"}}
+	r := httptest.NewRequest("GET", "https://auth.example.com/login", nil)
+
+	testvectors := []struct {
+		rd      string
+		allowed bool
+	}{
+		{"/foo?bar=1", true},
+		{"https://example.com/", true},
+		{"https://app.example.com/foo", true},
+		{"http://APP.example.com:8080/", true},
+		{"https://evil.com/", false},
+		{"https://evilexample.com/", false},
+		{"https://example.com.evil.com/", false},
+		{"//evil.com/", false},
+		{"/\\evil.com/", false},
+		{"javascript:alert(1)", false},
+		{"foo", false},
+	}
+	for _, v := range testvectors {
+		if allowed := fa.redirectAllowed(v.rd, r); allowed != v.allowed {
+			t.Fatalf("redirect to '%s': got %t, expected %t", v.rd, allowed, v.allowed)
+		}
+	}
+
+	fa.config.CookieDomain = ""
+	if !fa.redirectAllowed("https://auth.example.com/admin/", r) {
+		t.Fatal("redirect to the host of the login page should be allowed")
+	}
+	if fa.redirectAllowed("https://app.example.com/", r) {
+		t.Fatal("redirect to other hosts should not be allowed without cookie domain")
+	}
+}
+
+// webForwardAuthTestRequest sends a request for the login page host auth.example.com to h.
+func webForwardAuthTestRequest(h http.Handler, method, path string, form url.Values, header http.Header, cookie *http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "https://auth.example.com"+path, strings.NewReader(form.Encode()))
+	r.RemoteAddr = "192.0.2.1:1234"
+	if form != nil {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func webForwardAuthTestCookie(w *httptest.ResponseRecorder) *http.Cookie {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == webSessionCookieName {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestForwardAuthLogin(t *testing.T) {
+	store := newTestStore(t, policyConfig{}, "")
+	h, err := newWebHandler(store, &webConfig{ForwardAuth: webForwardAuthConfig{CookieDomain: "example.com"}})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	sameOrigin := http.Header{"Sec-Fetch-Site": {"same-origin"}}
+
+	w := webForwardAuthTestRequest(h, "GET", "/forward-auth", nil, nil, nil)
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("expected status 401 with basic auth challenge, got %d", w.Code)
+	}
+	w = webForwardAuthTestRequest(h, "GET", "/forward-auth", nil, http.Header{"X-Forwarded-Host": {"app.example.com"}, "X-Forwarded-Uri": {"/foo"}}, nil)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/login?rd=https%3A%2F%2Fapp.example.com%2Ffoo" {
+		t.Fatalf("expected redirect to the login page, got %d: %s", w.Code, w.Header().Get("Location"))
+	}
+
+	form := url.Values{"username": {testAdminName}, "password": {"wrong"}}
+	if w := webForwardAuthTestRequest(h, "POST", "/login", form, sameOrigin, nil); w.Code != http.StatusUnauthorized || webForwardAuthTestCookie(w) != nil {
+		t.Fatalf("login with wrong password should fail without cookie, got %d", w.Code)
+	}
+
+	form = url.Values{"username": {testAdminName}, "password": {testAdminPassword}, "rd": {"https://app.example.com/foo"}}
+	w = webForwardAuthTestRequest(h, "POST", "/login", form, sameOrigin, nil)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "https://app.example.com/foo" {
+		t.Fatalf("expected redirect to the original URL, got %d: %s", w.Code, w.Header().Get("Location"))
+	}
+	cookie := webForwardAuthTestCookie(w)
+	if cookie == nil || cookie.Value == "" || cookie.Domain != "example.com" || !cookie.HttpOnly || !cookie.Secure {
+		t.Fatalf("login should set a secure session cookie for the cookie domain, got %v", cookie)
+	}
+
+	w = webForwardAuthTestRequest(h, "GET", "/forward-auth", nil, nil, cookie)
+	if w.Code != http.StatusOK || w.Header().Get("X-Remote-User") != testAdminName || w.Header().Get("X-Remote-Admin") != "true" {
+		t.Fatalf("forward-auth with session cookie failed: %d", w.Code)
+	}
+	w = webForwardAuthTestRequest(h, "GET", "/login", nil, nil, cookie)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "You are logged in as <strong>"+testAdminName+"</strong>") {
+		t.Fatalf("login page should show the logged in user, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// the cookie must not grant access to the web-api and vice versa
+	if w := webTestRequest(h, "GET", "/api/v2/users", cookie.Value, ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("using the session cookie as web-api token should fail with 401, got %d", w.Code)
+	}
+	session := webV2TestSession(t, h, testAdminName, testAdminPassword)
+	w = webForwardAuthTestRequest(h, "GET", "/forward-auth", nil, nil, &http.Cookie{Name: webSessionCookieName, Value: session})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("using a web-api session as cookie should fail with 401, got %d", w.Code)
+	}
+
+	w = webForwardAuthTestRequest(h, "POST", "/logout", url.Values{"rd": {"https://evil.com/"}}, sameOrigin, cookie)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/login" {
+		t.Fatalf("logout should redirect to the login page, got %d: %s", w.Code, w.Header().Get("Location"))
+	}
+	if c := webForwardAuthTestCookie(w); c == nil || c.MaxAge >= 0 {
+		t.Fatalf("logout should remove the session cookie, got %v", c)
+	}
+}
+
+func TestForwardAuthBasicAuth(t *testing.T) {
+	store := newTestStore(t, policyConfig{}, "")
+	h, err := newWebHandler(store, &webConfig{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	r := httptest.NewRequest("GET", "/forward-auth", nil)
+	r.SetBasicAuth(testAdminName, testAdminPassword)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("X-Remote-User") != testAdminName {
+		t.Fatalf("forward-auth using basic auth failed: %d", w.Code)
+	}
+
+	r = httptest.NewRequest("GET", "/forward-auth", nil)
+	r.SetBasicAuth(testAdminName, "wrong")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("forward-auth using wrong password should fail with 401, got %d", w.Code)
+	}
+}
+
+func TestForwardAuthService(t *testing.T) {
+	store := newTestStore(t, policyConfig{}, "")
+	basicAuth := webBasicAuthConfig{Service: "http", VHosts: map[string]string{"webmail.example.com": "webmail"}, TrustedProxies: []string{"192.0.2.1"}}
+	h, err := newWebHandler(store, &webConfig{BasicAuth: basicAuth})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := store.Add("alice", "alice-secret", false); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	webmail := http.Header{"X-Forwarded-Host": {"webmail.example.com"}}
+
+	basic := func(password string, header http.Header) http.Header {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.SetBasicAuth("alice", password)
+		header = header.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		header.Set("Authorization", r.Header.Get("Authorization"))
+		return header
+	}
+	if err := store.SetServices("alice", []string{"http"}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if w := webForwardAuthTestRequest(h, "GET", "/forward-auth", nil, basic("alice-secret", nil), nil); w.Code != http.StatusOK {
+		t.Fatalf("forward-auth for an allowed service failed: %d", w.Code)
+	}
+	wrong := webForwardAuthTestRequest(h, "GET", "/forward-auth", nil, basic("wrong-secret", webmail), nil)
+	w := webForwardAuthTestRequest(h, "GET", "/forward-auth", nil, basic("alice-secret", webmail), nil)
+	if w.Code != wrong.Code || w.Body.String() != wrong.Body.String() || w.Header().Get("Location") != wrong.Header().Get("Location") {
+		t.Fatalf("a vhost which is not allowed must be answered like a wrong password, got %d: %s", w.Code, w.Body.String())
+	}
+
+	form := url.Values{"username": {"alice"}, "password": {"alice-secret"}}
+	w = webForwardAuthTestRequest(h, "POST", "/login", form, http.Header{"Sec-Fetch-Site": {"same-origin"}}, nil)
+	cookie := webForwardAuthTestCookie(w)
+	if cookie == nil {
+		t.Fatalf("login failed: %d", w.Code)
+	}
+	if w := webForwardAuthTestRequest(h, "GET", "/forward-auth", nil, nil, cookie); w.Code != http.StatusOK {
+		t.Fatalf("forward-auth with session cookie for an allowed service failed: %d", w.Code)
+	}
+	if w := webForwardAuthTestRequest(h, "GET", "/forward-auth", nil, webmail, cookie); w.Code != http.StatusForbidden {
+		t.Fatalf("forward-auth with session cookie for a vhost which is not allowed should fail with 403, got %d", w.Code)
+	}
+
+	if err := store.SetServices("alice", []string{"webmail"}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if w := webForwardAuthTestRequest(h, "GET", "/forward-auth", nil, webmail, cookie); w.Code != http.StatusOK {
+		t.Fatalf("forward-auth with session cookie for an allowed vhost failed: %d", w.Code)
+	}
+}
+
+func TestForwardAuthSecureCookie(t *testing.T) {
+	store := newTestStore(t, policyConfig{}, "")
+	h, err := newWebHandler(store, &webConfig{BasicAuth: webBasicAuthConfig{TrustedProxies: []string{"192.0.2.1"}}})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	login := func(remote string) *http.Cookie {
+		form := url.Values{"username": {testAdminName}, "password": {testAdminPassword}}
+		r := httptest.NewRequest("POST", "http://auth.example.com/login", strings.NewReader(form.Encode()))
+		r.RemoteAddr = remote
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Sec-Fetch-Site", "same-origin")
+		r.Header.Set("X-Forwarded-Proto", "https")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		cookie := webForwardAuthTestCookie(w)
+		if cookie == nil {
+			t.Fatalf("login from %s failed: %d", remote, w.Code)
+		}
+		return cookie
+	}
+	if cookie := login("192.0.2.1:1234"); !cookie.Secure {
+		t.Fatal("X-Forwarded-Proto of a trusted proxy should mark the cookie as secure")
+	}
+	if cookie := login("198.51.100.1:1234"); cookie.Secure {
+		t.Fatal("X-Forwarded-Proto of other clients must be ignored")
+	}
+}
+
+func TestForwardAuthCrossOrigin(t *testing.T) {
+	store := newTestStore(t, policyConfig{}, "")
+	h, err := newWebHandler(store, &webConfig{ForwardAuth: webForwardAuthConfig{CookieDomain: "example.com"}})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	form := url.Values{"username": {testAdminName}, "password": {testAdminPassword}}
+	for _, header := range []http.Header{
+		{"Sec-Fetch-Site": {"cross-site"}},
+		{"Sec-Fetch-Site": {"same-site"}},
+		{"Origin": {"https://evil.com"}},
+	} {
+		w := webForwardAuthTestRequest(h, "POST", "/login", form, header, nil)
+		if w.Code != http.StatusForbidden || webForwardAuthTestCookie(w) != nil {
+			t.Fatalf("cross-origin login (%v) should fail with 403, got %d", header, w.Code)
+		}
+		if w := webForwardAuthTestRequest(h, "POST", "/logout", nil, header, nil); w.Code != http.StatusForbidden {
+			t.Fatalf("cross-origin logout (%v) should fail with 403, got %d", header, w.Code)
+		}
+	}
+
+	w := webForwardAuthTestRequest(h, "POST", "/login", form, http.Header{"Origin": {"https://auth.example.com"}}, nil)
+	if w.Code != http.StatusOK || webForwardAuthTestCookie(w) == nil {
+		t.Fatalf("login from the login page should succeed, got %d", w.Code)
+	}
+}
+
+func TestForwardAuthLoginRedirect(t *testing.T) {
+	store := newTestStore(t, policyConfig{}, "")
+	h, err := newWebHandler(store, &webConfig{ForwardAuth: webForwardAuthConfig{CookieDomain: "example.com"}})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	form := url.Values{"username": {testAdminName}, "password": {testAdminPassword}, "rd": {"https://evil.com/"}}
+	w := webForwardAuthTestRequest(h, "POST", "/login", form, nil, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Location") != "" {
+		t.Fatalf("login should ignore redirects to other domains, got %d: %s", w.Code, w.Header().Get("Location"))
+	}
+	cookie := webForwardAuthTestCookie(w)
+	if cookie == nil {
+		t.Fatal("login should set a session cookie")
+	}
+
+	w = webForwardAuthTestRequest(h, "GET", "/login?rd="+url.QueryEscape("https://evil.com/"), nil, nil, cookie)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "evil.com") {
+		t.Fatalf("login page should drop redirects to other domains, got %d", w.Code)
+	}
+	w = webForwardAuthTestRequest(h, "GET", "/login?rd="+url.QueryEscape("https://app.example.com/"), nil, nil, cookie)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "https://app.example.com/" {
+		t.Fatalf("logged in users should be redirected, got %d: %s", w.Code, w.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,136 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	lib "github.com/whawty/auth/store"
+)
+
+func TestHealthz(t *testing.T) {
+	store := newTestStore(t, policyConfig{}, "")
+
+	w := webTestRequest(newMetricsHandler(store), "GET", "/healthz", "", "")
+	if w.Code != http.StatusOK || w.Body.String() != "ok\n" {
+		t.Fatalf("expected status 200 and 'ok', got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// breakTestStore makes the store inside basedir inconsistent by adding a regular user with
+// the same name as the admin.
+func breakTestStore(t *testing.T, basedir string) {
+	if err := os.WriteFile(filepath.Join(basedir, testAdminName+".user"), []byte{}, 0600); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+// waitReadyz polls '/readyz' until it returns code since the consistency check of the store
+// runs in the background.
+func waitReadyz(t *testing.T, h http.Handler, code int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w := webTestRequest(h, "GET", "/readyz", "", "")
+		if w.Code == code {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected status %d, got %d: %s", code, w.Code, w.Body.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	basedir := filepath.Join(t.TempDir(), "store")
+	store := newTestStoreWithConfig(t, basedir, policyConfig{}, "", testThrottleConfig, readinessConfig{Timeout: 5 * time.Second, CheckInterval: 10 * time.Millisecond})
+	h := newMetricsHandler(store)
+
+	waitReadyz(t, h, http.StatusOK)
+	breakTestStore(t, basedir)
+	waitReadyz(t, h, http.StatusServiceUnavailable)
+	if w := webTestRequest(h, "GET", "/readyz", "", ""); !strings.Contains(w.Body.String(), "both") {
+		t.Fatalf("expected the error of the consistency check, got: %s", w.Body.String())
+	}
+}
+
+func TestReadyzCheckInterval(t *testing.T) {
+	basedir := filepath.Join(t.TempDir(), "store")
+	store := newTestStoreWithConfig(t, basedir, policyConfig{}, "", testThrottleConfig, readinessConfig{Timeout: 5 * time.Second, CheckInterval: time.Hour})
+	h := newMetricsHandler(store)
+
+	waitReadyz(t, h, http.StatusOK)
+	breakTestStore(t, basedir)
+	if w := webTestRequest(h, "GET", "/readyz", "", ""); w.Code != http.StatusOK {
+		t.Fatalf("the result of the last check should be reused, got status %d", w.Code)
+	}
+}
+
+func TestReadinessCheckerRecheck(t *testing.T) {
+	basedir := filepath.Join(t.TempDir(), "store")
+	s := newTestStoreWithConfig(t, basedir, policyConfig{}, "", testThrottleConfig, testReadinessConfig)
+	waitReadyz(t, newMetricsHandler(s), http.StatusOK)
+
+	dir, err := lib.NewDirFromConfig(filepath.Join(filepath.Dir(basedir), "store.yaml"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	checker := newReadinessChecker(dir)
+	go checker.run(time.Hour)
+	waitReadinessChecker(t, checker, false)
+	breakTestStore(t, basedir)
+	checker.recheck()
+	waitReadinessChecker(t, checker, true)
+}
+
+func waitReadinessChecker(t *testing.T, checker *readinessChecker, failed bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for (checker.result() != nil) != failed {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the check to fail: %t, got: %v", failed, checker.result())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReadyzTimeout(t *testing.T) {
+	store := &Store{readyTimeout: 10 * time.Millisecond, readyChan: make(chan readyRequest)}
+
+	w := webTestRequest(newMetricsHandler(store), "GET", "/readyz", "", "")
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "timeout") {
+		t.Fatalf("expected status 503 if the store does not answer, got %d: %s", w.Code, w.Body.String())
+	}
+}
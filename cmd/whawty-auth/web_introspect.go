@@ -0,0 +1,146 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// webTokenInfo describes a valid token issued by this listener.
+type webTokenInfo struct {
+	TokenType string
+	Username  string
+	IsAdmin   bool
+	ClientID  string
+	Scope     string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// webTokenChecker returns information about token if it is valid. Every token format
+// supported by a listener must provide one of these.
+type webTokenChecker func(token string) (info webTokenInfo, ok bool)
+
+// webClientCredentials returns the credentials of a client using either HTTP basic
+// authentication or the client_id and client_secret form parameters (RFC 6749, 2.3.1).
+func webClientCredentials(r *http.Request) (id, secret string) {
+	if id, secret, ok := r.BasicAuth(); ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+		return id, secret
+	}
+	return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+}
+
+type webIntrospectResponse struct {
+	Active    bool   `json:"active"`
+	TokenType string `json:"token_type,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	IsAdmin   bool   `json:"admin,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+// webIntrospection implements OAuth 2.0 Token Introspection (RFC 7662).
+type webIntrospection struct {
+	clients  map[string]string
+	checkers []webTokenChecker
+}
+
+func newWebIntrospection(config *webIntrospectionConfig, checkers ...webTokenChecker) (*webIntrospection, error) {
+	i := &webIntrospection{clients: make(map[string]string), checkers: checkers}
+	for _, c := range config.Clients {
+		if c.ID == "" || c.Secret == "" {
+			return nil, errors.New("introspection: clients need an id and a secret")
+		}
+		if _, exists := i.clients[c.ID]; exists {
+			return nil, fmt.Errorf("introspection: client '%s' is defined more than once", c.ID)
+		}
+		i.clients[c.ID] = c.Secret
+	}
+	return i, nil
+}
+
+func (i *webIntrospection) authenticateClient(r *http.Request) bool {
+	id, secret := webClientCredentials(r)
+	expected, exists := i.clients[id]
+	if !exists {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(secret)) == 1
+}
+
+func (i *webIntrospection) handle(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	wdl.Printf("web-api: got INTROSPECT request from %s", r.RemoteAddr)
+
+	if err := r.ParseForm(); err != nil {
+		sendOIDCError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if !i.authenticateClient(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="whawty.auth"`)
+		sendOIDCError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		sendOIDCError(w, http.StatusBadRequest, "invalid_request", "token is missing")
+		return
+	}
+
+	respdata := &webIntrospectResponse{}
+	for _, check := range i.checkers {
+		info, ok := check(token)
+		if !ok {
+			continue
+		}
+		respdata.Active = true
+		respdata.TokenType = info.TokenType
+		respdata.Username = info.Username
+		respdata.Subject = info.Username
+		respdata.IsAdmin = info.IsAdmin
+		respdata.ClientID = info.ClientID
+		respdata.Scope = info.Scope
+		respdata.IssuedAt = info.IssuedAt.Unix()
+		respdata.ExpiresAt = info.ExpiresAt.Unix()
+		break
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	sendWebResponse(w, http.StatusOK, respdata)
+}
@@ -0,0 +1,160 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func webIntrospectTestRequest(h http.Handler, form url.Values, basicID, basicSecret string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/api/introspect", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if basicID != "" {
+		r.SetBasicAuth(basicID, basicSecret)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func webIntrospectTestResponse(t *testing.T, w *httptest.ResponseRecorder) *webIntrospectResponse {
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	resp := &webIntrospectResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	return resp
+}
+
+func TestIntrospection(t *testing.T) {
+	store := newTestStore(t, policyConfig{}, "")
+	h, err := newWebHandler(store, &webConfig{Introspection: webIntrospectionConfig{Clients: []webClientConfig{{ID: "rs", Secret: "rs-secret"}}}})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	session := webV2TestSession(t, h, testAdminName, testAdminPassword)
+
+	w := webIntrospectTestRequest(h, url.Values{"token": {session}}, "rs", "rs-secret")
+	resp := webIntrospectTestResponse(t, w)
+	if !resp.Active || resp.TokenType != "session" || resp.Username != testAdminName || resp.Subject != testAdminName || !resp.IsAdmin {
+		t.Fatalf("session should be active, got %+v", resp)
+	}
+	if resp.ExpiresAt <= resp.IssuedAt {
+		t.Fatalf("invalid issue and expiry time: %+v", resp)
+	}
+	if w.Header().Get("Cache-Control") != "no-store" {
+		t.Fatal("introspection responses must not be cached")
+	}
+
+	w = webIntrospectTestRequest(h, url.Values{"token": {session}, "client_id": {"rs"}, "client_secret": {"rs-secret"}}, "", "")
+	if resp := webIntrospectTestResponse(t, w); !resp.Active {
+		t.Fatalf("client credentials using form parameters should be accepted, got %+v", resp)
+	}
+
+	w = webIntrospectTestRequest(h, url.Values{"token": {"invalid"}}, "rs", "rs-secret")
+	if resp := webIntrospectTestResponse(t, w); resp.Active || resp.Username != "" || resp.ExpiresAt != 0 {
+		t.Fatalf("invalid token should be inactive without any other information, got %+v", resp)
+	}
+	if w.Body.String() != `{"active":false}`+"\n" {
+		t.Fatalf("unexpected response for inactive token: %s", w.Body.String())
+	}
+
+	if w := webIntrospectTestRequest(h, url.Values{}, "rs", "rs-secret"); w.Code != http.StatusBadRequest {
+		t.Fatalf("request without token should fail with 400, got %d", w.Code)
+	}
+}
+
+func TestIntrospectionClientAuth(t *testing.T) {
+	store := newTestStore(t, policyConfig{}, "")
+	h, err := newWebHandler(store, &webConfig{Introspection: webIntrospectionConfig{Clients: []webClientConfig{{ID: "rs", Secret: "rs-secret"}}}})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	session := webV2TestSession(t, h, testAdminName, testAdminPassword)
+
+	testvectors := []struct {
+		form   url.Values
+		id     string
+		secret string
+	}{
+		{url.Values{"token": {session}}, "", ""},
+		{url.Values{"token": {session}}, "rs", "wrong"},
+		{url.Values{"token": {session}}, "unknown", "rs-secret"},
+		{url.Values{"token": {session}, "client_id": {"rs"}}, "", ""},
+		{url.Values{"token": {session}, "client_id": {"rs"}, "client_secret": {"wrong"}}, "", ""},
+	}
+	for _, v := range testvectors {
+		w := webIntrospectTestRequest(h, v.form, v.id, v.secret)
+		if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+			t.Fatalf("client authentication (%v, %s:%s) should fail with 401, got %d", v.form, v.id, v.secret, w.Code)
+		}
+		resp := &oidcErrorResponse{}
+		if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil || resp.Error != "invalid_client" {
+			t.Fatalf("expected error 'invalid_client', got %s", w.Body.String())
+		}
+	}
+
+	h, err = newWebHandler(store, &webConfig{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if w := webIntrospectTestRequest(h, url.Values{"token": {session}}, "rs", "rs-secret"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("introspection without configured clients should fail with 401, got %d", w.Code)
+	}
+}
+
+func TestIntrospectionExpired(t *testing.T) {
+	for _, format := range []string{"aes-gcm", "jwt"} {
+		sessions, err := newWebSessionFactory(&webSessionConfig{Format: format})
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		introspection, err := newWebIntrospection(&webIntrospectionConfig{Clients: []webClientConfig{{ID: "rs", Secret: "rs-secret"}}}, sessions.Introspect)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		h := webHandler{nil, sessions, introspection.handle}
+
+		sessions.lifetime = -time.Second
+		_, _, session := sessions.Generate(testAdminName, true)
+		if resp := webIntrospectTestResponse(t, webIntrospectTestRequest(h, url.Values{"token": {session}}, "rs", "rs-secret")); resp.Active {
+			t.Fatalf("expired %s session should be inactive, got %+v", format, resp)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	oidcDefaultCodeLifetime  = time.Minute
+	oidcDefaultTokenLifetime = 10 * time.Minute
+
+	oidcIDTokenType     = "JWT"
+	oidcAccessTokenType = "at+jwt"
+)
+
+type oidcIDTokenClaims struct {
+	jwtRegisteredClaims
+	AuthTime          int64  `json:"auth_time,omitempty"`
+	Nonce             string `json:"nonce,omitempty"`
+	PreferredUsername string `json:"preferred_username"`
+	IsAdmin           bool   `json:"admin"`
+}
+
+type oidcAccessTokenClaims struct {
+	jwtRegisteredClaims
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope"`
+	IsAdmin  bool   `json:"admin"`
+}
+
+type oidcTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	IDToken     string `json:"id_token"`
+	Scope       string `json:"scope"`
+}
+
+type oidcUserinfoResponse struct {
+	Subject           string `json:"sub"`
+	PreferredUsername string `json:"preferred_username"`
+	IsAdmin           bool   `json:"admin"`
+}
+
+type oidcErrorResponse struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+type oidcAuthCode struct {
+	clientID    string
+	redirectURI string
+	scope       string
+	nonce       string
+	challenge   string
+	username    string
+	isAdmin     bool
+	authTime    time.Time
+	expires     time.Time
+}
+
+// webOIDCProvider implements a minimal OpenID Connect provider. Only the authorization code
+// flow is supported and PKCE (S256) is mandatory for all clients. Users log in using the
+// login page of the forward-auth endpoint.
+type webOIDCProvider struct {
+	config  *webOIDCConfig
+	issuer  string
+	fa      webForwardAuth
+	signer  *jwtSigner
+	clients map[string]*webOIDCClientConfig
+
+	codeLifetime  time.Duration
+	tokenLifetime time.Duration
+
+	mutex sync.Mutex
+	codes map[string]*oidcAuthCode
+}
+
+func newWebOIDCProvider(config *webOIDCConfig, fa webForwardAuth) (p *webOIDCProvider, err error) {
+	if config.Issuer == "" {
+		return nil, errors.New("oidc: issuer must be set")
+	}
+	p = &webOIDCProvider{config: config, fa: fa}
+	p.issuer = strings.TrimSuffix(config.Issuer, "/")
+	if p.signer, err = loadJWTSigner(config.SigningKey); err != nil {
+		return nil, fmt.Errorf("oidc: failed to load signing key: %v", err)
+	}
+	if config.SigningKey == "" {
+		wl.Printf("oidc: no signing key configured, using a temporary key")
+	}
+	if config.CodeLifetime < 0 || config.TokenLifetime < 0 {
+		return nil, errors.New("oidc: code-lifetime and token-lifetime must not be negative")
+	}
+	p.codeLifetime, p.tokenLifetime = config.CodeLifetime, config.TokenLifetime
+	if p.codeLifetime == 0 {
+		p.codeLifetime = oidcDefaultCodeLifetime
+	}
+	if p.tokenLifetime == 0 {
+		p.tokenLifetime = oidcDefaultTokenLifetime
+	}
+
+	p.clients = make(map[string]*webOIDCClientConfig)
+	for i := range config.Clients {
+		c := &config.Clients[i]
+		if c.ID == "" || len(c.RedirectURIs) == 0 {
+			return nil, errors.New("oidc: clients need an id and at least one redirect-uri")
+		}
+		if _, exists := p.clients[c.ID]; exists {
+			return nil, fmt.Errorf("oidc: client '%s' is defined more than once", c.ID)
+		}
+		p.clients[c.ID] = c
+	}
+	p.codes = make(map[string]*oidcAuthCode)
+	return
+}
+
+func oidcRandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (p *webOIDCProvider) endpoint(path string) string {
+	return p.issuer + path
+}
+
+func (p *webOIDCProvider) handleDiscovery(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	sendWebResponse(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.endpoint("/oidc/authorize"),
+		"token_endpoint":                        p.endpoint("/oidc/token"),
+		"userinfo_endpoint":                     p.endpoint("/oidc/userinfo"),
+		"jwks_uri":                              p.endpoint("/.well-known/jwks.json"),
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{p.signer.alg},
+		"scopes_supported":                      []string{"openid", "profile"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported":                      []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "preferred_username", "admin"},
+	})
+}
+
+func oidcRedirect(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func (p *webOIDCProvider) handleAuthorize(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	wdl.Printf("oidc: got AUTHORIZE request from %s", r.RemoteAddr)
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	client, exists := p.clients[r.Form.Get("client_id")]
+	if !exists {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+	redirectURI := r.Form.Get("redirect_uri")
+	if !slices.Contains(client.RedirectURIs, redirectURI) {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	// from here on errors are reported back to the client
+	state := r.Form.Get("state")
+	sendError := func(code, description string) {
+		params := url.Values{"error": {code}, "error_description": {description}}
+		if state != "" {
+			params.Set("state", state)
+		}
+		oidcRedirect(w, r, redirectURI, params)
+	}
+	if r.Form.Get("response_type") != "code" {
+		sendError("unsupported_response_type", "only response_type 'code' is supported")
+		return
+	}
+	scope := r.Form.Get("scope")
+	if !slices.Contains(strings.Fields(scope), "openid") {
+		sendError("invalid_scope", "scope must contain 'openid'")
+		return
+	}
+	challenge := r.Form.Get("code_challenge")
+	if challenge == "" || r.Form.Get("code_challenge_method") != "S256" {
+		sendError("invalid_request", "PKCE using code_challenge_method 'S256' is required")
+		return
+	}
+
+	username, isAdmin, ok := p.fa.checkSession(sessions, r)
+	if !ok {
+		if slices.Contains(strings.Fields(r.Form.Get("prompt")), "none") {
+			sendError("login_required", "user is not logged in")
+			return
+		}
+		http.Redirect(w, r, p.fa.loginURL(r.URL.Path+"?"+r.Form.Encode()), http.StatusFound)
+		return
+	}
+
+	code, err := oidcRandomString()
+	if err != nil {
+		sendError("server_error", err.Error())
+		return
+	}
+	now := time.Now()
+	p.mutex.Lock()
+	for c, ac := range p.codes {
+		if now.After(ac.expires) {
+			delete(p.codes, c)
+		}
+	}
+	p.codes[code] = &oidcAuthCode{clientID: client.ID, redirectURI: redirectURI, scope: scope, nonce: r.Form.Get("nonce"),
+		challenge: challenge, username: username, isAdmin: isAdmin, authTime: now, expires: now.Add(p.codeLifetime)}
+	p.mutex.Unlock()
+
+	audit.Log(auditRecord{Frontend: "http", Remote: webClientAddr(r), Actor: username, User: username,
+		Operation: "oidc-authorize", Detail: "client=" + client.ID}, nil)
+
+	params := url.Values{"code": {code}}
+	if state != "" {
+		params.Set("state", state)
+	}
+	oidcRedirect(w, r, redirectURI, params)
+}
+
+func sendOIDCError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Cache-Control", "no-store")
+	sendWebResponse(w, status, &oidcErrorResponse{Error: code, Description: description})
+}
+
+// authenticateClient checks the credentials of the client using either HTTP basic
+// authentication or the client_id and client_secret form parameters. Clients without a
+// secret are public clients and only need to supply their id.
+func (p *webOIDCProvider) authenticateClient(r *http.Request) (*webOIDCClientConfig, bool) {
+	id, secret := webClientCredentials(r)
+	client, exists := p.clients[id]
+	if !exists {
+		return nil, false
+	}
+	if client.Secret == "" {
+		return client, true
+	}
+	return client, subtle.ConstantTimeCompare([]byte(client.Secret), []byte(secret)) == 1
+}
+
+func (p *webOIDCProvider) handleToken(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	wdl.Printf("oidc: got TOKEN request from %s", r.RemoteAddr)
+
+	if err := r.ParseForm(); err != nil {
+		sendOIDCError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		sendOIDCError(w, http.StatusBadRequest, "unsupported_grant_type", "only grant_type 'authorization_code' is supported")
+		return
+	}
+	client, ok := p.authenticateClient(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="whawty.auth"`)
+		sendOIDCError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+
+	p.mutex.Lock()
+	code, exists := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mutex.Unlock()
+	if !exists || time.Now().After(code.expires) || code.clientID != client.ID {
+		sendOIDCError(w, http.StatusBadRequest, "invalid_grant", "invalid or expired authorization code")
+		return
+	}
+	if code.redirectURI != r.PostForm.Get("redirect_uri") {
+		sendOIDCError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri does not match")
+		return
+	}
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(verifier[:])), []byte(code.challenge)) != 1 {
+		sendOIDCError(w, http.StatusBadRequest, "invalid_grant", "invalid code_verifier")
+		return
+	}
+
+	now := time.Now()
+	registered := jwtRegisteredClaims{Issuer: p.issuer, Subject: code.username, Audience: client.ID,
+		IssuedAt: now.Unix(), ExpiresAt: now.Add(p.tokenLifetime).Unix()}
+	idToken, err := p.signer.Sign(oidcIDTokenType, &oidcIDTokenClaims{jwtRegisteredClaims: registered,
+		AuthTime: code.authTime.Unix(), Nonce: code.nonce, PreferredUsername: code.username, IsAdmin: code.isAdmin})
+	if err != nil {
+		sendOIDCError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	accessToken, err := p.signer.Sign(oidcAccessTokenType, &oidcAccessTokenClaims{jwtRegisteredClaims: registered,
+		ClientID: client.ID, Scope: code.scope, IsAdmin: code.isAdmin})
+	if err != nil {
+		sendOIDCError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	sendWebResponse(w, http.StatusOK, &oidcTokenResponse{AccessToken: accessToken, TokenType: "Bearer",
+		ExpiresIn: int(p.tokenLifetime.Seconds()), IDToken: idToken, Scope: code.scope})
+}
+
+// Introspect returns information about a valid access token.
+func (p *webOIDCProvider) Introspect(token string) (info webTokenInfo, ok bool) {
+	claims := &oidcAccessTokenClaims{}
+	if err := p.signer.Verify(token, oidcAccessTokenType, claims); err != nil || claims.Issuer != p.issuer {
+		return
+	}
+	return webTokenInfo{TokenType: "access_token", Username: claims.Subject, IsAdmin: claims.IsAdmin, ClientID: claims.ClientID,
+		Scope: claims.Scope, IssuedAt: time.Unix(claims.IssuedAt, 0), ExpiresAt: time.Unix(claims.ExpiresAt, 0)}, true
+}
+
+func (p *webOIDCProvider) handleUserinfo(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	wdl.Printf("oidc: got USERINFO request from %s", r.RemoteAddr)
+
+	token, ok := webBearerToken(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="whawty.auth"`)
+		sendOIDCError(w, http.StatusUnauthorized, "invalid_request", "missing bearer token")
+		return
+	}
+	claims := &oidcAccessTokenClaims{}
+	if err := p.signer.Verify(token, oidcAccessTokenType, claims); err != nil || claims.Issuer != p.issuer {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="whawty.auth", error="invalid_token"`)
+		sendOIDCError(w, http.StatusUnauthorized, "invalid_token", "invalid access token")
+		return
+	}
+	sendWebResponse(w, http.StatusOK, &oidcUserinfoResponse{Subject: claims.Subject, PreferredUsername: claims.Subject, IsAdmin: claims.IsAdmin})
+}
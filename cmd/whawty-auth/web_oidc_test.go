@@ -0,0 +1,247 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testOIDCRedirectURI = "https://app.example.com/callback"
+	testOIDCVerifier    = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+func newTestOIDCHandler(t *testing.T, store *Store, codeLifetime time.Duration) http.Handler {
+	oidc := &webOIDCConfig{Issuer: "https://auth.example.com", CodeLifetime: codeLifetime, Clients: []webOIDCClientConfig{
+		{ID: "app", Secret: "app-secret", RedirectURIs: []string{testOIDCRedirectURI}},
+		{ID: "public", RedirectURIs: []string{"https://public.example.com/callback"}},
+	}}
+	h, err := newWebHandler(store, &webConfig{OIDC: oidc, Introspection: webIntrospectionConfig{Clients: []webClientConfig{{ID: "rs", Secret: "rs-secret"}}}})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	return h
+}
+
+func webOIDCTestLogin(t *testing.T, h http.Handler) *http.Cookie {
+	form := url.Values{"username": {testAdminName}, "password": {testAdminPassword}}
+	w := webForwardAuthTestRequest(h, "POST", "/login", form, http.Header{"Sec-Fetch-Site": {"same-origin"}}, nil)
+	cookie := webForwardAuthTestCookie(w)
+	if cookie == nil {
+		t.Fatalf("login failed: %d", w.Code)
+	}
+	return cookie
+}
+
+func webOIDCTestAuthorizeParams() url.Values {
+	challenge := sha256.Sum256([]byte(testOIDCVerifier))
+	return url.Values{"client_id": {"app"}, "redirect_uri": {testOIDCRedirectURI}, "response_type": {"code"}, "scope": {"openid profile"},
+		"state": {"xyz"}, "nonce": {"n-0S6"}, "code_challenge": {base64.RawURLEncoding.EncodeToString(challenge[:])}, "code_challenge_method": {"S256"}}
+}
+
+// webOIDCTestRedirect returns the query parameters of a redirect to the client.
+func webOIDCTestRedirect(t *testing.T, w *httptest.ResponseRecorder) url.Values {
+	if w.Code != http.StatusFound {
+		t.Fatalf("expected redirect, got %d: %s", w.Code, w.Body.String())
+	}
+	u, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if u.Scheme+"://"+u.Host+u.Path != testOIDCRedirectURI {
+		t.Fatalf("expected redirect to the client, got %s", u)
+	}
+	return u.Query()
+}
+
+func webOIDCTestCode(t *testing.T, h http.Handler, cookie *http.Cookie) string {
+	w := webForwardAuthTestRequest(h, "GET", "/oidc/authorize?"+webOIDCTestAuthorizeParams().Encode(), nil, nil, cookie)
+	params := webOIDCTestRedirect(t, w)
+	if params.Get("code") == "" || params.Get("state") != "xyz" {
+		t.Fatalf("expected code and state, got %v", params)
+	}
+	return params.Get("code")
+}
+
+func webOIDCTestToken(h http.Handler, form url.Values, clientID, clientSecret string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "https://auth.example.com/oidc/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientID != "" {
+		r.SetBasicAuth(clientID, clientSecret)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func webOIDCTestTokenForm(code, verifier string) url.Values {
+	return url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {testOIDCRedirectURI}, "code_verifier": {verifier}}
+}
+
+func webOIDCTestError(t *testing.T, w *httptest.ResponseRecorder, status int, code string) {
+	resp := &oidcErrorResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil || w.Code != status || resp.Error != code {
+		t.Fatalf("expected status %d and error '%s', got %d: %s", status, code, w.Code, w.Body.String())
+	}
+}
+
+func TestOIDCAuthorize(t *testing.T) {
+	store := newTestStore(t, policyConfig{}, "")
+	h := newTestOIDCHandler(t, store, 0)
+
+	w := webForwardAuthTestRequest(h, "GET", "/oidc/authorize?"+webOIDCTestAuthorizeParams().Encode(), nil, nil, nil)
+	if w.Code != http.StatusFound || !strings.HasPrefix(w.Header().Get("Location"), "/login?rd=%2Foidc%2Fauthorize%3F") {
+		t.Fatalf("expected redirect to the login page, got %d: %s", w.Code, w.Header().Get("Location"))
+	}
+
+	cookie := webOIDCTestLogin(t, h)
+	webOIDCTestCode(t, h, cookie)
+
+	params := webOIDCTestAuthorizeParams()
+	params.Set("prompt", "none")
+	w = webForwardAuthTestRequest(h, "GET", "/oidc/authorize?"+params.Encode(), nil, nil, nil)
+	if p := webOIDCTestRedirect(t, w); p.Get("error") != "login_required" || p.Get("state") != "xyz" || p.Get("code") != "" {
+		t.Fatalf("prompt=none without session should return login_required, got %v", p)
+	}
+
+	for _, redirectURI := range []string{"https://evil.example.com/callback", testOIDCRedirectURI + "/foo", ""} {
+		params := webOIDCTestAuthorizeParams()
+		params.Set("redirect_uri", redirectURI)
+		w := webForwardAuthTestRequest(h, "GET", "/oidc/authorize?"+params.Encode(), nil, nil, cookie)
+		if w.Code != http.StatusBadRequest || w.Header().Get("Location") != "" {
+			t.Fatalf("invalid redirect_uri '%s' should fail with 400 without redirect, got %d: %s", redirectURI, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	params = webOIDCTestAuthorizeParams()
+	params.Del("code_challenge")
+	w = webForwardAuthTestRequest(h, "GET", "/oidc/authorize?"+params.Encode(), nil, nil, cookie)
+	if p := webOIDCTestRedirect(t, w); p.Get("error") != "invalid_request" || p.Get("code") != "" {
+		t.Fatalf("authorization without PKCE should fail, got %v", p)
+	}
+}
+
+func TestOIDCToken(t *testing.T) {
+	store := newTestStore(t, policyConfig{}, "")
+	h := newTestOIDCHandler(t, store, 0)
+	cookie := webOIDCTestLogin(t, h)
+
+	code := webOIDCTestCode(t, h, cookie)
+	w := webOIDCTestToken(h, webOIDCTestTokenForm(code, testOIDCVerifier), "app", "app-secret")
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("expected status 200 which must not be cached, got %d: %s", w.Code, w.Body.String())
+	}
+	token := &oidcTokenResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), token); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if token.AccessToken == "" || token.IDToken == "" || token.TokenType != "Bearer" || token.ExpiresIn != 600 || token.Scope != "openid profile" {
+		t.Fatalf("unexpected token response: %+v", token)
+	}
+
+	w = webOIDCTestToken(h, webOIDCTestTokenForm(code, testOIDCVerifier), "app", "app-secret")
+	webOIDCTestError(t, w, http.StatusBadRequest, "invalid_grant")
+
+	code = webOIDCTestCode(t, h, cookie)
+	w = webOIDCTestToken(h, webOIDCTestTokenForm(code, "wrong-verifier"), "app", "app-secret")
+	webOIDCTestError(t, w, http.StatusBadRequest, "invalid_grant")
+	w = webOIDCTestToken(h, webOIDCTestTokenForm(code, testOIDCVerifier), "app", "app-secret")
+	webOIDCTestError(t, w, http.StatusBadRequest, "invalid_grant")
+
+	code = webOIDCTestCode(t, h, cookie)
+	w = webOIDCTestToken(h, webOIDCTestTokenForm(code, testOIDCVerifier), "app", "wrong-secret")
+	webOIDCTestError(t, w, http.StatusUnauthorized, "invalid_client")
+	form := webOIDCTestTokenForm(code, testOIDCVerifier)
+	form.Set("client_id", "public")
+	w = webOIDCTestToken(h, form, "", "")
+	webOIDCTestError(t, w, http.StatusBadRequest, "invalid_grant")
+	w = webOIDCTestToken(h, webOIDCTestTokenForm(code, testOIDCVerifier), "app", "app-secret")
+	webOIDCTestError(t, w, http.StatusBadRequest, "invalid_grant")
+}
+
+func TestOIDCCodeExpiry(t *testing.T) {
+	store := newTestStore(t, policyConfig{}, "")
+	h := newTestOIDCHandler(t, store, 10*time.Millisecond)
+	cookie := webOIDCTestLogin(t, h)
+
+	code := webOIDCTestCode(t, h, cookie)
+	time.Sleep(50 * time.Millisecond)
+	w := webOIDCTestToken(h, webOIDCTestTokenForm(code, testOIDCVerifier), "app", "app-secret")
+	webOIDCTestError(t, w, http.StatusBadRequest, "invalid_grant")
+}
+
+func TestOIDCUserinfoAndIntrospection(t *testing.T) {
+	store := newTestStore(t, policyConfig{}, "")
+	h := newTestOIDCHandler(t, store, 0)
+	cookie := webOIDCTestLogin(t, h)
+
+	code := webOIDCTestCode(t, h, cookie)
+	w := webOIDCTestToken(h, webOIDCTestTokenForm(code, testOIDCVerifier), "app", "app-secret")
+	token := &oidcTokenResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), token); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("token request failed: %d: %s", w.Code, w.Body.String())
+	}
+
+	userinfo := func(token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "https://auth.example.com/oidc/userinfo", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	w = userinfo(token.AccessToken)
+	info := &oidcUserinfoResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), info); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("userinfo request failed: %d: %s", w.Code, w.Body.String())
+	}
+	if info.Subject != testAdminName || info.PreferredUsername != testAdminName || !info.IsAdmin {
+		t.Fatalf("unexpected userinfo response: %+v", info)
+	}
+	if w := userinfo(token.IDToken); w.Code != http.StatusUnauthorized {
+		t.Fatalf("userinfo using the ID token should fail with 401, got %d", w.Code)
+	}
+
+	resp := webIntrospectTestResponse(t, webIntrospectTestRequest(h, url.Values{"token": {token.AccessToken}}, "rs", "rs-secret"))
+	if !resp.Active || resp.TokenType != "access_token" || resp.Username != testAdminName || !resp.IsAdmin || resp.ClientID != "app" || resp.Scope != "openid profile" {
+		t.Fatalf("access token should be active, got %+v", resp)
+	}
+	if resp := webIntrospectTestResponse(t, webIntrospectTestRequest(h, url.Values{"token": {token.IDToken}}, "rs", "rs-secret")); resp.Active {
+		t.Fatalf("the ID token is not an access token, got %+v", resp)
+	}
+}
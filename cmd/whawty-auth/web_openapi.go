@@ -0,0 +1,329 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// webAPIOperation describes a single endpoint of the web API. The OpenAPI document
+// served at /api/openapi.json is generated from the list below, the request and
+// response schemas are derived from the structs the handlers use.
+type webAPIOperation struct {
+	method   string
+	path     string
+	summary  string
+	security string
+	query    map[string]string
+	form     map[string]string
+	request  reflect.Type
+	response reflect.Type
+	alt      []reflect.Type
+	status   int
+}
+
+var webAPIOperations = []webAPIOperation{
+	{method: "GET", path: "/basic-auth", summary: "check credentials using HTTP basic authentication",
+		security: "basic", status: http.StatusOK},
+	{method: "GET", path: "/forward-auth", summary: "authorize a request for a reverse proxy using HTTP basic authentication or the session cookie set by /login",
+		security: "basic", status: http.StatusOK},
+	{method: "POST", path: "/api/authenticate", summary: "authenticate a user and create a session",
+		request: reflect.TypeOf(webAuthenticateRequest{}), response: reflect.TypeOf(webAuthenticateResponse{}), status: http.StatusOK},
+	{method: "POST", path: "/api/add", summary: "add a user (admins only)",
+		request: reflect.TypeOf(webAddRequest{}), response: reflect.TypeOf(webAddResponse{}), status: http.StatusOK},
+	{method: "POST", path: "/api/remove", summary: "remove a user (admins only)",
+		request: reflect.TypeOf(webRemoveRequest{}), response: reflect.TypeOf(webRemoveResponse{}), status: http.StatusOK},
+	{method: "POST", path: "/api/update", summary: "update the password of a user using a session or the old password",
+		request: reflect.TypeOf(webUpdateRequest{}), response: reflect.TypeOf(webUpdateResponse{}), status: http.StatusOK},
+	{method: "POST", path: "/api/set-admin", summary: "change the admin status of a user (admins only)",
+		request: reflect.TypeOf(webSetAdminRequest{}), response: reflect.TypeOf(webSetAdminResponse{}), status: http.StatusOK},
+	{method: "POST", path: "/api/check-password", summary: "rate a password using the password policy of a user (other users: admins only), the store is not modified",
+		request: reflect.TypeOf(webCheckPasswordRequest{}), response: reflect.TypeOf(webCheckPasswordResponse{}), status: http.StatusOK},
+	{method: "POST", path: "/api/list", summary: "list all users with supported password hashes (admins only)",
+		request: reflect.TypeOf(webListRequest{}), response: reflect.TypeOf(webListResponse{}), status: http.StatusOK},
+	{method: "POST", path: "/api/list-full", summary: "list all users (admins only)",
+		request: reflect.TypeOf(webListFullRequest{}), response: reflect.TypeOf(webListFullResponse{}), status: http.StatusOK},
+	{method: "GET", path: "/api/openapi.json", summary: "this document", status: http.StatusOK},
+	{method: "POST", path: "/api/introspect", summary: "check a token according to RFC 7662 (introspection clients only)",
+		security: "basic", form: map[string]string{"token": "the token to check", "token_type_hint": "ignored"},
+		response: reflect.TypeOf(webIntrospectResponse{}), status: http.StatusOK},
+
+	{method: "POST", path: "/api/v2/sessions", summary: "authenticate a user and create a session",
+		request: reflect.TypeOf(webV2SessionRequest{}), response: reflect.TypeOf(webV2SessionResponse{}), status: http.StatusCreated},
+	{method: "GET", path: "/api/v2/users", summary: "list users (admins only)", security: "bearer",
+		query:    map[string]string{"full": "if set to 'true' also list users with unsupported password hashes"},
+		response: reflect.TypeOf(webV2UserListResponse{}), alt: []reflect.Type{reflect.TypeOf(webV2UserListFullResponse{})},
+		status: http.StatusOK},
+	{method: "GET", path: "/api/v2/users/{name}", summary: "get a user (admins or the user itself)", security: "bearer",
+		response: reflect.TypeOf(webV2User{}), status: http.StatusOK},
+	{method: "PUT", path: "/api/v2/users/{name}", summary: "add a user or replace the password and admin status of an existing one, which returns 200 (admins only)", security: "bearer",
+		request: reflect.TypeOf(webV2PutUserRequest{}), response: reflect.TypeOf(webV2User{}), status: http.StatusCreated},
+	{method: "PATCH", path: "/api/v2/users/{name}", summary: "update the password and/or admin status of a user", security: "bearer",
+		request: reflect.TypeOf(webV2PatchUserRequest{}), response: reflect.TypeOf(webV2User{}), status: http.StatusOK},
+	{method: "DELETE", path: "/api/v2/users/{name}", summary: "remove a user (admins only)", security: "bearer",
+		status: http.StatusNoContent},
+	{method: "GET", path: "/api/v2/users/{name}/app-passwords", summary: "list the application passwords of a user (admins or the user itself)", security: "bearer",
+		response: reflect.TypeOf(webV2AppPasswordListResponse{}), status: http.StatusOK},
+	{method: "PUT", path: "/api/v2/users/{name}/app-passwords/{app}", summary: "create an application password, the generated password is only returned once (the user itself only)",
+		security: "bearer", response: reflect.TypeOf(webV2AppPasswordResponse{}), status: http.StatusCreated},
+	{method: "DELETE", path: "/api/v2/users/{name}/app-passwords/{app}", summary: "revoke an application password (admins or the user itself)", security: "bearer",
+		status: http.StatusNoContent},
+	{method: "POST", path: "/api/v2/users/{name}/reset-token", summary: "create a single-use password reset token for a user (admins only)", security: "bearer",
+		query:    map[string]string{"valid_for": "how long the token is valid, e.g. '2h' (default: 24h)"},
+		response: reflect.TypeOf(webV2ResetTokenResponse{}), status: http.StatusCreated},
+	{method: "POST", path: "/api/v2/password-reset", summary: "set a new password using a reset token",
+		request: reflect.TypeOf(webV2PasswordResetRequest{}), status: http.StatusNoContent},
+	{method: "GET", path: "/api/v2/throttle", summary: "list throttled users and client addresses (admins only)", security: "bearer",
+		response: reflect.TypeOf(webV2ThrottleListResponse{}), status: http.StatusOK},
+	{method: "DELETE", path: "/api/v2/throttle/{key}", summary: "clear the throttling state of a user (user:<name>) or client address (addr:<address>) (admins only)",
+		security: "bearer", status: http.StatusNoContent},
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+type openAPIGenerator struct {
+	schemas map[string]interface{}
+	names   map[reflect.Type]string
+}
+
+func newOpenAPIGenerator() *openAPIGenerator {
+	return &openAPIGenerator{schemas: make(map[string]interface{}), names: make(map[reflect.Type]string)}
+}
+
+// schemaName returns the name of the component schema of the named type t. Types of other
+// packages are prefixed with the package name. If the name is still taken by another type, e.g.
+// one which is declared inside a function, a number is appended.
+func (g *openAPIGenerator) schemaName(t reflect.Type) string {
+	if name, exists := g.names[t]; exists {
+		return name
+	}
+	base := t.Name()
+	if pkg := t.PkgPath(); pkg != reflect.TypeOf(g).Elem().PkgPath() {
+		base = path.Base(pkg) + "." + base
+	}
+	name := base
+	for i := 2; ; i++ {
+		if _, taken := g.schemas[name]; !taken {
+			break
+		}
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	g.names[t] = name
+	g.schemas[name] = nil // reserve the name, this also guards against recursion
+	return name
+}
+
+func (g *openAPIGenerator) structSchema(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			g.structSchema(f.Type, properties, required)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = g.schemaFor(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func (g *openAPIGenerator) schemaFor(t reflect.Type) map[string]interface{} {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schemaFor(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structObject(t)
+		}
+		name, exists := g.names[t]
+		if !exists {
+			name = g.schemaName(t)
+			g.schemas[name] = g.structObject(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+func (g *openAPIGenerator) structObject(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+	g.structSchema(t, properties, &required)
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+func (g *openAPIGenerator) operation(op webAPIOperation) map[string]interface{} {
+	o := map[string]interface{}{"summary": op.summary}
+
+	var params []interface{}
+	for _, segment := range strings.Split(op.path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			params = append(params, map[string]interface{}{
+				"name": strings.Trim(segment, "{}"), "in": "path", "required": true,
+				"schema": map[string]interface{}{"type": "string"},
+			})
+		}
+	}
+	for name, description := range op.query {
+		params = append(params, map[string]interface{}{
+			"name": name, "in": "query", "description": description,
+			"schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	if len(params) > 0 {
+		o["parameters"] = params
+	}
+
+	if op.request != nil {
+		o["requestBody"] = map[string]interface{}{"required": true, "content": jsonContent(g.schemaFor(op.request))}
+	}
+	if len(op.form) > 0 {
+		properties := make(map[string]interface{})
+		for name, description := range op.form {
+			properties[name] = map[string]interface{}{"type": "string", "description": description}
+		}
+		o["requestBody"] = map[string]interface{}{"required": true, "content": map[string]interface{}{
+			"application/x-www-form-urlencoded": map[string]interface{}{
+				"schema": map[string]interface{}{"type": "object", "properties": properties},
+			},
+		}}
+	}
+
+	success := map[string]interface{}{"description": http.StatusText(op.status)}
+	switch {
+	case op.response != nil && len(op.alt) > 0:
+		oneOf := []interface{}{g.schemaFor(op.response)}
+		for _, t := range op.alt {
+			oneOf = append(oneOf, g.schemaFor(t))
+		}
+		success["content"] = jsonContent(map[string]interface{}{"oneOf": oneOf})
+	case op.response != nil:
+		success["content"] = jsonContent(g.schemaFor(op.response))
+	case op.status != http.StatusNoContent:
+		success["content"] = map[string]interface{}{"text/plain": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}}
+	}
+	responses := map[string]interface{}{strconv.Itoa(op.status): success}
+	if strings.HasPrefix(op.path, "/api/v2/") {
+		responses["default"] = map[string]interface{}{
+			"description": "error",
+			"content":     jsonContent(g.schemaFor(reflect.TypeOf(webV2ErrorResponse{}))),
+		}
+	}
+	o["responses"] = responses
+
+	if op.security != "" {
+		o["security"] = []interface{}{map[string]interface{}{op.security: []string{}}}
+	}
+	return o
+}
+
+func newOpenAPISpec() map[string]interface{} {
+	g := newOpenAPIGenerator()
+	paths := make(map[string]interface{})
+	for _, op := range webAPIOperations {
+		item, exists := paths[op.path].(map[string]interface{})
+		if !exists {
+			item = make(map[string]interface{})
+			paths[op.path] = item
+		}
+		item[strings.ToLower(op.method)] = g.operation(op)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "whawty.auth web API",
+			"version": "2",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]interface{}{
+				"basic":  map[string]interface{}{"type": "http", "scheme": "basic"},
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+func newOpenAPIHandler() (http.HandlerFunc, error) {
+	spec, err := json.Marshal(newOpenAPISpec())
+	if err != nil {
+		return nil, err
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec) //nolint:errcheck
+	}, nil
+}
@@ -0,0 +1,254 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	storeLib "github.com/whawty/auth/store"
+)
+
+var (
+	// routes which are not part of the API
+	webNonAPIRoutes = map[string]bool{
+		"/": true, "/admin/": true, "/api/v2/": true,
+		"GET /metrics": true, "GET /healthz": true, "GET /readyz": true,
+		"/login": true, "POST /logout": true,
+		// OpenID Connect and JSON Web Key Set
+		"GET /.well-known/openid-configuration": true, "GET /.well-known/jwks.json": true,
+		"/oidc/authorize": true, "POST /oidc/token": true, "/oidc/userinfo": true,
+	}
+	webAPITypeNameRe = regexp.MustCompile(`^web[A-Za-z0-9]*(Request|Response)$`)
+)
+
+type webRoute struct {
+	method  string
+	path    string
+	handler string
+}
+
+// parseWebRoutes finds all calls to mux.Handle and mux.HandleFunc inside the package
+// as well as the top-level function declarations.
+func parseWebRoutes(t *testing.T) (routes []webRoute, funcs map[string]*ast.FuncDecl) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	funcs = make(map[string]*ast.FuncDecl)
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				if fd, ok := decl.(*ast.FuncDecl); ok && fd.Recv == nil {
+					funcs[fd.Name.Name] = fd
+				}
+			}
+			ast.Inspect(file, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok || len(call.Args) != 2 {
+					return true
+				}
+				sel, ok := call.Fun.(*ast.SelectorExpr)
+				if !ok || (sel.Sel.Name != "Handle" && sel.Sel.Name != "HandleFunc") {
+					return true
+				}
+				if x, ok := sel.X.(*ast.Ident); !ok || x.Name != "mux" {
+					return true
+				}
+				lit, ok := call.Args[0].(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					t.Errorf("%s: route patterns must be string literals", fset.Position(call.Pos()))
+					return true
+				}
+				pattern, _ := strconv.Unquote(lit.Value)
+				if webNonAPIRoutes[pattern] {
+					return true
+				}
+
+				route := webRoute{}
+				if method, path, found := strings.Cut(pattern, " "); found {
+					route.method, route.path = method, path
+				} else {
+					route.path = pattern
+				}
+				if cl, ok := call.Args[1].(*ast.CompositeLit); ok && len(cl.Elts) == 3 {
+					if h, ok := cl.Elts[2].(*ast.Ident); ok {
+						route.handler = h.Name
+					}
+				}
+				routes = append(routes, route)
+				return true
+			})
+		}
+	}
+	return
+}
+
+func usedWebAPITypes(fd *ast.FuncDecl) map[string]bool {
+	types := make(map[string]bool)
+	ast.Inspect(fd, func(n ast.Node) bool {
+		if cl, ok := n.(*ast.CompositeLit); ok {
+			if id, ok := cl.Type.(*ast.Ident); ok && webAPITypeNameRe.MatchString(id.Name) && id.Name != "webV2ErrorResponse" {
+				types[id.Name] = true
+			}
+		}
+		return true
+	})
+	return types
+}
+
+func TestOpenAPIDocumentsAllRoutes(t *testing.T) {
+	routes, funcs := parseWebRoutes(t)
+	if len(routes) == 0 {
+		t.Fatal("no routes found")
+	}
+
+	for _, route := range routes {
+		var ops []webAPIOperation
+		for _, op := range webAPIOperations {
+			if op.path == route.path && (route.method == "" || route.method == op.method) {
+				ops = append(ops, op)
+			}
+		}
+		if len(ops) == 0 {
+			t.Errorf("route '%s %s' is not documented in the OpenAPI spec", route.method, route.path)
+			continue
+		}
+		if route.handler == "" {
+			continue
+		}
+
+		fd, exists := funcs[route.handler]
+		if !exists {
+			t.Errorf("handler '%s' for route '%s' not found", route.handler, route.path)
+			continue
+		}
+		used := usedWebAPITypes(fd)
+		documented := make(map[string]bool)
+		for _, op := range ops {
+			if op.request != nil {
+				documented[op.request.Name()] = true
+				if !used[op.request.Name()] {
+					t.Errorf("'%s %s': handler %s does not use the documented request type %s", op.method, op.path, route.handler, op.request.Name())
+				}
+			}
+			if op.response != nil {
+				documented[op.response.Name()] = true
+			}
+			for _, alt := range op.alt {
+				documented[alt.Name()] = true
+			}
+		}
+		for name := range used {
+			if !documented[name] {
+				t.Errorf("route '%s %s': handler %s uses %s which is not documented", route.method, route.path, route.handler, name)
+			}
+		}
+	}
+}
+
+func TestOpenAPIOperationsAreRouted(t *testing.T) {
+	mux, err := newWebHandler(nil, &webConfig{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	for _, op := range webAPIOperations {
+		path := regexp.MustCompile(`\{[^}]+\}`).ReplaceAllString(op.path, "test")
+		_, pattern := mux.Handler(httptest.NewRequest(op.method, path, nil))
+		if pattern == "" || webNonAPIRoutes[pattern] {
+			t.Errorf("documented operation '%s %s' is not handled (got pattern '%s')", op.method, op.path, pattern)
+		}
+	}
+}
+
+func TestOpenAPISpecReferences(t *testing.T) {
+	data, err := json.Marshal(newOpenAPISpec())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	spec := make(map[string]interface{})
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+
+	for _, ref := range regexp.MustCompile(`"\$ref":"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(string(data), -1) {
+		if _, exists := schemas[ref[1]]; !exists {
+			t.Errorf("unresolved reference to schema '%s'", ref[1])
+		}
+	}
+}
+
+func TestOpenAPISchemaNames(t *testing.T) {
+	apiUser := reflect.TypeOf(webV2User{})
+	// declared inside this function, so it has the same name as the type used by the API
+	type webV2User struct {
+		Other string `json:"other"`
+	}
+	localUser := reflect.TypeOf(webV2User{})
+
+	g := newOpenAPIGenerator()
+	testvectors := []struct {
+		t   reflect.Type
+		ref string
+	}{
+		{apiUser, "#/components/schemas/webV2User"},
+		{localUser, "#/components/schemas/webV2User2"},
+		{reflect.TypeOf(storeLib.UserFull{}), "#/components/schemas/store.UserFull"},
+		{localUser, "#/components/schemas/webV2User2"},
+	}
+	for _, vector := range testvectors {
+		if ref := g.schemaFor(vector.t)["$ref"]; ref != vector.ref {
+			t.Errorf("%v: expected reference '%s', got '%v'", vector.t, vector.ref, ref)
+		}
+	}
+	properties := g.schemas["webV2User2"].(map[string]interface{})["properties"].(map[string]interface{})
+	if _, exists := properties["other"]; !exists {
+		t.Error("schemas of types with the same name have been mixed up")
+	}
+	if schema := g.schemaFor(reflect.TypeOf(struct{ A string }{})); schema["type"] != "object" {
+		t.Errorf("anonymous structs should be inlined, got %v", schema)
+	}
+}
@@ -42,8 +42,46 @@ import (
 	"time"
 )
 
+// webSessionKind tells apart sessions which may be used for the web-api from sessions
+// which are only valid for forward-auth. The cookie of forward-auth sessions is sent to
+// all applications in the cookie domain so they must not grant access to the web-api.
+type webSessionKind int
+
+const (
+	webSessionAPI webSessionKind = iota
+	webSessionForwardAuth
+)
+
+// tokenType returns the JWT type of sessions of kind k.
+func (k webSessionKind) tokenType() string {
+	if k == webSessionForwardAuth {
+		return "forward-auth+jwt"
+	}
+	return "session+jwt"
+}
+
+// additionalData returns the data which is authenticated together with encrypted
+// sessions of kind k.
+func (k webSessionKind) additionalData() []byte {
+	if k == webSessionForwardAuth {
+		return []byte("forward-auth")
+	}
+	return nil
+}
+
+type webSessionClaims struct {
+	jwtRegisteredClaims
+	IsAdmin bool   `json:"admin"`
+	ID      string `json:"jti"`
+}
+
+// webSessionFactory creates and checks session tokens. By default tokens are encrypted
+// using a random AES key and can only be checked by the process that created them. If
+// a signer is set the tokens are signed JWTs which can be checked by anybody who knows
+// the public key.
 type webSessionFactory struct {
 	aesgcm   cipher.AEAD
+	signer   *jwtSigner
 	lifetime time.Duration
 }
 
@@ -72,7 +110,55 @@ func NewWebSessionFactory(lifetime time.Duration) (w *webSessionFactory, err err
 	return
 }
 
-func (w *webSessionFactory) sealToken(token string) (status int, errorStr string, nonce, enctoken []byte) {
+func NewJWTWebSessionFactory(lifetime time.Duration, signer *jwtSigner) (w *webSessionFactory, err error) {
+	w = &webSessionFactory{}
+	w.lifetime = lifetime
+	w.signer = signer
+	return
+}
+
+func (w *webSessionFactory) generateJWT(kind webSessionKind, username string, isAdmin bool) (status int, errorStr, session string) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		status = http.StatusInternalServerError
+		errorStr = fmt.Sprintf("generating session id failed: %v", err)
+		return
+	}
+
+	now := time.Now()
+	claims := &webSessionClaims{IsAdmin: isAdmin, ID: base64.RawURLEncoding.EncodeToString(id)}
+	claims.Subject = username
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(w.lifetime).Unix()
+
+	var err error
+	if session, err = w.signer.Sign(kind.tokenType(), claims); err != nil {
+		status = http.StatusInternalServerError
+		errorStr = fmt.Sprintf("signing session failed: %v", err)
+		return
+	}
+	status = http.StatusOK
+	return
+}
+
+func (w *webSessionFactory) checkJWT(kind webSessionKind, session string) (status int, errorStr string, username string, isAdmin bool, issued, expires time.Time) {
+	claims := &webSessionClaims{}
+	if err := w.signer.Verify(session, kind.tokenType(), claims); err != nil {
+		status = http.StatusUnauthorized
+		errorStr = fmt.Sprintf("invalid session token: %v", err)
+		return
+	}
+	if claims.IssuedAt > time.Now().Unix() {
+		status = http.StatusBadRequest
+		errorStr = "session token is from the future."
+		return
+	}
+
+	status = http.StatusOK
+	return status, "", claims.Subject, claims.IsAdmin, time.Unix(claims.IssuedAt, 0), time.Unix(claims.ExpiresAt, 0)
+}
+
+func (w *webSessionFactory) sealToken(kind webSessionKind, token string) (status int, errorStr string, nonce, enctoken []byte) {
 	nonce = make([]byte, w.aesgcm.NonceSize())
 	if noncelen, err := rand.Read(nonce); noncelen != len(nonce) || err != nil {
 		status = http.StatusInternalServerError
@@ -83,13 +169,13 @@ func (w *webSessionFactory) sealToken(token string) (status int, errorStr string
 		return
 	}
 
-	enctoken = w.aesgcm.Seal(nil, nonce, []byte(token), nil)
+	enctoken = w.aesgcm.Seal(nil, nonce, []byte(token), kind.additionalData())
 	status = http.StatusOK
 	return
 }
 
-func (w *webSessionFactory) openToken(nonce, enctoken []byte) (status int, errorStr string, token string) {
-	tokendata, err := w.aesgcm.Open(nil, nonce, enctoken, nil)
+func (w *webSessionFactory) openToken(kind webSessionKind, nonce, enctoken []byte) (status int, errorStr string, token string) {
+	tokendata, err := w.aesgcm.Open(nil, nonce, enctoken, kind.additionalData())
 	if err != nil {
 		status = http.StatusUnauthorized
 		errorStr = err.Error()
@@ -101,7 +187,7 @@ func (w *webSessionFactory) openToken(nonce, enctoken []byte) (status int, error
 	return
 }
 
-func (w *webSessionFactory) splitCheckToken(token string) (status int, errorStr string, username string, isAdmin bool) {
+func (w *webSessionFactory) splitCheckToken(token string) (status int, errorStr string, username string, isAdmin bool, issued, expires time.Time) {
 	tmp := strings.SplitN(token, ":", 3)
 	if len(tmp) != 3 {
 		status = http.StatusBadRequest
@@ -141,15 +227,30 @@ func (w *webSessionFactory) splitCheckToken(token string) (status int, errorStr
 		return
 	}
 
+	issued = st
+	expires = st.Add(w.lifetime)
 	status = http.StatusOK
 	return
 }
 
 func (w *webSessionFactory) Generate(username string, isAdmin bool) (status int, errorStr, session string) {
+	return w.generate(webSessionAPI, username, isAdmin)
+}
+
+// GenerateForwardAuth creates a session which is only accepted by CheckForwardAuth.
+func (w *webSessionFactory) GenerateForwardAuth(username string, isAdmin bool) (status int, errorStr, session string) {
+	return w.generate(webSessionForwardAuth, username, isAdmin)
+}
+
+func (w *webSessionFactory) generate(kind webSessionKind, username string, isAdmin bool) (status int, errorStr, session string) {
+	if w.signer != nil {
+		return w.generateJWT(kind, username, isAdmin)
+	}
+
 	token := fmt.Sprintf("%s:%t:%d", username, isAdmin, time.Now().Unix())
 
 	var nonce, enctoken []byte
-	status, errorStr, nonce, enctoken = w.sealToken(token)
+	status, errorStr, nonce, enctoken = w.sealToken(kind, token)
 	if status != http.StatusOK {
 		return
 	}
@@ -159,6 +260,30 @@ func (w *webSessionFactory) Generate(username string, isAdmin bool) (status int,
 }
 
 func (w *webSessionFactory) Check(session string) (status int, errorStr string, username string, isAdmin bool) {
+	status, errorStr, username, isAdmin, _, _ = w.check(webSessionAPI, session)
+	return
+}
+
+// CheckForwardAuth checks sessions created by GenerateForwardAuth.
+func (w *webSessionFactory) CheckForwardAuth(session string) (status int, errorStr string, username string, isAdmin bool) {
+	status, errorStr, username, isAdmin, _, _ = w.check(webSessionForwardAuth, session)
+	return
+}
+
+// Introspect returns all information about a valid session token.
+func (w *webSessionFactory) Introspect(session string) (info webTokenInfo, ok bool) {
+	status, _, username, isAdmin, issued, expires := w.check(webSessionAPI, session)
+	if status != http.StatusOK {
+		return
+	}
+	return webTokenInfo{TokenType: "session", Username: username, IsAdmin: isAdmin, IssuedAt: issued, ExpiresAt: expires}, true
+}
+
+func (w *webSessionFactory) check(kind webSessionKind, session string) (status int, errorStr string, username string, isAdmin bool, issued, expires time.Time) {
+	if w.signer != nil {
+		return w.checkJWT(kind, session)
+	}
+
 	tmp := strings.SplitN(session, ":", 2)
 	if len(tmp) != 2 {
 		status = http.StatusBadRequest
@@ -181,10 +306,32 @@ func (w *webSessionFactory) Check(session string) (status int, errorStr string,
 	}
 
 	var token string
-	status, errorStr, token = w.openToken(nonce, enctoken)
+	status, errorStr, token = w.openToken(kind, nonce, enctoken)
 	if status != http.StatusOK {
 		return
 	}
 
 	return w.splitCheckToken(token)
 }
+
+// webJWKS publishes the public keys of all signers used by a web-api listener.
+type webJWKS []*jwtSigner
+
+func (signers webJWKS) handle(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+	keys := []interface{}{}
+	seen := make(map[string]bool)
+	for _, s := range signers {
+		if seen[s.kid] {
+			continue
+		}
+		seen[s.kid] = true
+
+		jwk, err := s.JWK()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		keys = append(keys, jwk)
+	}
+	sendWebResponse(w, http.StatusOK, map[string]interface{}{"keys": keys})
+}
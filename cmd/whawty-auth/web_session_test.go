@@ -0,0 +1,134 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWebSessionFormats(t *testing.T) {
+	aes, err := newWebSessionFactory(&webSessionConfig{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	jwt, err := newWebSessionFactory(&webSessionConfig{Format: "jwt"})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, err = newWebSessionFactory(&webSessionConfig{Format: "invalid"}); err == nil {
+		t.Fatal("creating session factory with invalid format should fail")
+	}
+
+	for _, f := range []*webSessionFactory{aes, jwt} {
+		status, errorStr, session := f.Generate("test", true)
+		if status != http.StatusOK {
+			t.Fatal("unexpected error:", errorStr)
+		}
+		status, errorStr, username, isAdmin := f.Check(session)
+		if status != http.StatusOK {
+			t.Fatal("unexpected error:", errorStr)
+		}
+		if username != "test" || !isAdmin {
+			t.Fatalf("session check returned wrong user: %s (admin: %t)", username, isAdmin)
+		}
+	}
+
+	_, _, session := aes.Generate("test", false)
+	if status, _, _, _ := jwt.Check(session); status == http.StatusOK {
+		t.Fatal("checking an AES-GCM session using JWT should fail")
+	}
+	_, _, session = jwt.Generate("test", false)
+	if status, _, _, _ := aes.Check(session); status == http.StatusOK {
+		t.Fatal("checking a JWT session using AES-GCM should fail")
+	}
+
+	jwt.lifetime = -time.Second
+	_, _, session = jwt.Generate("test", false)
+	if status, _, _, _ := jwt.Check(session); status != http.StatusUnauthorized {
+		t.Fatalf("checking an expired session should fail with 401, got %d", status)
+	}
+}
+
+func TestWebSessionLifetime(t *testing.T) {
+	sessions, err := newWebSessionFactory(&webSessionConfig{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if sessions.lifetime != 10*time.Minute {
+		t.Fatalf("default session lifetime should be 10m, got %v", sessions.lifetime)
+	}
+	for _, format := range []string{"aes-gcm", "jwt"} {
+		if sessions, err = newWebSessionFactory(&webSessionConfig{Format: format, Lifetime: 12 * time.Hour}); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if sessions.lifetime != 12*time.Hour {
+			t.Fatalf("session lifetime should be 12h, got %v", sessions.lifetime)
+		}
+	}
+	if _, err = newWebSessionFactory(&webSessionConfig{Lifetime: -time.Second}); err == nil {
+		t.Fatal("creating session factory with negative lifetime should fail")
+	}
+}
+
+func TestWebSessionKinds(t *testing.T) {
+	aes, err := newWebSessionFactory(&webSessionConfig{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	jwt, err := newWebSessionFactory(&webSessionConfig{Format: "jwt"})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	for _, f := range []*webSessionFactory{aes, jwt} {
+		_, _, session := f.GenerateForwardAuth("test", true)
+		status, errorStr, username, isAdmin := f.CheckForwardAuth(session)
+		if status != http.StatusOK {
+			t.Fatal("unexpected error:", errorStr)
+		}
+		if username != "test" || !isAdmin {
+			t.Fatalf("session check returned wrong user: %s (admin: %t)", username, isAdmin)
+		}
+		if status, _, _, _ := f.Check(session); status == http.StatusOK {
+			t.Fatal("forward-auth sessions should not be valid for the web-api")
+		}
+		if _, ok := f.Introspect(session); ok {
+			t.Fatal("forward-auth sessions should not be valid for introspection")
+		}
+
+		_, _, session = f.Generate("test", true)
+		if status, _, _, _ := f.CheckForwardAuth(session); status == http.StatusOK {
+			t.Fatal("web-api sessions should not be valid for forward-auth")
+		}
+	}
+}
@@ -0,0 +1,84 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// webRequireTLS refuses requests which carry passwords unless they were received using TLS,
+// from the loopback interface or from a trusted reverse proxy which terminates TLS.
+type webRequireTLS struct {
+	trustedProxies networkList
+}
+
+func newWebRequireTLS(config *webRequireTLSConfig) (*webRequireTLS, error) {
+	if config == nil {
+		return nil, nil
+	}
+	networks, err := parseNetworkList(config.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %v", err)
+	}
+	return &webRequireTLS{trustedProxies: networks}, nil
+}
+
+func (t *webRequireTLS) allowed(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	ip := net.ParseIP(webClientAddr(r))
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	return t.trustedProxies.Contains(ip)
+}
+
+// handler wraps h so it is only called for requests which are allowed. If no TLS is required
+// h is returned as is.
+func (t *webRequireTLS) handler(h func(*Store, *webSessionFactory, http.ResponseWriter, *http.Request)) func(*Store, *webSessionFactory, http.ResponseWriter, *http.Request) {
+	if t == nil {
+		return h
+	}
+	return func(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+		if !t.allowed(r) {
+			wdl.Printf("web-api: refusing request for '%s' from %s without TLS", r.URL.Path, r.RemoteAddr)
+			http.Error(w, "TLS is required", http.StatusForbidden)
+			return
+		}
+		h(store, sessions, w, r)
+	}
+}
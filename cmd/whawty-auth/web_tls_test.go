@@ -0,0 +1,136 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebRequireTLS(t *testing.T) {
+	if _, err := newWebRequireTLS(&webRequireTLSConfig{TrustedProxies: []string{"not-an-address"}}); err == nil {
+		t.Fatal("invalid trusted proxy was accepted")
+	}
+	requireTLS, err := newWebRequireTLS(&webRequireTLSConfig{TrustedProxies: []string{"192.0.2.1", "2001:db8::/32"}})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	called := false
+	handler := func(store *Store, sessions *webSessionFactory, w http.ResponseWriter, r *http.Request) {
+		called = true
+	}
+
+	testvectors := []struct {
+		remote string
+		tls    bool
+		ok     bool
+	}{
+		{"198.51.100.7:1234", false, false},
+		{"198.51.100.7:1234", true, true},
+		{"127.0.0.1:1234", false, true},
+		{"[::1]:1234", false, true},
+		{"192.0.2.1:1234", false, true},
+		{"192.0.2.2:1234", false, false},
+		{"[2001:db8::1]:1234", false, true},
+		{"[2001:db9::1]:1234", false, false},
+	}
+	for _, vector := range testvectors {
+		r := httptest.NewRequest("GET", "/basic-auth", nil)
+		r.RemoteAddr = vector.remote
+		if vector.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		w := httptest.NewRecorder()
+		called = false
+		requireTLS.handler(handler)(nil, nil, w, r)
+		if called != vector.ok {
+			t.Errorf("request from %s (TLS: %t): expected handler to be called: %t, got %t", vector.remote, vector.tls, vector.ok, called)
+		}
+		if !vector.ok && w.Code != http.StatusForbidden {
+			t.Errorf("request from %s (TLS: %t): expected status %d, got %d", vector.remote, vector.tls, http.StatusForbidden, w.Code)
+		}
+	}
+
+	called = false
+	(*webRequireTLS)(nil).handler(handler)(nil, nil, httptest.NewRecorder(), httptest.NewRequest("GET", "/basic-auth", nil))
+	if !called {
+		t.Error("handler should always be called if TLS is not required")
+	}
+}
+
+func TestWebRequireTLSRoutes(t *testing.T) {
+	store := newTestStore(t, policyConfig{}, "")
+	h, err := newWebHandler(store, &webConfig{RequireTLS: &webRequireTLSConfig{}})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{"GET", "/basic-auth"},
+		{"POST", "/api/authenticate"},
+		{"POST", "/api/add"},
+		{"POST", "/api/update"},
+		{"POST", "/api/check-password"},
+		{"GET", "/forward-auth"},
+		{"GET", "/login"},
+		{"POST", "/login"},
+		{"POST", "/api/introspect"},
+		{"POST", "/api/v2/sessions"},
+		{"PUT", "/api/v2/users/alice"},
+		{"PATCH", "/api/v2/users/alice"},
+		{"PUT", "/api/v2/users/alice/app-passwords/mail"},
+		{"POST", "/api/v2/users/alice/reset-token"},
+		{"POST", "/api/v2/password-reset"},
+	}
+	for _, route := range routes {
+		r := httptest.NewRequest(route.method, route.path, nil)
+		r.RemoteAddr = "198.51.100.7:1234"
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s %s without TLS: expected status %d, got %d", route.method, route.path, http.StatusForbidden, w.Code)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/healthz", nil)
+	r.RemoteAddr = "198.51.100.7:1234"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("endpoints which don't carry passwords should not require TLS, got %d", w.Code)
+	}
+}
@@ -31,8 +31,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/whawty/auth/sasl"
 )
@@ -60,7 +62,9 @@ func main() {
 		return
 	}
 
-	ok, msg, err := c.Auth(login, password, service, realm)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ok, msg, err := c.AuthContext(ctx, login, password, service, realm)
 	if err != nil {
 		fmt.Println("auth() error:", err)
 		return
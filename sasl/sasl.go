@@ -33,71 +33,218 @@
 package sasl
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
+	"sync"
+	"time"
 )
 
 // AuthCB is the function signature of callbacks as used by the server to
 // handle authentication requests.
 type AuthCB func(login, password, service, realm string) (ok bool, msg string, err error)
 
+// ConnInfo holds information about the connection an authentication request
+// was received on.
+type ConnInfo struct {
+	// RemoteAddr is the address of the client. For unix sockets this is
+	// usually an unnamed address.
+	RemoteAddr net.Addr
+	// TLS is the state of the TLS connection, including the verified client
+	// certificates, if any. It is nil for servers which don't use TLS.
+	TLS *tls.ConnectionState
+}
+
+// AuthConnCB is the function signature of callbacks which also want to know
+// about the connection the request was received on. See Server.ConnCallback.
+type AuthConnCB func(info ConnInfo, login, password, service, realm string) (ok bool, msg string, err error)
+
+// DefaultTimeout is the default for Server.ReadTimeout and Server.WriteTimeout.
+const DefaultTimeout = 30 * time.Second
+
+var (
+	// ErrServerClosed is returned by Run after Shutdown has been called.
+	ErrServerClosed = errors.New("sasl: server closed")
+	// ErrTransport is matched by all client errors which happen while connecting to
+	// the server, sending the request or receiving the response.
+	ErrTransport = errors.New("sasl: transport error")
+	// ErrDecode is matched by client errors caused by invalid responses.
+	ErrDecode = errors.New("sasl: invalid response")
+)
+
 // Server holds all information needed to run the server. Use NewServer to
 // create the struct.
 type Server struct {
+	// MaxConnections limits the number of connections handled concurrently. If
+	// the limit is reached no new connections are accepted until one of them is
+	// closed. 0 means no limit.
+	MaxConnections int
+	// ReadTimeout is the deadline for reading the request of a connection,
+	// WriteTimeout the deadline for writing the response once the callback has
+	// returned. The time the callback takes is not limited by either of them.
+	// 0 means no deadline. NewServer and friends set both to DefaultTimeout.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// ConnCallback, if set, gets called instead of the callback passed to
+	// NewServer and friends, which may be nil in this case.
+	ConnCallback AuthConnCB
+
 	sockPath string
 	cb       AuthCB
 	ln       net.Listener
+
+	mutex   sync.Mutex
+	closing chan struct{}
+	conns   map[net.Conn]struct{}
+	wg      sync.WaitGroup
+}
+
+func newServer(sockPath string, ln net.Listener, cb AuthCB) *Server {
+	return &Server{
+		ReadTimeout:  DefaultTimeout,
+		WriteTimeout: DefaultTimeout,
+		sockPath:     sockPath,
+		cb:           cb,
+		ln:           ln,
+		closing:      make(chan struct{}),
+		conns:        make(map[net.Conn]struct{}),
+	}
 }
 
 // NewServer creates a server struct and starts listening on the unix socket
 // as specified by socketpath. cb is the callback function which will get
 // called for any authentication request.
 func NewServer(socketpath string, cb AuthCB) (s *Server, err error) {
-	s = &Server{}
-	s.sockPath = socketpath
-	s.cb = cb
-	if s.ln, err = net.Listen("unix", s.sockPath); err != nil {
+	ln, err := net.Listen("unix", socketpath)
+	if err != nil {
 		return
 	}
-	return
+	return newServer(socketpath, ln, cb), nil
 }
 
 // NewServerFromListener creates a server struct using a UnixListener specified
 // by ln. cb is the callback function which will get called for any authentication
 // request.
 func NewServerFromListener(ln *net.UnixListener, cb AuthCB) (s *Server, err error) {
-	s = &Server{}
-	s.sockPath = ln.Addr().String()
-	s.cb = cb
-	s.ln = net.Listener(ln)
-	return
+	return newServer(ln.Addr().String(), ln, cb), nil
+}
+
+// NewTLSServer creates a server struct and starts listening on the TCP address
+// addr. Since passwords are sent in clear text, all connections must use TLS
+// as configured by config. Use tls.RequireAndVerifyClientCert as ClientAuth to
+// only accept clients with a valid certificate. cb is the callback function which
+// will get called for any authentication request.
+func NewTLSServer(addr string, config *tls.Config, cb AuthCB) (s *Server, err error) {
+	if config == nil {
+		return nil, errors.New("sasl: a TLS configuration is required")
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return
+	}
+	return NewTLSServerFromListener(ln, config, cb)
+}
+
+// NewTLSServerFromListener creates a server struct using the TCP listener ln.
+// All connections must use TLS as configured by config. cb is the callback
+// function which will get called for any authentication request.
+func NewTLSServerFromListener(ln net.Listener, config *tls.Config, cb AuthCB) (s *Server, err error) {
+	if config == nil {
+		return nil, errors.New("sasl: a TLS configuration is required")
+	}
+	return newServer(ln.Addr().String(), tls.NewListener(ln, config), cb), nil
 }
 
 func (s *Server) handleConnection(conn net.Conn) {
 	defer conn.Close() //nolint:errcheck
 
+	if s.ReadTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(s.ReadTimeout)) //nolint:errcheck
+	}
+
 	resp := &Response{}
 	req := &Request{}
 	if err := req.Decode(conn); err != nil {
 		resp.Result = false
 		resp.Message = fmt.Sprintf("Error decoding request: %v", err)
 	} else {
-		resp.Result, resp.Message, err = s.cb(req.Login, req.Password, req.Service, req.Realm)
+		if s.ConnCallback != nil {
+			info := ConnInfo{RemoteAddr: conn.RemoteAddr()}
+			// the handshake has been completed by reading the request
+			if tlsConn, ok := conn.(*tls.Conn); ok {
+				state := tlsConn.ConnectionState()
+				info.TLS = &state
+			}
+			resp.Result, resp.Message, err = s.ConnCallback(info, req.Login, req.Password, req.Service, req.Realm)
+		} else {
+			resp.Result, resp.Message, err = s.cb(req.Login, req.Password, req.Service, req.Realm)
+		}
 		if err != nil {
 			resp.Result = false
 			resp.Message = err.Error()
 		}
 	}
 
+	if s.WriteTimeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(s.WriteTimeout)) //nolint:errcheck
+	}
 	resp.Encode(conn) //nolint:errcheck
 }
 
+// trackConn registers conn as active. It returns false if the server is
+// shutting down in which case conn must not be handled anymore.
+func (s *Server) trackConn(conn net.Conn) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	select {
+	case <-s.closing:
+		return false
+	default:
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) untrackConn(conn net.Conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.conns, conn)
+	s.wg.Done()
+}
+
 // Run actually runs the server. In calls Accept() on the server socket and
-// runs go-routines for new connections.
+// runs go-routines for new connections. After Shutdown has been called Run
+// returns ErrServerClosed.
 func (s *Server) Run() error {
+	var slots chan struct{}
+	if s.MaxConnections > 0 {
+		slots = make(chan struct{}, s.MaxConnections)
+	}
 	for {
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+			case <-s.closing:
+				return ErrServerClosed
+			}
+		}
+		release := func() {
+			if slots != nil {
+				<-slots
+			}
+		}
+
 		conn, err := s.ln.Accept()
 		if err != nil {
+			release()
+			select {
+			case <-s.closing:
+				return ErrServerClosed
+			default:
+			}
 			operr, ok := err.(*net.OpError)
 			if !ok {
 				return err
@@ -107,41 +254,154 @@ func (s *Server) Run() error {
 			}
 			return err
 		}
-		go s.handleConnection(conn)
+		if !s.trackConn(conn) {
+			conn.Close() //nolint:errcheck
+			release()
+			return ErrServerClosed
+		}
+		go func() {
+			defer release()
+			defer s.untrackConn(conn)
+			s.handleConnection(conn)
+		}()
+	}
+}
+
+// Shutdown stops accepting new connections and waits for all active connections
+// to be handled. If ctx expires before this is done, all remaining connections
+// are closed and the error of ctx is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	select {
+	case <-s.closing:
+	default:
+		close(s.closing)
+	}
+	s.mutex.Unlock()
+	err := s.ln.Close()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	s.mutex.Lock()
+	for conn := range s.conns {
+		conn.Close() //nolint:errcheck
 	}
+	s.mutex.Unlock()
+	return ctx.Err()
 }
 
 // Client holds all information needed to send and authentication request as well as to
 // receive responses from saslauthd compatible servers. Use NewClient to create the socket.
 type Client struct {
-	sockPath string
+	sockPath  string
+	tlsConfig *tls.Config
 }
 
-// NewClient creates a client struct.
-func NewClient(socketpath string) (c *Client) {
+// ClientOption configures how a client connects to the server.
+type ClientOption func(c *Client)
+
+// WithTLS makes the client connect to a server created using NewTLSServer. The
+// address passed to NewClient is a TCP address in this case. Add a client
+// certificate to config if the server requires one.
+func WithTLS(config *tls.Config) ClientOption {
+	return func(c *Client) {
+		c.tlsConfig = config
+	}
+}
+
+// NewClient creates a client struct. By default socketpath is the path to a
+// unix socket.
+func NewClient(socketpath string, opts ...ClientOption) (c *Client) {
 	c = &Client{}
 	c.sockPath = socketpath
+	for _, opt := range opts {
+		opt(c)
+	}
 	return
 }
 
-// Auth connects to the server socket and sends an authentication request.
-func (c *Client) Auth(login, password, service, realm string) (ok bool, msg string, err error) {
-	var conn net.Conn
-	if conn, err = net.Dial("unix", c.sockPath); err != nil {
-		return
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	if c.tlsConfig != nil {
+		d := &tls.Dialer{Config: c.tlsConfig}
+		return d.DialContext(ctx, "tcp", c.sockPath)
+	}
+	d := &net.Dialer{}
+	return d.DialContext(ctx, "unix", c.sockPath)
+}
+
+// transportError wraps err so it matches ErrTransport as well as the error of ctx
+// if this is the reason for the failure.
+func transportError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("%w: %w", ErrTransport, ctxErr)
+	}
+	return fmt.Errorf("%w: %w", ErrTransport, err)
+}
+
+func (c *Client) roundTrip(ctx context.Context, req *Request) (resp *Response, err error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, transportError(ctx, err)
 	}
 	defer conn.Close() //nolint:errcheck
 
-	req := &Request{login, password, service, realm}
+	// once ctx is done, pending reads and writes fail immediately
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0)) //nolint:errcheck
+	})
+	defer stop()
+
 	if err = req.Encode(conn); err != nil {
-		return
+		var netErr net.Error
+		if errors.As(err, &netErr) {
+			return nil, transportError(ctx, err)
+		}
+		return nil, err
 	}
 
-	resp := &Response{false, ""}
+	resp = &Response{false, ""}
 	if err = resp.Decode(conn); err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) || ctx.Err() != nil {
+			return nil, transportError(ctx, err)
+		}
+		return nil, fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+	return resp, nil
+}
+
+// Auth connects to the server socket and sends an authentication request.
+func (c *Client) Auth(login, password, service, realm string) (ok bool, msg string, err error) {
+	return c.AuthContext(context.Background(), login, password, service, realm)
+}
+
+// AuthContext connects to the server socket and sends an authentication request.
+// The deadline of ctx applies to connecting as well as to sending the request and
+// receiving the response. Errors while doing so match ErrTransport, responses which
+// can't be decoded match ErrDecode. If the server rejects the credentials ok is false
+// and err is nil, msg contains the reason as reported by the server.
+func (c *Client) AuthContext(ctx context.Context, login, password, service, realm string) (ok bool, msg string, err error) {
+	resp, err := c.roundTrip(ctx, &Request{login, password, service, realm})
+	if err != nil {
 		return
 	}
-	ok = resp.Result
-	msg = resp.Message
-	return
+	return resp.Result, resp.Message, nil
+}
+
+// Ping checks whether a saslauthd compatible server is answering requests. It sends
+// a request with an empty login and ignores whether it is accepted. Servers should
+// reject it without checking any credentials, otherwise every ping may count as a
+// failed login. Ping fails if no valid response is received before ctx is done.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.roundTrip(ctx, &Request{})
+	return err
 }
@@ -31,11 +31,21 @@
 package sasl
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"errors"
+	"io"
+	"math/big"
 	"net"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 const (
@@ -160,3 +170,305 @@ func TestAuthentication(t *testing.T) {
 		}
 	}
 }
+
+func testCertificate(t *testing.T, isCA bool) (tls.Certificate, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert
+}
+
+func TestTLSAuthentication(t *testing.T) {
+	if _, err := NewTLSServer("127.0.0.1:0", nil, callback); err == nil {
+		t.Fatal("creating a TLS server without TLS configuration should give an error")
+	}
+
+	serverCert, serverX509 := testCertificate(t, true)
+	clientCert, clientX509 := testCertificate(t, true)
+	serverCAs := x509.NewCertPool()
+	serverCAs.AddCert(serverX509)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientX509)
+
+	s, err := NewTLSServer("127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{serverCert}, ClientCAs: clientCAs, ClientAuth: tls.RequireAndVerifyClientCert}, callback)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	go s.Run() //nolint:errcheck
+	addr := s.ln.Addr().String()
+
+	c := NewClient(addr, WithTLS(&tls.Config{RootCAs: serverCAs, Certificates: []tls.Certificate{clientCert}}))
+	ok, msg, err := c.Auth(testUsername, testPassword, testService, testRealm)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if !ok || msg != "success" {
+		t.Fatalf("authentication failed: %s", msg)
+	}
+
+	c = NewClient(addr, WithTLS(&tls.Config{RootCAs: serverCAs}))
+	if _, _, err := c.Auth(testUsername, testPassword, testService, testRealm); err == nil {
+		t.Fatal("authentication without client certificate should give an error")
+	}
+
+	var remote net.Addr
+	var peerCerts []*x509.Certificate
+	s.ConnCallback = func(info ConnInfo, login, password, service, realm string) (bool, string, error) {
+		remote = info.RemoteAddr
+		if info.TLS != nil && len(info.TLS.VerifiedChains) > 0 {
+			peerCerts = info.TLS.VerifiedChains[0]
+		}
+		return callback(login, password, service, realm)
+	}
+	c = NewClient(addr, WithTLS(&tls.Config{RootCAs: serverCAs, Certificates: []tls.Certificate{clientCert}}))
+	if ok, _, err := c.Auth(testUsername, testPassword, testService, testRealm); err != nil || !ok {
+		t.Fatalf("authentication using the connection callback failed: ok = %t, err = %v", ok, err)
+	}
+	if tcpAddr, ok := remote.(*net.TCPAddr); !ok || !tcpAddr.IP.IsLoopback() {
+		t.Fatalf("connection callback got wrong remote address: %v", remote)
+	}
+	if len(peerCerts) == 0 || !peerCerts[0].Equal(clientX509) {
+		t.Fatal("connection callback didn't get the verified client certificate")
+	}
+
+	c = NewClient(addr, WithTLS(&tls.Config{Certificates: []tls.Certificate{clientCert}}))
+	if _, _, err := c.Auth(testUsername, testPassword, testService, testRealm); err == nil {
+		t.Fatal("authentication against an untrusted server should give an error")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	if err := os.Mkdir(testBaseDir, 0755); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer os.RemoveAll(testBaseDir) //nolint:errcheck
+
+	started := make(chan struct{})
+	proceed := make(chan struct{})
+	s, err := NewServer(filepath.Join(testBaseDir, "sock"), func(login, password, service, realm string) (bool, string, error) {
+		close(started)
+		<-proceed
+		return callback(login, password, service, realm)
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	runErr := make(chan error, 1)
+	go func() { runErr <- s.Run() }()
+
+	c := NewClient(filepath.Join(testBaseDir, "sock"))
+	authErr := make(chan error, 1)
+	go func() {
+		ok, _, err := c.Auth(testUsername, testPassword, testService, testRealm)
+		if err == nil && !ok {
+			err = errors.New("authentication failed")
+		}
+		authErr <- err
+	}()
+	<-started
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- s.Shutdown(context.Background()) }()
+	if err := <-runErr; err != ErrServerClosed {
+		t.Fatalf("Run should return ErrServerClosed, got: %v", err)
+	}
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("Shutdown returned before the active connection was handled: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(proceed)
+	if err := <-authErr; err != nil {
+		t.Fatal("in-flight authentication failed:", err)
+	}
+	if err := <-shutdownErr; err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, _, err := c.Auth(testUsername, testPassword, testService, testRealm); err == nil {
+		t.Fatal("authentication after shutdown should give an error")
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	if err := os.Mkdir(testBaseDir, 0755); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer os.RemoveAll(testBaseDir) //nolint:errcheck
+
+	s, err := NewServer(filepath.Join(testBaseDir, "sock"), callback)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	go s.Run() //nolint:errcheck
+
+	// a client which never sends a request keeps its connection active
+	conn, err := net.Dial("unix", filepath.Join(testBaseDir, "sock"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer conn.Close() //nolint:errcheck
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Shutdown should return context.DeadlineExceeded, got: %v", err)
+	}
+}
+
+func TestConnectionLimits(t *testing.T) {
+	if err := os.Mkdir(testBaseDir, 0755); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer os.RemoveAll(testBaseDir) //nolint:errcheck
+
+	s, err := NewServer(filepath.Join(testBaseDir, "sock"), callback)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	s.MaxConnections = 1
+	s.ReadTimeout = 200 * time.Millisecond
+	go s.Run() //nolint:errcheck
+
+	defer s.Shutdown(context.Background()) //nolint:errcheck
+	idle, err := net.Dial("unix", filepath.Join(testBaseDir, "sock"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer idle.Close() //nolint:errcheck
+
+	start := time.Now()
+	ok, _, err := NewClient(filepath.Join(testBaseDir, "sock")).Auth(testUsername, testPassword, testService, testRealm)
+	if err != nil || !ok {
+		t.Fatal("authentication failed:", err)
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Fatal("second connection was handled although the limit was reached")
+	}
+
+	// the idle connection must have been closed by the server after the read timeout,
+	// the server may still send an error response before that
+	idle.SetReadDeadline(time.Now().Add(time.Second)) //nolint:errcheck
+	if _, err := io.ReadAll(idle); err != nil {
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+			t.Fatal("idle connection is still open after the timeout")
+		}
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	if err := os.Mkdir(testBaseDir, 0755); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer os.RemoveAll(testBaseDir) //nolint:errcheck
+
+	c := NewClient(filepath.Join(testBaseDir, "nonexstend.sock"))
+	if _, _, err := c.AuthContext(context.Background(), testUsername, testPassword, testService, testRealm); !errors.Is(err, ErrTransport) {
+		t.Fatalf("unreachable socket should give a transport error, got: %v", err)
+	}
+
+	// a server which accepts connections but never answers
+	ln, err := net.Listen("unix", filepath.Join(testBaseDir, "silent.sock"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer ln.Close() //nolint:errcheck
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close() //nolint:errcheck
+		}
+	}()
+
+	c = NewClient(filepath.Join(testBaseDir, "silent.sock"))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, _, err = c.AuthContext(ctx, testUsername, testPassword, testService, testRealm)
+	if !errors.Is(err, ErrTransport) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("silent server should give a deadline exceeded transport error, got: %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if err = c.Ping(ctx); !errors.Is(err, ErrTransport) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceling the context should give a canceled transport error, got: %v", err)
+	}
+
+	// a server which answers with garbage
+	ln2, err := net.Listen("unix", filepath.Join(testBaseDir, "garbage.sock"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer ln2.Close() //nolint:errcheck
+	go func() {
+		for {
+			conn, err := ln2.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte{0, 5, 'H', 'E', 'L', 'L', 'O'}) //nolint:errcheck
+			conn.Close()                                      //nolint:errcheck
+		}
+	}()
+
+	c = NewClient(filepath.Join(testBaseDir, "garbage.sock"))
+	if _, _, err = c.AuthContext(context.Background(), testUsername, testPassword, testService, testRealm); !errors.Is(err, ErrDecode) {
+		t.Fatalf("invalid response should give a decode error, got: %v", err)
+	}
+	if err = c.Ping(context.Background()); !errors.Is(err, ErrDecode) {
+		t.Fatalf("invalid response should give a decode error, got: %v", err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	if err := os.Mkdir(testBaseDir, 0755); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer os.RemoveAll(testBaseDir) //nolint:errcheck
+
+	called := false
+	s, err := NewServer(filepath.Join(testBaseDir, "sock"), func(login, password, service, realm string) (bool, string, error) {
+		called = true
+		return true, "OK", nil
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	go s.Run()                             //nolint:errcheck
+	defer s.Shutdown(context.Background()) //nolint:errcheck
+
+	c := NewClient(filepath.Join(testBaseDir, "sock"))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.Ping(ctx); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if called {
+		t.Fatal("Ping must not invoke the authentication callback")
+	}
+}
@@ -0,0 +1,259 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package store
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const appPasswordAuxPrefix = "apppw-"
+
+// ErrAppPasswordTagInUse is returned by AddAppPassword if the user already has an
+// application password with the same tag. The caller should generate a new password.
+var ErrAppPasswordTagInUse = errors.New("whawty.auth.store: application password tag is already in use")
+
+var (
+	appPasswordNameRe = regexp.MustCompile("^[A-Za-z0-9][-_.A-Za-z0-9]*$")
+	appPasswordTagRe  = regexp.MustCompile("^[A-Za-z0-9]+$")
+)
+
+// AppPassword holds information about a named application password. The password
+// itself is only stored as a hash.
+type AppPassword struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+}
+
+// AppPasswordHash is the hash of the application password which matches the tag of a
+// password. Use FindAppPassword to get it and Check to compare the password. Checking
+// the password is expensive, splitting the lookup from the check allows callers to do
+// the latter without holding any locks.
+type AppPasswordHash struct {
+	Name    string
+	hasher  Hasher
+	hashStr string
+}
+
+// Check returns true if password matches the application password.
+func (h *AppPasswordHash) Check(password string) bool {
+	ok, err := h.hasher.Check(password, h.hashStr)
+	return err == nil && ok
+}
+
+// appPasswordTag returns the tag of an application password, which is the part up to
+// the first '-'. The tag is stored in clear text so only the application password with
+// the same tag needs to be checked during authentication. An empty result means the
+// password has no valid tag.
+func appPasswordTag(password string) string {
+	tag, _, found := strings.Cut(password, "-")
+	if !found || !appPasswordTagRe.MatchString(tag) {
+		return ""
+	}
+	return tag
+}
+
+// parseAppPassword splits the aux data of an application password into tag, format id,
+// creation time, parameter id and hash string. Apart from the leading tag this uses the
+// same layout as the first line of a hash file.
+func parseAppPassword(data []byte) (tag, formatID string, created time.Time, paramID uint, hashStr string, err error) {
+	parts := strings.SplitN(string(data), ":", 5)
+	if len(parts) != 5 {
+		err = fmt.Errorf("whawty.auth.store: application password is invalid")
+		return
+	}
+	tag = parts[0]
+	parts = parts[1:]
+	formatID = parts[0]
+	tmpTime, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		err = fmt.Errorf("whawty.auth.store: application password is invalid, %v", err)
+		return
+	}
+	created = time.Unix(tmpTime, 0)
+	tmpParamID, err := strconv.ParseUint(parts[2], 10, 0)
+	if err != nil {
+		err = fmt.Errorf("whawty.auth.store: application password is invalid, %v", err)
+		return
+	}
+	paramID = uint(tmpParamID)
+	hashStr = parts[3]
+	return
+}
+
+// AddAppPassword adds the application password called name. It is an error if
+// an application password of that name or with the same tag already exists. The
+// password must start with a tag made of letters and digits followed by '-'. Since
+// the tag is stored in clear text, the rest of the password must be secret enough
+// on its own.
+func (u *UserHash) AddAppPassword(name, password string) error {
+	if !appPasswordNameRe.MatchString(name) {
+		return fmt.Errorf("whawty.auth.store: application password name '%s' is invalid", name)
+	}
+	tag := appPasswordTag(password)
+	if tag == "" {
+		return fmt.Errorf("whawty.auth.store: application password has no tag")
+	}
+	hasher := u.store.Params[u.store.Default]
+	if hasher == nil {
+		return fmt.Errorf("whawty.auth.store: no default parameter-set")
+	}
+	hashStr, err := hasher.Generate(password)
+	if err != nil {
+		return err
+	}
+	data := fmt.Sprintf("%s:%s:%d:%d:%s", tag, hasher.GetFormatID(), time.Now().Unix(), u.store.Default, hashStr)
+
+	return u.updateAuxData(func(aux auxData) (auxData, error) {
+		if _, found, _ := aux.get(appPasswordAuxPrefix + name); found {
+			return nil, fmt.Errorf("whawty.auth.store: application password '%s' already exists", name)
+		}
+		if n, _, _ := u.findAppPassword(aux, tag); n != "" {
+			return nil, ErrAppPasswordTagInUse
+		}
+		return aux.set(appPasswordAuxPrefix+name, []byte(data)), nil
+	})
+}
+
+// RemoveAppPassword revokes the application password called name. It is an error
+// if no such application password exists.
+func (u *UserHash) RemoveAppPassword(name string) error {
+	return u.updateAuxData(func(aux auxData) (auxData, error) {
+		aux, found := aux.remove(appPasswordAuxPrefix + name)
+		if !found {
+			return nil, fmt.Errorf("whawty.auth.store: application password '%s' does not exist", name)
+		}
+		return aux, nil
+	})
+}
+
+// ListAppPasswords returns all application passwords of the user sorted by name.
+func (u *UserHash) ListAppPasswords() ([]AppPassword, error) {
+	aux, err := u.getAuxData()
+	if err != nil {
+		return nil, err
+	}
+
+	list := []AppPassword{}
+	for _, e := range aux {
+		name, ok := strings.CutPrefix(e.identifier, appPasswordAuxPrefix)
+		if !ok {
+			continue
+		}
+		data, _, err := aux.get(e.identifier)
+		if err != nil {
+			return nil, err
+		}
+		_, _, created, _, _, err := parseAppPassword(data)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, AppPassword{name, created})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// findAppPassword returns the name and data of the application password with tag.
+// Invalid application passwords are ignored.
+func (u *UserHash) findAppPassword(aux auxData, tag string) (name string, data []byte, err error) {
+	for _, e := range aux {
+		n, ok := strings.CutPrefix(e.identifier, appPasswordAuxPrefix)
+		if !ok {
+			continue
+		}
+		d, _, err := aux.get(e.identifier)
+		if err != nil {
+			wl.Printf("ignoring invalid application password '%s' of user '%s': %v", n, u.user, err)
+			continue
+		}
+		if t, _, _ := strings.Cut(string(d), ":"); t == tag {
+			return n, d, nil
+		}
+	}
+	return "", nil, nil
+}
+
+// FindAppPassword returns the hash of the application password with the same tag as
+// password and whether user is an admin. If there is no such application password
+// hash is nil. Application passwords with unknown or unsupported parameter-sets are
+// ignored.
+func (u *UserHash) FindAppPassword(password string) (hash *AppPasswordHash, isAdmin bool, err error) {
+	var exists bool
+	if exists, isAdmin, err = u.Exists(); err != nil {
+		return
+	} else if !exists {
+		return nil, false, fmt.Errorf("whawty.auth.store: user '%s' does not exist", u.user)
+	}
+
+	tag := appPasswordTag(password)
+	if tag == "" {
+		return nil, isAdmin, nil
+	}
+	aux, err := u.getAuxData()
+	if err != nil {
+		return nil, false, err
+	}
+	name, data, err := u.findAppPassword(aux, tag)
+	if err != nil || name == "" {
+		return nil, isAdmin, err
+	}
+	_, formatID, _, paramID, hashStr, err := parseAppPassword(data)
+	if err != nil {
+		wl.Printf("ignoring invalid application password '%s' of user '%s': %v", name, u.user, err)
+		return nil, isAdmin, nil
+	}
+	hasher := u.store.Params[paramID]
+	if hasher == nil || hasher.GetFormatID() != formatID {
+		wl.Printf("ignoring application password '%s' of user '%s' with unsupported parameter-set %d", name, u.user, paramID)
+		return nil, isAdmin, nil
+	}
+	return &AppPasswordHash{Name: name, hasher: hasher, hashStr: hashStr}, isAdmin, nil
+}
+
+// AuthenticateAppPassword checks password against the application password with the
+// same tag. It also returns whether user is an admin and the name of the application
+// password that matched.
+func (u *UserHash) AuthenticateAppPassword(password string) (isAuthenticated, isAdmin bool, name string, err error) {
+	hash, isAdmin, err := u.FindAppPassword(password)
+	if err != nil || hash == nil {
+		return false, isAdmin, "", err
+	}
+	if !hash.Check(password) {
+		return false, isAdmin, "", nil
+	}
+	return true, isAdmin, hash.Name, nil
+}
@@ -0,0 +1,165 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package store
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAppPasswords(t *testing.T) {
+	username := "test-app-passwords"
+	password := "secret"
+
+	u := NewUserHash(testStoreUserHash, username)
+	if err := u.Add(password, false); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer u.Remove()
+
+	if list, err := u.ListAppPasswords(); err != nil {
+		t.Fatal("unexpected error:", err)
+	} else if len(list) != 0 {
+		t.Fatalf("new user should not have any application passwords: %v", list)
+	}
+
+	if err := u.AddAppPassword("mail", "app1-secret"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := u.AddAppPassword("calendar", "app2-secret"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := u.AddAppPassword("mail", "app3-secret"); err == nil {
+		t.Fatal("adding an application password a second time returned no error!")
+	}
+	if err := u.AddAppPassword("in:valid", "app3-secret"); err == nil {
+		t.Fatal("adding an application password with an invalid name returned no error!")
+	}
+	if err := u.AddAppPassword("contacts", "app1-other-secret"); err != ErrAppPasswordTagInUse {
+		t.Fatalf("adding an application password with a tag which is in use should fail, got: %v", err)
+	}
+	if err := u.AddAppPassword("contacts", "secret"); err == nil {
+		t.Fatal("adding an application password without tag returned no error!")
+	}
+
+	list, err := u.ListAppPasswords()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(list) != 2 || list[0].Name != "calendar" || list[1].Name != "mail" {
+		t.Fatalf("list returned wrong application passwords: %v", list)
+	}
+
+	if ok, _, name, err := u.AuthenticateAppPassword("app1-secret"); err != nil {
+		t.Fatal("unexpected error:", err)
+	} else if !ok || name != "mail" {
+		t.Fatalf("authentication with application password failed: %v, %q", ok, name)
+	}
+	if hash, _, err := u.FindAppPassword("app2-wrong"); err != nil {
+		t.Fatal("unexpected error:", err)
+	} else if hash == nil || hash.Name != "calendar" || hash.Check("app2-wrong") || !hash.Check("app2-secret") {
+		t.Fatalf("find returned the wrong application password: %v", hash)
+	}
+	if hash, _, err := u.FindAppPassword("app4-secret"); err != nil || hash != nil {
+		t.Fatalf("find should not return anything for unknown tags: %v, %v", hash, err)
+	}
+	if ok, _, _, err := u.AuthenticateAppPassword(password); err != nil {
+		t.Fatal("unexpected error:", err)
+	} else if ok {
+		t.Fatal("the main password must not be accepted as application password")
+	}
+	if ok, _, _, _, _ := u.Authenticate("app1-secret"); ok {
+		t.Fatal("application passwords must not be accepted as main password")
+	}
+
+	// changing the main password must keep the application passwords
+	if err := u.Update("new-secret"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if ok, _, _, err := u.AuthenticateAppPassword("app2-secret"); err != nil || !ok {
+		t.Fatal("application password got lost after password update:", err)
+	}
+
+	if err := u.RemoveAppPassword("mail"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := u.RemoveAppPassword("mail"); err == nil {
+		t.Fatal("removing an application password a second time returned no error!")
+	}
+	if ok, _, _, err := u.AuthenticateAppPassword("app1-secret"); err != nil {
+		t.Fatal("unexpected error:", err)
+	} else if ok {
+		t.Fatal("revoked application password is still accepted")
+	}
+	if ok, _, _, _, err := u.Authenticate("new-secret"); err != nil || !ok {
+		t.Fatal("main password is no longer accepted:", err)
+	}
+}
+
+func TestAppPasswordsKeepAuxData(t *testing.T) {
+	username := "test-app-passwords-aux"
+
+	u := NewUserHash(testStoreUserHash, username)
+	if err := u.Add("secret", true); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer u.Remove()
+
+	filename := u.getFilename(true)
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, err := file.WriteString("totp: dG90cA==\n"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	file.Close() //nolint:errcheck
+
+	if err := u.AddAppPassword("mail", "app1-secret"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := u.RemoveAppPassword("mail"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || lines[1] != "totp: dG90cA==" {
+		t.Fatalf("unrelated aux data got modified: %q", lines)
+	}
+	if ok, isAdmin, _, _, err := u.Authenticate("secret"); err != nil || !ok || !isAdmin {
+		t.Fatal("user got modified by updating aux data:", err)
+	}
+}
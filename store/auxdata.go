@@ -0,0 +1,172 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package store
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// auxEntry is a single line of auxiliary data as found after the first line
+// of a user hash file. The value is kept in its base64 encoded form so entries
+// this agent doesn't know about are written back unmodified.
+type auxEntry struct {
+	identifier string
+	value      string
+}
+
+// auxData holds all auxiliary data of a user in the order found in the file.
+type auxData []auxEntry
+
+func (a auxData) get(identifier string) (data []byte, found bool, err error) {
+	for _, e := range a {
+		if e.identifier == identifier {
+			data, err = base64.StdEncoding.DecodeString(e.value)
+			return data, true, err
+		}
+	}
+	return nil, false, nil
+}
+
+func (a auxData) set(identifier string, data []byte) auxData {
+	value := base64.StdEncoding.EncodeToString(data)
+	for i := range a {
+		if a[i].identifier == identifier {
+			a[i].value = value
+			return a
+		}
+	}
+	return append(a, auxEntry{identifier, value})
+}
+
+func (a auxData) remove(identifier string) (auxData, bool) {
+	for i := range a {
+		if a[i].identifier == identifier {
+			return append(a[:i], a[i+1:]...), true
+		}
+	}
+	return a, false
+}
+
+// readAuxData returns the first line of the hash file and all aux data lines
+// following it.
+func readAuxData(reader *bufio.Reader) (first string, aux auxData, err error) {
+	if first, err = reader.ReadString('\n'); err != nil && err != io.EOF {
+		return
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return first, aux, err
+		}
+		if line = strings.TrimRight(line, "\n"); line != "" {
+			identifier, value, ok := strings.Cut(line, ":")
+			if !ok {
+				return first, aux, fmt.Errorf("whawty.auth.store: hash file contains invalid aux data")
+			}
+			aux = append(aux, auxEntry{identifier, strings.TrimSpace(value)})
+		}
+		if err == io.EOF {
+			return first, aux, nil
+		}
+	}
+}
+
+// getAuxData returns all aux data lines of the user.
+func (u *UserHash) getAuxData() (auxData, error) {
+	exists, isAdmin, err := u.Exists()
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, fmt.Errorf("whawty.auth.store: user '%s' does not exist", u.user)
+	}
+
+	return readAuxDataFile(u.getFilename(isAdmin))
+}
+
+func readAuxDataFile(filename string) (auxData, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close() //nolint:errcheck
+
+	_, aux, err := readAuxData(bufio.NewReader(file))
+	return aux, err
+}
+
+// updateAuxData calls update with the current aux data of the user and atomically
+// replaces the hash file with one containing the returned aux data. The first
+// line of the file stays untouched.
+func (u *UserHash) updateAuxData(update func(aux auxData) (auxData, error)) error {
+	exists, isAdmin, err := u.Exists()
+	if err != nil {
+		return err
+	} else if !exists {
+		return fmt.Errorf("whawty.auth.store: user '%s' does not exist", u.user)
+	}
+
+	file, err := os.Open(u.getFilename(isAdmin))
+	if err != nil {
+		return err
+	}
+	defer file.Close() //nolint:errcheck
+
+	first, aux, err := readAuxData(bufio.NewReader(file))
+	if err != nil {
+		return err
+	}
+	if aux, err = update(aux); err != nil {
+		return err
+	}
+
+	tmp, err := u.store.getTempFile()
+	if err != nil {
+		return err
+	}
+	defer tmp.Close()           //nolint:errcheck
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	w := bufio.NewWriter(tmp)
+	w.WriteString(strings.TrimRight(first, "\n") + "\n") //nolint:errcheck
+	for _, e := range aux {
+		fmt.Fprintf(w, "%s: %s\n", e.identifier, e.value) //nolint:errcheck
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return commitTempFile(tmp, file.Name())
+}
@@ -0,0 +1,73 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package store
+
+const (
+	passwordPolicyAuxIdentifier = "policy"
+	mustChangeAuxIdentifier     = "must-change"
+)
+
+// SetPasswordPolicy records the name of the password policy the current password of the
+// user has been checked against. This also clears the must-change flag.
+func (u *UserHash) SetPasswordPolicy(name string) error {
+	return u.updateAuxData(func(aux auxData) (auxData, error) {
+		aux, _ = aux.remove(mustChangeAuxIdentifier)
+		return aux.set(passwordPolicyAuxIdentifier, []byte(name)), nil
+	})
+}
+
+// GetPasswordPolicy returns the name of the password policy the current password of the
+// user has been checked against. It returns an empty string if this is not known.
+func (u *UserHash) GetPasswordPolicy() (string, error) {
+	aux, err := u.getAuxData()
+	if err != nil {
+		return "", err
+	}
+	name, _, err := aux.get(passwordPolicyAuxIdentifier)
+	return string(name), err
+}
+
+// SetMustChange flags the user to change the password. The flag is cleared by SetPasswordPolicy.
+func (u *UserHash) SetMustChange() error {
+	return u.updateAuxData(func(aux auxData) (auxData, error) {
+		return aux.set(mustChangeAuxIdentifier, []byte("true")), nil
+	})
+}
+
+// MustChange returns whether the user has been flagged to change the password.
+func (u *UserHash) MustChange() (bool, error) {
+	aux, err := u.getAuxData()
+	if err != nil {
+		return false, err
+	}
+	_, found, err := aux.get(mustChangeAuxIdentifier)
+	return found, err
+}
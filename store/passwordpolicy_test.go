@@ -0,0 +1,85 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package store
+
+import (
+	"testing"
+)
+
+func TestPasswordPolicyMustChange(t *testing.T) {
+	username := "test-password-policy"
+
+	u := NewUserHash(testStoreUserHash, username)
+	if err := u.Add("secret", false); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer u.Remove()
+
+	if name, err := u.GetPasswordPolicy(); err != nil || name != "" {
+		t.Fatalf("new user should not have a password policy: %q, %v", name, err)
+	}
+	if err := u.SetPasswordPolicy("default"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if name, err := u.GetPasswordPolicy(); err != nil || name != "default" {
+		t.Fatalf("wrong password policy: %q, %v", name, err)
+	}
+
+	if err := u.SetAdmin(true); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := u.SetMustChange(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if mustChange, err := u.MustChange(); err != nil || !mustChange {
+		t.Fatal("must-change flag is not set:", err)
+	}
+	list, err := testStoreUserHash.List()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if user := list[username]; !user.IsAdmin || !user.MustChange {
+		t.Fatalf("list returned wrong flags: %+v", user)
+	}
+
+	if err := u.Update("new-secret"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := u.SetPasswordPolicy("admin"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if mustChange, err := u.MustChange(); err != nil || mustChange {
+		t.Fatal("must-change flag is still set:", err)
+	}
+	if name, err := u.GetPasswordPolicy(); err != nil || name != "admin" {
+		t.Fatalf("wrong password policy: %q, %v", name, err)
+	}
+}
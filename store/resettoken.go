@@ -0,0 +1,119 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package store
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const resetTokenAuxIdentifier = "reset"
+
+// SetResetToken stores a password reset token for the user which is valid until
+// expires. Only a hash of the token is stored. An existing reset token is replaced.
+func (u *UserHash) SetResetToken(token string, expires time.Time) error {
+	sum := sha256.Sum256([]byte(token))
+	data := fmt.Sprintf("%d:%s", expires.Unix(), hex.EncodeToString(sum[:]))
+	return u.updateAuxData(func(aux auxData) (auxData, error) {
+		return aux.set(resetTokenAuxIdentifier, []byte(data)), nil
+	})
+}
+
+// CheckResetToken checks whether token is the current, not yet expired, password
+// reset token of the user.
+func (u *UserHash) CheckResetToken(token string) (bool, error) {
+	aux, err := u.getAuxData()
+	if err != nil {
+		return false, err
+	}
+	return checkResetToken(aux, token)
+}
+
+// ConsumeResetToken checks whether token is the current, not yet expired, password
+// reset token of the user and removes it if so. Checking and removing the token is
+// done with a single write so a token can't be used twice.
+func (u *UserHash) ConsumeResetToken(token string) (ok bool, err error) {
+	err = u.updateAuxData(func(aux auxData) (auxData, error) {
+		var err error
+		if ok, err = checkResetToken(aux, token); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, errResetTokenUnchanged
+		}
+		aux, _ = aux.remove(resetTokenAuxIdentifier)
+		return aux, nil
+	})
+	if err == errResetTokenUnchanged {
+		err = nil
+	}
+	return
+}
+
+var errResetTokenUnchanged = errors.New("whawty.auth.store: reset token unchanged")
+
+func checkResetToken(aux auxData, token string) (bool, error) {
+	data, found, err := aux.get(resetTokenAuxIdentifier)
+	if err != nil || !found {
+		return false, err
+	}
+
+	expiresStr, hashStr, ok := strings.Cut(string(data), ":")
+	if !ok {
+		return false, fmt.Errorf("whawty.auth.store: reset token is invalid")
+	}
+	expires, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("whawty.auth.store: reset token is invalid, %v", err)
+	}
+	if time.Now().After(time.Unix(expires, 0)) {
+		return false, nil
+	}
+	hash, err := hex.DecodeString(hashStr)
+	if err != nil {
+		return false, fmt.Errorf("whawty.auth.store: reset token is invalid, %v", err)
+	}
+	sum := sha256.Sum256([]byte(token))
+	return subtle.ConstantTimeCompare(sum[:], hash) == 1, nil
+}
+
+// ClearResetToken removes the password reset token of the user, if there is one.
+func (u *UserHash) ClearResetToken() error {
+	return u.updateAuxData(func(aux auxData) (auxData, error) {
+		aux, _ = aux.remove(resetTokenAuxIdentifier)
+		return aux, nil
+	})
+}
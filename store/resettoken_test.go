@@ -0,0 +1,129 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResetToken(t *testing.T) {
+	username := "test-reset-token"
+
+	u := NewUserHash(testStoreUserHash, username)
+	if err := u.Add("secret", false); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer u.Remove()
+
+	if ok, err := u.CheckResetToken("token"); err != nil {
+		t.Fatal("unexpected error:", err)
+	} else if ok {
+		t.Fatal("token accepted although none was set")
+	}
+
+	if err := u.SetResetToken("token", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if ok, err := u.CheckResetToken("token"); err != nil || !ok {
+		t.Fatal("valid token was not accepted:", err)
+	}
+	if ok, err := u.CheckResetToken("other"); err != nil {
+		t.Fatal("unexpected error:", err)
+	} else if ok {
+		t.Fatal("wrong token was accepted")
+	}
+
+	if err := u.SetResetToken("new-token", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if ok, _ := u.CheckResetToken("token"); ok {
+		t.Fatal("replaced token is still accepted")
+	}
+
+	if err := u.ClearResetToken(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if ok, _ := u.CheckResetToken("new-token"); ok {
+		t.Fatal("cleared token is still accepted")
+	}
+
+	if err := u.SetResetToken("expired", time.Now().Add(-time.Second)); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if ok, err := u.CheckResetToken("expired"); err != nil {
+		t.Fatal("unexpected error:", err)
+	} else if ok {
+		t.Fatal("expired token was accepted")
+	}
+
+	if ok, _, _, _, err := u.Authenticate("secret"); err != nil || !ok {
+		t.Fatal("password got modified by reset token operations:", err)
+	}
+}
+
+func TestConsumeResetToken(t *testing.T) {
+	username := "test-consume-reset-token"
+
+	u := NewUserHash(testStoreUserHash, username)
+	if err := u.Add("secret", false); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer u.Remove()
+
+	if ok, err := u.ConsumeResetToken("token"); err != nil || ok {
+		t.Fatal("token consumed although none was set:", ok, err)
+	}
+
+	if err := u.SetResetToken("token", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if ok, err := u.ConsumeResetToken("other"); err != nil || ok {
+		t.Fatal("wrong token got consumed:", ok, err)
+	}
+	if ok, err := u.ConsumeResetToken("token"); err != nil || !ok {
+		t.Fatal("consuming valid token failed:", ok, err)
+	}
+	if ok, err := u.ConsumeResetToken("token"); err != nil || ok {
+		t.Fatal("token could be consumed twice:", ok, err)
+	}
+
+	if err := u.SetResetToken("expired", time.Now().Add(-time.Second)); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if ok, err := u.ConsumeResetToken("expired"); err != nil || ok {
+		t.Fatal("expired token got consumed:", ok, err)
+	}
+
+	if ok, _, _, _, err := u.Authenticate("secret"); err != nil || !ok {
+		t.Fatal("password got modified by reset token operations:", err)
+	}
+}
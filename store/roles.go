@@ -0,0 +1,103 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package store
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const rolesAuxIdentifier = "roles"
+
+var labelNameRe = regexp.MustCompile("^[A-Za-z0-9][-_.A-Za-z0-9]*$")
+
+// parseLabels splits a list of labels as stored in the aux data.
+func parseLabels(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(string(data), ",")
+}
+
+// sortLabels validates labels and returns them sorted and without duplicates. kind is
+// used in error messages only.
+func sortLabels(kind string, labels []string) ([]string, error) {
+	unique := make(map[string]bool)
+	for _, label := range labels {
+		if !labelNameRe.MatchString(label) {
+			return nil, fmt.Errorf("whawty.auth.store: %s name '%s' is invalid", kind, label)
+		}
+		unique[label] = true
+	}
+	sorted := make([]string, 0, len(unique))
+	for label := range unique {
+		sorted = append(sorted, label)
+	}
+	sort.Strings(sorted)
+	return sorted, nil
+}
+
+// setLabels replaces the aux data entry identifier with labels. Passing no labels removes the entry.
+func (u *UserHash) setLabels(identifier string, labels []string) error {
+	return u.updateAuxData(func(aux auxData) (auxData, error) {
+		if len(labels) == 0 {
+			aux, _ = aux.remove(identifier)
+			return aux, nil
+		}
+		return aux.set(identifier, []byte(strings.Join(labels, ","))), nil
+	})
+}
+
+// getLabels returns the labels stored in the aux data entry identifier.
+func (u *UserHash) getLabels(identifier string) ([]string, error) {
+	aux, err := u.getAuxData()
+	if err != nil {
+		return nil, err
+	}
+	data, _, err := aux.get(identifier)
+	return parseLabels(data), err
+}
+
+// SetRoles replaces the role labels of the user. Passing no roles removes all of them.
+func (u *UserHash) SetRoles(roles []string) error {
+	sorted, err := sortLabels("role", roles)
+	if err != nil {
+		return err
+	}
+	return u.setLabels(rolesAuxIdentifier, sorted)
+}
+
+// GetRoles returns the role labels of the user.
+func (u *UserHash) GetRoles() ([]string, error) {
+	return u.getLabels(rolesAuxIdentifier)
+}
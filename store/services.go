@@ -0,0 +1,61 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package store
+
+import (
+	"slices"
+)
+
+const (
+	servicesAuxIdentifier = "services"
+	// ServiceAll may be used in the list of services of a user to allow all services.
+	ServiceAll = "*"
+)
+
+// SetServices replaces the list of services the user may authenticate for. Passing no
+// services removes the list which means the defaults of the frontend apply.
+func (u *UserHash) SetServices(services []string) error {
+	all := slices.Contains(services, ServiceAll)
+	sorted, err := sortLabels("service", slices.DeleteFunc(slices.Clone(services), func(s string) bool { return s == ServiceAll }))
+	if err != nil {
+		return err
+	}
+	if all {
+		sorted = append([]string{ServiceAll}, sorted...)
+	}
+	return u.setLabels(servicesAuxIdentifier, sorted)
+}
+
+// GetServices returns the list of services the user may authenticate for. If no list
+// has been set the result is empty.
+func (u *UserHash) GetServices() ([]string, error) {
+	return u.getLabels(servicesAuxIdentifier)
+}
@@ -0,0 +1,88 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestServices(t *testing.T) {
+	username := "test-services"
+
+	u := NewUserHash(testStoreUserHash, username)
+	if err := u.Add("secret", false); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer u.Remove()
+
+	if services, err := u.GetServices(); err != nil || len(services) != 0 {
+		t.Fatalf("new user should not have any services: %v, %v", services, err)
+	}
+	if err := u.SetServices([]string{"imap smtp"}); err == nil {
+		t.Fatal("invalid service name was accepted")
+	}
+	if err := u.SetRoles([]string{"staff"}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := u.SetServices([]string{"smtp", "imap", "smtp"}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	expected := []string{"imap", "smtp"}
+	if services, err := u.GetServices(); err != nil || !reflect.DeepEqual(services, expected) {
+		t.Fatalf("wrong services: %v, %v", services, err)
+	}
+	if roles, err := u.GetRoles(); err != nil || !reflect.DeepEqual(roles, []string{"staff"}) {
+		t.Fatalf("setting services must not change the roles: %v, %v", roles, err)
+	}
+
+	list, err := testStoreUserHash.ListFull()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if user := list[username]; !reflect.DeepEqual(user.Services, expected) {
+		t.Fatalf("list returned wrong services: %v", user.Services)
+	}
+
+	if err := u.SetServices([]string{"imap", "*", "*"}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if services, err := u.GetServices(); err != nil || !reflect.DeepEqual(services, []string{ServiceAll, "imap"}) {
+		t.Fatalf("wrong services: %v, %v", services, err)
+	}
+
+	if err := u.SetServices(nil); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if services, err := u.GetServices(); err != nil || len(services) != 0 {
+		t.Fatalf("services should have been removed: %v, %v", services, err)
+	}
+}
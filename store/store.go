@@ -36,6 +36,7 @@
 package store
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"io"
@@ -240,6 +241,35 @@ func (d *Dir) RemoveUser(user string) {
 type User struct {
 	IsAdmin     bool      `json:"admin"`
 	LastChanged time.Time `json:"lastchanged"`
+	MustChange  bool      `json:"mustchange"`
+	Roles       []string  `json:"roles,omitempty"`
+	Services    []string  `json:"services,omitempty"`
+}
+
+// readListData reads everything reported by List() and ListFull() using a single read of
+// the hash file of the user. Since the aux data is informational only, errors reading it
+// are ignored.
+func readListData(filename string, d *Dir) (user UserFull) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer file.Close() //nolint:errcheck
+
+	first, aux, auxErr := readAuxData(bufio.NewReader(file))
+	var hashStr string
+	if user.FormatID, user.LastChanged, user.ParamID, hashStr, err = parseHashStr(first); err == nil {
+		user.IsSupported, _ = isHashSupported(d, user.FormatID, user.ParamID, hashStr)
+	}
+	if auxErr != nil {
+		return
+	}
+	_, user.MustChange, _ = aux.get(mustChangeAuxIdentifier)
+	data, _, _ := aux.get(rolesAuxIdentifier)
+	user.Roles = parseLabels(data)
+	data, _, _ = aux.get(servicesAuxIdentifier)
+	user.Services = parseLabels(data)
+	return
 }
 
 // UserList is the return value of List(). The key of the map is the username.
@@ -281,13 +311,12 @@ func (d *Dir) List() (UserList, error) {
 				continue
 			}
 
-			ok, _, lastchanged, _, _ := isFormatSupportedFull(filepath.Join(dir.Name(), name), d)
-			if !ok {
+			u := readListData(filepath.Join(dir.Name(), name), d)
+			if !u.IsSupported {
 				wl.Printf("ignoring file with unsupported hash format for username: '%s'", user)
 				continue
 			}
-
-			list[user] = User{isAdmin, lastchanged}
+			list[user] = User{isAdmin, u.LastChanged, u.MustChange, u.Roles, u.Services}
 		}
 
 		if last {
@@ -306,6 +335,9 @@ type UserFull struct {
 	IsSupported bool      `json:"supported"`
 	FormatID    string    `json:"formatid"`
 	ParamID     uint      `json:"paramid"`
+	MustChange  bool      `json:"mustchange"`
+	Roles       []string  `json:"roles,omitempty"`
+	Services    []string  `json:"services,omitempty"`
 }
 
 // UserListFull is the return value of ListFull(). The key of the map is the username.
@@ -338,13 +370,12 @@ func (d *Dir) ListFull() (UserListFull, error) {
 				continue
 			}
 
-			var user UserFull
-			var err error
-			var username string
-			if user.IsValid, username, user.IsAdmin, err = checkUserFile(name); err != nil {
+			isValid, username, isAdmin, err := checkUserFile(name)
+			if err != nil {
 				return list, err
 			}
-			user.IsSupported, user.FormatID, user.LastChanged, user.ParamID, _ = isFormatSupportedFull(filepath.Join(dir.Name(), name), d)
+			user := readListData(filepath.Join(dir.Name(), name), d)
+			user.IsValid, user.IsAdmin = isValid, isAdmin
 			list[username] = user
 		}
 
@@ -365,3 +396,95 @@ func (d *Dir) Exists(user string) (exists bool, isAdmin bool, err error) {
 func (d *Dir) Authenticate(user, password string) (isAuthenticated, isAdmin, upgradeable bool, lastchange time.Time, err error) {
 	return NewUserHash(d, user).Authenticate(password)
 }
+
+// AddAppPassword adds the application password called name to user. It is an error
+// if the user does not exist or already has an application password of that name.
+func (d *Dir) AddAppPassword(user, name, password string) error {
+	return NewUserHash(d, user).AddAppPassword(name, password)
+}
+
+// RemoveAppPassword revokes the application password called name of user.
+func (d *Dir) RemoveAppPassword(user, name string) error {
+	return NewUserHash(d, user).RemoveAppPassword(name)
+}
+
+// ListAppPasswords returns all application passwords of user.
+func (d *Dir) ListAppPasswords(user string) ([]AppPassword, error) {
+	return NewUserHash(d, user).ListAppPasswords()
+}
+
+// AuthenticateAppPassword checks if password is one of the application passwords
+// of user. It also returns whether user is an admin and the name of the matching
+// application password.
+func (d *Dir) AuthenticateAppPassword(user, password string) (isAuthenticated, isAdmin bool, name string, err error) {
+	return NewUserHash(d, user).AuthenticateAppPassword(password)
+}
+
+// FindAppPassword returns the hash of the application password of user with the same
+// tag as password. The password must then be checked using AppPasswordHash.Check.
+func (d *Dir) FindAppPassword(user, password string) (hash *AppPasswordHash, isAdmin bool, err error) {
+	return NewUserHash(d, user).FindAppPassword(password)
+}
+
+// SetResetToken stores a password reset token for user which is valid until expires.
+func (d *Dir) SetResetToken(user, token string, expires time.Time) error {
+	return NewUserHash(d, user).SetResetToken(token, expires)
+}
+
+// CheckResetToken checks whether token is a valid password reset token for user.
+func (d *Dir) CheckResetToken(user, token string) (bool, error) {
+	return NewUserHash(d, user).CheckResetToken(token)
+}
+
+// ConsumeResetToken checks whether token is a valid password reset token for user
+// and removes it if so.
+func (d *Dir) ConsumeResetToken(user, token string) (bool, error) {
+	return NewUserHash(d, user).ConsumeResetToken(token)
+}
+
+// ClearResetToken removes the password reset token of user.
+func (d *Dir) ClearResetToken(user string) error {
+	return NewUserHash(d, user).ClearResetToken()
+}
+
+// SetPasswordPolicy records the name of the password policy the current password of user
+// has been checked against and clears the must-change flag.
+func (d *Dir) SetPasswordPolicy(user, name string) error {
+	return NewUserHash(d, user).SetPasswordPolicy(name)
+}
+
+// GetPasswordPolicy returns the name of the password policy the current password of user
+// has been checked against.
+func (d *Dir) GetPasswordPolicy(user string) (string, error) {
+	return NewUserHash(d, user).GetPasswordPolicy()
+}
+
+// SetRoles replaces the role labels of user.
+func (d *Dir) SetRoles(user string, roles []string) error {
+	return NewUserHash(d, user).SetRoles(roles)
+}
+
+// GetRoles returns the role labels of user.
+func (d *Dir) GetRoles(user string) ([]string, error) {
+	return NewUserHash(d, user).GetRoles()
+}
+
+// SetServices replaces the list of services user may authenticate for.
+func (d *Dir) SetServices(user string, services []string) error {
+	return NewUserHash(d, user).SetServices(services)
+}
+
+// GetServices returns the list of services user may authenticate for.
+func (d *Dir) GetServices(user string) ([]string, error) {
+	return NewUserHash(d, user).GetServices()
+}
+
+// MustChange returns whether user has been flagged to change the password.
+func (d *Dir) MustChange(user string) (bool, error) {
+	return NewUserHash(d, user).MustChange()
+}
+
+// SetMustChange flags user to change the password.
+func (d *Dir) SetMustChange(user string) error {
+	return NewUserHash(d, user).SetMustChange()
+}
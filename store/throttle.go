@@ -0,0 +1,245 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package store
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// ThrottleConfig holds the parameters of a Throttle. The first Attempts failures
+// for a key are not throttled. Any further failure blocks the key for Backoff, which
+// gets doubled on every failure, up to MaxBackoff. After LockoutAttempts failures the
+// key is locked for Lockout. Failures are forgotten after Expire has passed since the
+// last failure. Setting LockoutAttempts to 0 disables the lockout. At most MaxEntries
+// keys are tracked, if this limit is reached the key with the oldest failure which is
+// not locked is forgotten. If all keys are locked, failures of new keys are not recorded.
+// 0 means no limit.
+type ThrottleConfig struct {
+	Attempts        uint
+	Backoff         time.Duration
+	MaxBackoff      time.Duration
+	LockoutAttempts uint
+	Lockout         time.Duration
+	Expire          time.Duration
+	MaxEntries      int
+}
+
+// ThrottleState holds the current state of a throttled key. This is used as the
+// value type for ThrottleList.
+type ThrottleState struct {
+	Failures     uint      `json:"failures"`
+	LastFailure  time.Time `json:"lastfailure"`
+	BlockedUntil time.Time `json:"blockeduntil"`
+	Locked       bool      `json:"locked"`
+}
+
+// ThrottleList is the return value of Throttle.List(). The key of the map is the throttled key.
+type ThrottleList map[string]ThrottleState
+
+type throttleEntry struct {
+	key   string
+	state ThrottleState
+}
+
+// Throttle keeps track of failed authentication attempts and decides whether further
+// attempts are allowed. Keys are opaque strings, typically a username or a client address.
+// Use NewThrottle to create it. It is safe for concurrent use.
+type Throttle struct {
+	mutex  sync.Mutex
+	config ThrottleConfig
+	state  map[string]*list.Element
+	order  *list.List // ordered by the time of the last failure, oldest first
+	now    func() time.Time
+}
+
+// NewThrottle creates a new Throttle using config.
+func NewThrottle(config ThrottleConfig) (t *Throttle) {
+	t = &Throttle{}
+	t.config = config
+	t.state = make(map[string]*list.Element)
+	t.order = list.New()
+	t.now = time.Now
+	return
+}
+
+func (t *Throttle) expired(s *ThrottleState, now time.Time) bool {
+	return !now.Before(s.BlockedUntil) && now.Sub(s.LastFailure) >= t.config.Expire
+}
+
+func (t *Throttle) remove(e *list.Element) {
+	delete(t.state, e.Value.(*throttleEntry).key)
+	t.order.Remove(e)
+}
+
+// lookup returns the state of key, expired state is removed on the way.
+func (t *Throttle) lookup(key string, now time.Time) *ThrottleState {
+	e, exists := t.state[key]
+	if !exists {
+		return nil
+	}
+	s := &e.Value.(*throttleEntry).state
+	if t.expired(s, now) {
+		t.remove(e)
+		return nil
+	}
+	return s
+}
+
+// expireOldest removes expired entries starting with the oldest failure. It stops at
+// the first entry which is still valid, so this is cheap enough to be called on every
+// failure.
+func (t *Throttle) expireOldest(now time.Time) {
+	for e := t.order.Front(); e != nil; e = t.order.Front() {
+		if !t.expired(&e.Value.(*throttleEntry).state, now) {
+			return
+		}
+		t.remove(e)
+	}
+}
+
+// evict removes the entry with the oldest failure which is not locked. Otherwise flooding
+// the throttle with new keys would reset the lockout of others. It returns false if all
+// entries are locked.
+func (t *Throttle) evict(now time.Time) bool {
+	for e := t.order.Front(); e != nil; e = e.Next() {
+		s := &e.Value.(*throttleEntry).state
+		if !s.Locked || !now.Before(s.BlockedUntil) {
+			t.remove(e)
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Throttle) backoff(failures uint) time.Duration {
+	if failures < t.config.Attempts {
+		return 0
+	}
+	d := t.config.Backoff
+	for i := t.config.Attempts; i < failures; i++ {
+		d *= 2
+		if d >= t.config.MaxBackoff {
+			return t.config.MaxBackoff
+		}
+	}
+	if d > t.config.MaxBackoff {
+		return t.config.MaxBackoff
+	}
+	return d
+}
+
+// Allow checks whether an attempt is allowed for all of keys. If not, it also returns
+// how long the caller has to wait before the next attempt will be allowed.
+func (t *Throttle) Allow(keys ...string) (ok bool, retryAfter time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.now()
+	for _, key := range keys {
+		if s := t.lookup(key, now); s != nil && now.Before(s.BlockedUntil) {
+			if wait := s.BlockedUntil.Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+	return retryAfter == 0, retryAfter
+}
+
+// Failure records a failed attempt for all of keys.
+func (t *Throttle) Failure(keys ...string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.now()
+	t.expireOldest(now)
+	for _, key := range keys {
+		s := t.lookup(key, now)
+		if s == nil {
+			if t.config.MaxEntries > 0 && len(t.state) >= t.config.MaxEntries && !t.evict(now) {
+				continue
+			}
+			e := t.order.PushBack(&throttleEntry{key: key})
+			t.state[key] = e
+			s = &e.Value.(*throttleEntry).state
+		} else {
+			t.order.MoveToBack(t.state[key])
+		}
+		s.Failures++
+		s.LastFailure = now
+		if t.config.LockoutAttempts > 0 && s.Failures >= t.config.LockoutAttempts {
+			s.Locked = true
+			s.BlockedUntil = now.Add(t.config.Lockout)
+		} else {
+			s.BlockedUntil = now.Add(t.backoff(s.Failures))
+		}
+	}
+}
+
+// Success forgets all failed attempts for keys.
+func (t *Throttle) Success(keys ...string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, key := range keys {
+		if e, exists := t.state[key]; exists {
+			t.remove(e)
+		}
+	}
+}
+
+// List returns the state of all keys with recorded failures.
+func (t *Throttle) List() ThrottleList {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.now()
+	list := make(ThrottleList)
+	for key := range t.state {
+		if s := t.lookup(key, now); s != nil {
+			list[key] = *s
+		}
+	}
+	return list
+}
+
+// Reset forgets all failed attempts for key. It returns false if there were none.
+func (t *Throttle) Reset(key string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	e, exists := t.state[key]
+	if exists {
+		t.remove(e)
+	}
+	return exists
+}
@@ -0,0 +1,214 @@
+//
+// Copyright (c) 2026 whawty contributors (see AUTHORS file)
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// * Neither the name of whawty.auth nor the names of its
+//   contributors may be used to endorse or promote products derived from
+//   this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func newTestThrottle() (*Throttle, *testClock) {
+	clock := &testClock{now: time.Unix(1500000000, 0)}
+	t := NewThrottle(ThrottleConfig{
+		Attempts:        3,
+		Backoff:         time.Second,
+		MaxBackoff:      10 * time.Second,
+		LockoutAttempts: 10,
+		Lockout:         time.Hour,
+		Expire:          2 * time.Hour,
+	})
+	t.now = clock.Now
+	return t, clock
+}
+
+func TestThrottleBackoff(t *testing.T) {
+	throttle, clock := newTestThrottle()
+
+	for i := 0; i < 2; i++ {
+		throttle.Failure("user:foo")
+		if ok, _ := throttle.Allow("user:foo"); !ok {
+			t.Fatalf("attempt after %d failures should be allowed", i+1)
+		}
+	}
+
+	expected := []time.Duration{1, 2, 4, 8, 10, 10}
+	for _, exp := range expected {
+		throttle.Failure("user:foo")
+		ok, retry := throttle.Allow("user:foo")
+		if ok || retry != exp*time.Second {
+			t.Fatalf("expected back-off of %v, got ok = %t, retry-after = %v", exp*time.Second, ok, retry)
+		}
+		if ok, _ := throttle.Allow("user:bar"); !ok {
+			t.Fatalf("other keys should not be throttled")
+		}
+		clock.now = clock.now.Add(retry)
+		if ok, _ := throttle.Allow("user:foo"); !ok {
+			t.Fatalf("attempt after waiting for the back-off should be allowed")
+		}
+	}
+
+	throttle.Success("user:foo")
+	if list := throttle.List(); len(list) != 0 {
+		t.Fatalf("success should clear the state, got %v", list)
+	}
+}
+
+func TestThrottleLockout(t *testing.T) {
+	throttle, clock := newTestThrottle()
+
+	for i := 0; i < 10; i++ {
+		throttle.Failure("user:foo", "addr:192.0.2.1")
+	}
+	ok, retry := throttle.Allow("user:other", "addr:192.0.2.1")
+	if ok || retry != time.Hour {
+		t.Fatalf("expected lockout of 1h, got ok = %t, retry-after = %v", ok, retry)
+	}
+
+	list := throttle.List()
+	if len(list) != 2 || !list["user:foo"].Locked || list["addr:192.0.2.1"].Failures != 10 {
+		t.Fatalf("list returned wrong state: %v", list)
+	}
+
+	if !throttle.Reset("addr:192.0.2.1") {
+		t.Fatalf("reset of existing key should return true")
+	}
+	if throttle.Reset("addr:192.0.2.1") {
+		t.Fatalf("reset of unknown key should return false")
+	}
+	if ok, _ := throttle.Allow("user:other", "addr:192.0.2.1"); !ok {
+		t.Fatalf("attempt after reset should be allowed")
+	}
+	if ok, _ := throttle.Allow("user:foo"); ok {
+		t.Fatalf("reset should only affect the given key")
+	}
+
+	clock.now = clock.now.Add(time.Hour)
+	if ok, _ := throttle.Allow("user:foo"); !ok {
+		t.Fatalf("attempt after lockout should be allowed")
+	}
+	if len(throttle.List()) != 1 {
+		t.Fatalf("state should be kept until it expires")
+	}
+	clock.now = clock.now.Add(time.Hour)
+	if len(throttle.List()) != 0 {
+		t.Fatalf("state should be expired")
+	}
+}
+
+func TestThrottleMaxEntries(t *testing.T) {
+	throttle, clock := newTestThrottle()
+	throttle.config.MaxEntries = 2
+
+	throttle.Failure("user:foo")
+	clock.now = clock.now.Add(time.Minute)
+	throttle.Failure("user:bar")
+	clock.now = clock.now.Add(time.Minute)
+	throttle.Failure("user:foo")
+	throttle.Failure("user:baz")
+
+	list := throttle.List()
+	if len(list) != 2 {
+		t.Fatalf("throttle should keep at most 2 entries, got %v", list)
+	}
+	if _, exists := list["user:bar"]; exists {
+		t.Fatalf("the entry with the oldest failure should have been removed, got %v", list)
+	}
+	if list["user:foo"].Failures != 2 {
+		t.Fatalf("list returned wrong state: %v", list)
+	}
+}
+
+func TestThrottleMaxEntriesLocked(t *testing.T) {
+	throttle, clock := newTestThrottle()
+	throttle.config.MaxEntries = 2
+
+	for i := 0; i < 10; i++ {
+		throttle.Failure("user:victim")
+	}
+	clock.now = clock.now.Add(time.Minute)
+	throttle.Failure("user:foo")
+	throttle.Failure("user:bar")
+
+	list := throttle.List()
+	if _, exists := list["user:foo"]; exists || len(list) != 2 {
+		t.Fatalf("the oldest entry which is not locked should have been removed, got %v", list)
+	}
+	if ok, _ := throttle.Allow("user:victim"); ok {
+		t.Fatalf("locked entries must not be removed to make room for new keys")
+	}
+
+	for i := 0; i < 9; i++ {
+		throttle.Failure("user:bar")
+	}
+	throttle.Failure("user:baz")
+	list = throttle.List()
+	if _, exists := list["user:baz"]; exists || len(list) != 2 {
+		t.Fatalf("new keys should not be recorded if all entries are locked, got %v", list)
+	}
+
+	clock.now = clock.now.Add(time.Hour)
+	throttle.Failure("user:baz")
+	if _, exists := throttle.List()["user:baz"]; !exists {
+		t.Fatalf("entries should be removed once their lockout is over")
+	}
+}
+
+func TestThrottleLazyExpire(t *testing.T) {
+	throttle, clock := newTestThrottle()
+
+	throttle.Failure("user:foo")
+	clock.now = clock.now.Add(time.Hour)
+	throttle.Failure("user:bar")
+	clock.now = clock.now.Add(time.Hour)
+	throttle.Failure("user:baz")
+	if len(throttle.state) != 2 || throttle.order.Len() != 2 {
+		t.Fatalf("expired entries should be removed on failures, got %d entries", len(throttle.state))
+	}
+
+	for i := 0; i < 5; i++ {
+		throttle.Failure("user:baz")
+	}
+	clock.now = clock.now.Add(2 * time.Hour)
+	if ok, _ := throttle.Allow("user:baz"); !ok {
+		t.Fatalf("attempt after expiry should be allowed")
+	}
+	if _, exists := throttle.state["user:baz"]; exists {
+		t.Fatalf("expired entry should be removed on lookup")
+	}
+}
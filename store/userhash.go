@@ -76,8 +76,13 @@ func readHashStr(filename string) (string, time.Time, uint, string, error) {
 	if err != nil && err != io.EOF {
 		return "", time.Unix(0, 0), 0, "", err
 	}
+	return parseHashStr(data)
+}
 
-	parts := strings.SplitN(string(data), ":", 4)
+// parseHashStr separates the first line of a user hash file into format id string,
+// change time parameter id and the whole hash string.
+func parseHashStr(data string) (string, time.Time, uint, string, error) {
+	parts := strings.SplitN(data, ":", 4)
 	if len(parts) != 4 {
 		return "", time.Unix(0, 0), 0, "", fmt.Errorf("whawty.auth.store: hash file is invalid")
 	}
@@ -102,19 +107,19 @@ func isFormatSupportedFull(filename string, store *Dir) (supported bool, formatI
 	if formatID, lastChange, paramID, hashStr, err = readHashStr(filename); err != nil {
 		return
 	}
+	supported, err = isHashSupported(store, formatID, paramID, hashStr)
+	return
+}
 
+func isHashSupported(store *Dir, formatID string, paramID uint, hashStr string) (bool, error) {
 	h := store.Params[paramID]
 	if h == nil {
-		err = fmt.Errorf("whawty.auth.store: parameter-set %d is unknown", paramID)
-		return
+		return false, fmt.Errorf("whawty.auth.store: parameter-set %d is unknown", paramID)
 	}
 	if h.GetFormatID() != formatID {
-		err = fmt.Errorf("whawty.auth.store: hash file format ID '%s' does not fit parameter-set %d", formatID, paramID)
-		return
+		return false, fmt.Errorf("whawty.auth.store: hash file format ID '%s' does not fit parameter-set %d", formatID, paramID)
 	}
-
-	supported, err = h.IsValid(hashStr)
-	return
+	return h.IsValid(hashStr)
 }
 
 func isFormatSupported(filename string, store *Dir) error {
@@ -201,18 +206,23 @@ func (u *UserHash) writeHashStr(password string, isAdmin bool, mayCreate bool) e
 		return err
 	}
 
+	return commitTempFile(tmp, file.Name())
+}
+
+// commitTempFile flushes tmp to disk and atomically moves it to filename.
+func commitTempFile(tmp *os.File, filename string) error {
 	// Flush the file's contents to disk
 	if err := tmp.Sync(); err != nil {
 		return err
 	}
 
 	// Atomically move the new file in place
-	if err := os.Rename(tmp.Name(), file.Name()); err != nil {
+	if err := os.Rename(tmp.Name(), filename); err != nil {
 		return err
 	}
 
 	// Flush the move to disk
-	dir, err := os.Open(filepath.Dir(file.Name()))
+	dir, err := os.Open(filepath.Dir(filename))
 	if err != nil {
 		return err
 	}
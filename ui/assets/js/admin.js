@@ -316,16 +316,6 @@ function main_userViewInit() {
  * Main: global
  *
  */
-function async_load(src) {
-  var first, s;
-  s = document.createElement('script');
-  s.src = src;
-  s.type = 'text/javascript';
-  s.async = true;
-  first = document.getElementsByTagName('script')[0];
-  return first.parentNode.insertBefore(s, first);
-}
-
 function getDateTimeString(d) {
   var datetimestr = Number(d.getDate()).pad(2);
   datetimestr += '.' + Number(d.getMonth() + 1).pad(2);
@@ -401,36 +391,54 @@ main_PWStrengthLevel[2] = 'warning';
 main_PWStrengthLevel[3] = 'success';
 main_PWStrengthLevel[4] = 'success';
 
-function main_enablePWChecks() {
-  $('#changepw-password').on('input', function() {
-    main_comparePasswords();
-
-    var res = zxcvbn($(this).val(), [ $('#changepw-userfield').text(), 'whawty' ]);
+var main_PWCheckSeq = 0;
 
-    $("#pwestimatedcracktime").html('estimated crack-time: <strong>' + res.crack_times_display.offline_slow_hashing_1e4_per_second + '</strong>');
+function main_showPWFeedback(res) {
+  $("#pwestimatedcracktime").html('estimated crack-time: <strong>' + res.crack_time_display + '</strong>');
 
-    var ind = $('#pwstrengthindicator').empty();
-    for(var i=0; i<4; ++i) {
-      if(i < res.score) {
-        ind.append('<i class="fa-solid fa-star pwstrengthscore' + res.score + '" aria-hidden="true"></i>');
-      } else {
-        ind.append('<i class="fa-solid fa-star pwstrengthscore0" aria-hidden="true"></i>');
-      }
+  var ind = $('#pwstrengthindicator').empty();
+  for(var i=0; i<4; ++i) {
+    if(i < res.score) {
+      ind.append('<i class="fa-solid fa-star pwstrengthscore' + res.score + '" aria-hidden="true"></i>');
+    } else {
+      ind.append('<i class="fa-solid fa-star pwstrengthscore0" aria-hidden="true"></i>');
     }
+  }
+
+  var tips = $('<div>');
+  if(!res.ok) {
+    tips.append($('<div class="alert alert-danger" role="alert">').text('This password does not fulfill the password policy'));
+  }
+  res.warnings.forEach(function(warning) {
+    tips.append($('<div class="alert alert-danger" role="alert">').text(warning));
+  });
+  if(res.ok && res.warnings.length == 0) {
+    tips.append($('<div class="alert alert-' + main_PWStrengthLevel[res.score] + '" role="alert">').text('This is a ' + main_PWStrength[res.score] + ' password'));
+  }
+  res.suggestions.forEach(function(tip) {
+    tips.append($('<div class="alert alert-info" role="alert">').text(tip));
+  });
+  $("#pwstrengthtips").empty().append(tips.children());
+}
 
-    var tips = '';
+function main_enablePWChecks() {
+  $('#changepw-password').on('input', function() {
+    main_comparePasswords();
+
+    var seq = ++main_PWCheckSeq;
     if($(this).val() == "") {
-      tips = '<div class="alert alert-info" role="alert">Please type in a password</div>';
-    } else if(res.feedback.warning) {
-      tips = '<div class="alert alert-danger" role="alert">' + res.feedback.warning + '</div>';
-    } else {
-      tips = '<div class="alert alert-' + main_PWStrengthLevel[res.score] + '" role="alert">This is a ' + main_PWStrength[res.score] + ' password</div>';
+      $("#pwestimatedcracktime").empty();
+      $('#pwstrengthindicator').empty();
+      $("#pwstrengthtips").html('<div class="alert alert-info" role="alert">Please type in a password</div>');
+      return;
     }
-    res.feedback.suggestions.forEach(function(tip) {
-      tips = tips + '<div class="alert alert-info" role="alert">' + tip + '</div>';
-    });
 
-    $("#pwstrengthtips").html(tips);
+    var data = JSON.stringify({ session: auth_session, username: $('#changepw-userfield').text(), password: $(this).val() });
+    $.post("/api/check-password", data, function(res) {
+      if(seq == main_PWCheckSeq) { // ignore responses which arrive out of order
+        main_showPWFeedback(res);
+      }
+    }, 'json');
   });
 
   $('#changepw-password-retype').on('input', main_comparePasswords);
@@ -446,5 +454,4 @@ function main_init() {
     $("#user-view").show();
     main_userViewInit();
   }
-  async_load('js/zxcvbn.js');
 }